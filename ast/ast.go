@@ -59,7 +59,7 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	out.WriteString(ls.Name.typedString())
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -76,6 +76,9 @@ type Identifier struct {
 	Token token.Token // the token.IDENT token
 	// Value is used to represent the name in a variable binding x in `let x = 5`,
 	Value string
+	// Type is the optional type annotation of a let binding or a function parameter (x in `let x: int = 5`).
+	// It is only used by the checker, the engines ignore it.
+	Type *TypeAnnotation
 }
 
 // expressionNode is implemented to allow Identifier to be served as an Expression
@@ -87,6 +90,24 @@ func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 // String() returns the identifier's name value (x in let x = 5)
 func (i *Identifier) String() string { return i.Value }
 
+// TypeAnnotation is the name of a type written after a colon (int in `let x: int = 5`)
+// Annotations are optional and have no effect at runtime.
+type TypeAnnotation struct {
+	Token token.Token // the token of the type name
+	Name  string
+}
+
+// String returns the name of the annotated type
+func (ta *TypeAnnotation) String() string { return ta.Name }
+
+// typedString returns the identifier followed by its type annotation, if it has one (x: int)
+func (i *Identifier) typedString() string {
+	if i.Type == nil {
+		return i.Value
+	}
+	return i.Value + ": " + i.Type.String()
+}
+
 // ReturnStatement holds a Token field for the return token
 // and a ReturnValue field for the expression that's to be returned
 type ReturnStatement struct {
@@ -115,6 +136,35 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// YieldStatement holds a Token field for the yield token
+// and a Value field for the expression that's to be yielded.
+// A function literal containing a yield statement is a generator function.
+type YieldStatement struct {
+	Token token.Token // the token.YIELD token
+	Value Expression
+}
+
+// statementNode is implemented to allow YieldStatement to be served as a Statement
+func (ys *YieldStatement) statementNode() {}
+
+// TokenLiteral returns the literal value (Token.Literal) for a token of type token.YIELD
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Literal }
+
+// String constructs the entire YieldStatement node as a string
+func (ys *YieldStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ys.TokenLiteral() + " ")
+
+	if ys.Value != nil {
+		out.WriteString(ys.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 // ExpressionStatement holds a Token field and
 // an Expression field for the expression.
 // It implements the Node and Statement interfaces.
@@ -260,6 +310,41 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ForExpression is used to construct an ast.Node for for-in loops (for (x in coll) { ... }).
+// Value is bound to each element of the iterable in turn, Key is optional and bound to the
+// key of the element (for (k, v in hash) { ... }). A for-in loop always evaluates to null.
+type ForExpression struct {
+	Token    token.Token     // The 'for' token
+	Key      *Identifier     // The optional identifier bound to the key of each element
+	Value    *Identifier     // The identifier bound to each element
+	Iterable Expression      // The expression producing the collection being walked
+	Body     *BlockStatement // The statements executed for each element
+}
+
+// expressionNode is implemented to allow ForExpression to be served as an Expression
+func (fe *ForExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value (Token.Literal) for the "for" token
+func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+
+// String builds the entire ForExpression as a string
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fe.Key != nil {
+		out.WriteString(fe.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fe.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fe.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fe.Body.String())
+
+	return out.String()
+}
+
 // BlockStatement holds the necessary information
 // to construct a statement(s) that exist within an IfExpression or Function Literal
 type BlockStatement struct {
@@ -292,6 +377,10 @@ type FunctionLiteral struct {
 	Parameters []*Identifier   // The parameters of the function
 	Body       *BlockStatement // The collection of statements in the body of the function
 	Name       string          // The name the function is bound to
+	ReturnType *TypeAnnotation // The optional annotation of the type the function returns
+	// IsGenerator is set when the body contains a yield statement. Calling a generator
+	// function does not run its body, it produces a generator that runs it lazily.
+	IsGenerator bool
 }
 
 // expressionNode is implemented to allow FunctionLiteral to be served as an Expression
@@ -309,7 +398,7 @@ func (fl *FunctionLiteral) String() string {
 	params := []string{}
 
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		params = append(params, p.typedString())
 	}
 
 	out.WriteString(fl.TokenLiteral())
@@ -318,7 +407,11 @@ func (fl *FunctionLiteral) String() string {
 	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(")")
+	if fl.ReturnType != nil {
+		out.WriteString(": " + fl.ReturnType.String())
+	}
+	out.WriteString(" ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -472,6 +565,7 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token               // the '{' token
 	Pairs map[Expression]Expression // the key value pairs of the hash
+	Keys  []Expression              // the keys of the hash, in the order they appear in the source
 }
 
 // expressionNode is implemented to allow HashLiteral to be served as an Expression
@@ -487,8 +581,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -496,3 +590,95 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// StructStatement is used to construct an ast.Node for struct declarations (struct Point { x, y })
+// Parsing the tokens of a struct declaration should return a StructStatement struct.
+// The declaration binds Name to a constructor that accepts one argument per field.
+type StructStatement struct {
+	Token  token.Token   // the token.STRUCT token
+	Name   *Identifier   // Name holds the identifier the struct type is bound to
+	Fields []*Identifier // Fields holds the declared fields in the order of their layout
+}
+
+// statementNode is implemented to allow StructStatement to be served as a Statement
+func (ss *StructStatement) statementNode() {}
+
+// TokenLiteral returns the literal value (Token.Literal) for the "struct" token
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+
+// String builds the entire StructStatement as a string,
+// listing the declared fields in order
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+
+	out.WriteString(ss.TokenLiteral() + " ")
+	out.WriteString(ss.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// FieldExpression is used to construct an ast.Node for field access expressions (point.x)
+// Parsing the tokens of a field access should return a FieldExpression struct.
+// FieldExpression is a valid expression node within the abstract-syntax tree.
+type FieldExpression struct {
+	Token token.Token // The . token
+	Left  Expression  // the expression producing the struct being accessed
+	Field *Identifier // the name of the field being accessed
+}
+
+// expressionNode is implemented to allow FieldExpression to be served as an Expression
+func (fe *FieldExpression) expressionNode() {}
+
+// TokenLiteral returns the literal value (Token.Literal) for the "." token
+func (fe *FieldExpression) TokenLiteral() string { return fe.Token.Literal }
+
+// String builds the entire FieldExpression as a string.
+func (fe *FieldExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(fe.Left.String())
+	out.WriteString(".")
+	out.WriteString(fe.Field.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// SetLiteral is used to construct an ast.Node for set literals ({1, 2, 3})
+// Parsing the tokens of a set literal should return a SetLiteral struct.
+// SetLiteral is a valid expression node within the abstract-syntax tree.
+type SetLiteral struct {
+	Token    token.Token  // the '{' token
+	Elements []Expression // the elements of the set
+}
+
+// expressionNode is implemented to allow SetLiteral to be served as an Expression
+func (sl *SetLiteral) expressionNode() {}
+
+// TokenLiteral returns the literal value (Token.Literal) for the opening brace of the set literal
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+// String builds the entire SetLiteral as a string.
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
@@ -0,0 +1,496 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/yourfavoritedev/golang-interpreter/ast"
+	"github.com/yourfavoritedev/golang-interpreter/token"
+)
+
+// Type describes the static type of an expression, as far as the Checker can tell.
+// Function types also describe the types of their parameters and the type they return.
+// Any is used whenever the type cannot be known before running the program, it is
+// compatible with every other type.
+type Type struct {
+	Name   string
+	Params []*Type
+	Return *Type
+}
+
+var (
+	Any       = &Type{Name: "any"}
+	Int       = &Type{Name: "int"}
+	String    = &Type{Name: "string"}
+	Bool      = &Type{Name: "bool"}
+	Null      = &Type{Name: "null"}
+	Array     = &Type{Name: "array"}
+	Hash      = &Type{Name: "hash"}
+	Set       = &Type{Name: "set"}
+	Channel   = &Type{Name: "channel"}
+	Generator = &Type{Name: "generator"}
+)
+
+// builtinTypes maps the names usable in type annotations to their types.
+// "fn" stands for any function, regardless of its signature.
+var builtinTypes = map[string]*Type{
+	"any":       Any,
+	"int":       Int,
+	"string":    String,
+	"bool":      Bool,
+	"null":      Null,
+	"array":     Array,
+	"hash":      Hash,
+	"set":       Set,
+	"channel":   Channel,
+	"generator": Generator,
+	"fn":        {Name: "fn"},
+}
+
+// String returns the name of the type
+func (t *Type) String() string { return t.Name }
+
+// assignable reports whether a value of type actual can be used where a value of type target is expected
+func assignable(target, actual *Type) bool {
+	if target == Any || actual == Any {
+		return true
+	}
+	return target.Name == actual.Name
+}
+
+// Error is a type error found by the Checker, along with the position in the input where it was found.
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error returns the message of the Error prefixed with its position (line:column: message)
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// scope keeps track of the types of the bindings of a function, or of the program.
+// Like the environments of the evaluator, it is enclosed by the scope it was created in.
+type scope struct {
+	store map[string]*Type
+	outer *scope
+}
+
+// resolve finds the type of a binding, looking through the enclosing scopes.
+// Bindings the Checker does not know about (such as the builtins) are of type Any.
+func (s *scope) resolve(name string) *Type {
+	for sc := s; sc != nil; sc = sc.outer {
+		if t, ok := sc.store[name]; ok {
+			return t
+		}
+	}
+	return Any
+}
+
+// Checker is a static pass over the abstract-syntax tree that runs before the program is compiled or evaluated.
+// It uses the optional type annotations of let bindings, function parameters and return types, along with the
+// types of literals, to report operations on mismatched types before the program runs.
+// A Checker keeps track of the bindings it has seen, so it can check a program that is given piece by piece (the REPL).
+type Checker struct {
+	scope *scope
+	// types holds the named types declared by struct statements
+	types map[string]*Type
+	// returnType is the annotated return type of the function being checked, nil if it has none
+	returnType *Type
+	errors     []*Error
+}
+
+// New creates a new Checker with an empty scope
+func New() *Checker {
+	return &Checker{
+		scope: &scope{store: make(map[string]*Type)},
+		types: make(map[string]*Type),
+	}
+}
+
+// Copy returns a copy of the Checker, the bindings and types one of them sees afterwards are unknown to the other
+func (c *Checker) Copy() *Checker {
+	store := make(map[string]*Type, len(c.scope.store))
+	for name, t := range c.scope.store {
+		store[name] = t
+	}
+	types := make(map[string]*Type, len(c.types))
+	for name, t := range c.types {
+		types[name] = t
+	}
+
+	return &Checker{
+		scope:      &scope{store: store, outer: c.scope.outer},
+		types:      types,
+		returnType: c.returnType,
+	}
+}
+
+// Check checks the statements of program and returns the type errors it found
+func (c *Checker) Check(program *ast.Program) []*Error {
+	c.errors = nil
+
+	for _, s := range program.Statements {
+		c.checkStatement(s)
+	}
+
+	return c.errors
+}
+
+// errorf records a new type error at the position of the given token
+func (c *Checker) errorf(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, &Error{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// resolveAnnotation returns the type named by a type annotation. Unknown names are reported and
+// treated as Any. A missing annotation is Any as well.
+func (c *Checker) resolveAnnotation(ta *ast.TypeAnnotation) *Type {
+	if ta == nil {
+		return Any
+	}
+
+	if t, ok := builtinTypes[ta.Name]; ok {
+		return t
+	}
+
+	if t, ok := c.types[ta.Name]; ok {
+		return t
+	}
+
+	c.errorf(ta.Token, "unknown type %s", ta.Name)
+	return Any
+}
+
+// checkStatement checks a single statement
+func (c *Checker) checkStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		target := c.resolveAnnotation(stmt.Name.Type)
+
+		// bind the signature of a function before checking its body, so recursive calls can be checked.
+		// Unknown types in the signature are reported once the function literal itself is checked.
+		if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			errors := c.errors
+			c.scope.store[stmt.Name.Value] = c.signature(fl)
+			c.errors = errors
+		}
+
+		actual := c.checkExpression(stmt.Value)
+		if !assignable(target, actual) {
+			c.errorf(position(stmt.Value), "cannot use %s as %s in let %s", actual, target, stmt.Name.Value)
+		}
+
+		// the annotation wins over the type of the value, unless there is no annotation
+		// or it does not describe the signature of the function being bound
+		if target == Any || (target.Name == "fn" && target.Return == nil && actual.Name == "fn") {
+			target = actual
+		}
+		c.scope.store[stmt.Name.Value] = target
+
+	case *ast.ReturnStatement:
+		actual := c.checkExpression(stmt.ReturnValue)
+		if c.returnType != nil && !assignable(c.returnType, actual) {
+			c.errorf(position(stmt.ReturnValue), "cannot use %s as %s in return", actual, c.returnType)
+		}
+
+	case *ast.YieldStatement:
+		c.checkExpression(stmt.Value)
+
+	case *ast.ExpressionStatement:
+		c.checkExpression(stmt.Expression)
+
+	case *ast.StructStatement:
+		// a struct declaration declares a named type and binds its constructor
+		structType := &Type{Name: stmt.Name.Value}
+		c.types[stmt.Name.Value] = structType
+
+		params := make([]*Type, len(stmt.Fields))
+		for i := range params {
+			params[i] = Any
+		}
+		c.scope.store[stmt.Name.Value] = &Type{Name: "fn", Params: params, Return: structType}
+
+	case *ast.BlockStatement:
+		c.checkBlock(stmt)
+	}
+}
+
+// checkBlock checks the statements of a block and returns the type of the value it produces,
+// which is the type of its last expression statement
+func (c *Checker) checkBlock(block *ast.BlockStatement) *Type {
+	result := Any
+
+	for i, s := range block.Statements {
+		if es, ok := s.(*ast.ExpressionStatement); ok && i == len(block.Statements)-1 {
+			result = c.checkExpression(es.Expression)
+			continue
+		}
+		c.checkStatement(s)
+	}
+
+	return result
+}
+
+// signature returns the function type described by the annotations of a function literal
+func (c *Checker) signature(fl *ast.FunctionLiteral) *Type {
+	params := make([]*Type, len(fl.Parameters))
+	for i, p := range fl.Parameters {
+		params[i] = c.resolveAnnotation(p.Type)
+	}
+
+	ret := c.resolveAnnotation(fl.ReturnType)
+	if fl.IsGenerator {
+		ret = Generator
+	}
+
+	return &Type{Name: "fn", Params: params, Return: ret}
+}
+
+// checkExpression checks an expression and returns its type
+func (c *Checker) checkExpression(exp ast.Expression) *Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		return c.scope.resolve(exp.Value)
+
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			c.checkExpression(el)
+		}
+		return Array
+
+	case *ast.HashLiteral:
+		for _, key := range exp.Keys {
+			c.checkExpression(key)
+			c.checkExpression(exp.Pairs[key])
+		}
+		return Hash
+
+	case *ast.SetLiteral:
+		for _, el := range exp.Elements {
+			c.checkExpression(el)
+		}
+		return Set
+
+	case *ast.PrefixExpression:
+		return c.checkPrefixExpression(exp)
+
+	case *ast.InfixExpression:
+		return c.checkInfixExpression(exp)
+
+	case *ast.IfExpression:
+		c.checkExpression(exp.Condition)
+		consequence := c.checkBlock(exp.Consequence)
+		if exp.Alternative == nil {
+			return Any
+		}
+		alternative := c.checkBlock(exp.Alternative)
+		if consequence.Name != alternative.Name {
+			return Any
+		}
+		return consequence
+
+	case *ast.ForExpression:
+		c.checkExpression(exp.Iterable)
+		if exp.Key != nil {
+			c.scope.store[exp.Key.Value] = Any
+		}
+		c.scope.store[exp.Value.Value] = Any
+		c.checkBlock(exp.Body)
+		return Null
+
+	case *ast.FunctionLiteral:
+		return c.checkFunctionLiteral(exp)
+
+	case *ast.CallExpression:
+		return c.checkCallExpression(exp)
+
+	case *ast.IndexExpression:
+		c.checkExpression(exp.Left)
+		c.checkExpression(exp.Index)
+		return Any
+
+	case *ast.FieldExpression:
+		c.checkExpression(exp.Left)
+		return Any
+
+	default:
+		return Any
+	}
+}
+
+// checkPrefixExpression checks the operand of a prefix operator
+func (c *Checker) checkPrefixExpression(exp *ast.PrefixExpression) *Type {
+	right := c.checkExpression(exp.Right)
+
+	switch exp.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if !assignable(Int, right) {
+			c.errorf(exp.Token, "invalid operation: -%s", right)
+		}
+		return Int
+	default:
+		return Any
+	}
+}
+
+// checkInfixExpression checks that the operands of an infix operator are of types the operator supports
+func (c *Checker) checkInfixExpression(exp *ast.InfixExpression) *Type {
+	left := c.checkExpression(exp.Left)
+	right := c.checkExpression(exp.Right)
+
+	switch exp.Operator {
+	case "==", "!=", "in":
+		return Bool
+
+	case "<", ">":
+		if !assignable(Int, left) || !assignable(Int, right) {
+			c.errorf(exp.Token, "invalid operation: %s %s %s", left, exp.Operator, right)
+		}
+		return Bool
+
+	case "-", "*", "/":
+		if !assignable(Int, left) || !assignable(Int, right) {
+			c.errorf(exp.Token, "invalid operation: %s %s %s", left, exp.Operator, right)
+		}
+		return Int
+
+	case "+":
+		// integers are added and strings are concatenated
+		switch {
+		case left == Any && right == Any:
+			return Any
+		case left == Any:
+			left = right
+		case right == Any:
+			right = left
+		}
+
+		if left.Name != right.Name || (left != Int && left != String) {
+			c.errorf(exp.Token, "invalid operation: %s + %s", left, right)
+			return Any
+		}
+		return left
+
+	default:
+		return Any
+	}
+}
+
+// checkFunctionLiteral checks the body of a function in a scope of its own, where the parameters
+// are bound to their annotated types. The values the function returns are checked against its return type.
+func (c *Checker) checkFunctionLiteral(fl *ast.FunctionLiteral) *Type {
+	sig := c.signature(fl)
+
+	outerScope, outerReturnType := c.scope, c.returnType
+	c.scope = &scope{store: make(map[string]*Type), outer: outerScope}
+	c.returnType = nil
+	if fl.ReturnType != nil && !fl.IsGenerator {
+		c.returnType = sig.Return
+	}
+
+	for i, p := range fl.Parameters {
+		c.scope.store[p.Value] = sig.Params[i]
+	}
+
+	result := c.checkBlock(fl.Body)
+
+	// the value of the last expression statement is returned as well
+	if c.returnType != nil && !assignable(c.returnType, result) {
+		last := fl.Body.Statements[len(fl.Body.Statements)-1].(*ast.ExpressionStatement)
+		c.errorf(position(last.Expression), "cannot use %s as %s in return", result, c.returnType)
+	}
+
+	c.scope, c.returnType = outerScope, outerReturnType
+
+	return sig
+}
+
+// checkCallExpression checks the arguments of a call against the parameters of the function being called,
+// if its signature is known
+func (c *Checker) checkCallExpression(exp *ast.CallExpression) *Type {
+	fn := c.checkExpression(exp.Function)
+
+	args := make([]*Type, len(exp.Arguments))
+	for i, arg := range exp.Arguments {
+		args[i] = c.checkExpression(arg)
+	}
+
+	if fn == Any {
+		return Any
+	}
+
+	if fn.Name != "fn" {
+		c.errorf(position(exp.Function), "cannot call %s", fn)
+		return Any
+	}
+
+	// a function annotated as "fn" has no known signature
+	if fn.Return == nil {
+		return Any
+	}
+
+	if len(args) != len(fn.Params) {
+		c.errorf(exp.Token, "wrong number of arguments to %s: want=%d, got=%d",
+			exp.Function.String(), len(fn.Params), len(args))
+		return fn.Return
+	}
+
+	for i, arg := range args {
+		if !assignable(fn.Params[i], arg) {
+			c.errorf(position(exp.Arguments[i]), "cannot use %s as %s in argument %d to %s",
+				arg, fn.Params[i], i+1, exp.Function.String())
+		}
+	}
+
+	return fn.Return
+}
+
+// position returns the token where an expression starts in the input
+func position(exp ast.Expression) token.Token {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Token
+	case *ast.IntegerLiteral:
+		return exp.Token
+	case *ast.StringLiteral:
+		return exp.Token
+	case *ast.Boolean:
+		return exp.Token
+	case *ast.PrefixExpression:
+		return exp.Token
+	case *ast.InfixExpression:
+		return position(exp.Left)
+	case *ast.IfExpression:
+		return exp.Token
+	case *ast.ForExpression:
+		return exp.Token
+	case *ast.FunctionLiteral:
+		return exp.Token
+	case *ast.CallExpression:
+		return position(exp.Function)
+	case *ast.ArrayLiteral:
+		return exp.Token
+	case *ast.HashLiteral:
+		return exp.Token
+	case *ast.SetLiteral:
+		return exp.Token
+	case *ast.IndexExpression:
+		return position(exp.Left)
+	case *ast.FieldExpression:
+		return position(exp.Left)
+	default:
+		return token.Token{}
+	}
+}
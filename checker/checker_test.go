@@ -0,0 +1,122 @@
+package checker
+
+import (
+	"testing"
+
+	"github.com/yourfavoritedev/golang-interpreter/ast"
+	"github.com/yourfavoritedev/golang-interpreter/lexer"
+	"github.com/yourfavoritedev/golang-interpreter/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has %d errors: %v", len(p.Errors()), p.Errors())
+	}
+	return program
+}
+
+func TestCheckerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"a" - 1`, []string{"1:5: invalid operation: string - int"}},
+		{`1 + "a"`, []string{"1:3: invalid operation: int + string"}},
+		{`-"a"`, []string{"1:1: invalid operation: -string"}},
+		{`true > 1`, []string{"1:6: invalid operation: bool > int"}},
+		{`let x: int = "a";`, []string{"1:14: cannot use string as int in let x"}},
+		{`let x: string = 1 + 2;`, []string{"1:17: cannot use int as string in let x"}},
+		{`let x: widget = 1;`, []string{"1:8: unknown type widget"}},
+		{
+			`let f = fn(a: int): string { a };`,
+			[]string{"1:30: cannot use int as string in return"},
+		},
+		{
+			`let f = fn(a: int): int { if (a > 1) { return "big"; } a };`,
+			[]string{"1:47: cannot use string as int in return"},
+		},
+		{
+			"let add = fn(a: int, b: int): int { a + b };\nadd(1, \"2\");",
+			[]string{"2:8: cannot use string as int in argument 2 to add"},
+		},
+		{
+			`let add = fn(a: int, b: int): int { a + b }; add(1);`,
+			[]string{"1:49: wrong number of arguments to add: want=2, got=1"},
+		},
+		{
+			`let greet = fn(name: string): string { "hi " + name }; let n: int = greet("x");`,
+			[]string{`1:69: cannot use string as int in let n`},
+		},
+		{
+			`let fact = fn(n: int): int { if (n < 2) { 1 } else { n * fact(n - "1") } };`,
+			[]string{`1:65: invalid operation: int - string`},
+		},
+		{
+			`let s = "a"; let n = 1; s * n; 5();`,
+			[]string{"1:27: invalid operation: string * int", "1:32: cannot call int"},
+		},
+		{
+			`struct Point { x, y }; let p: Point = Point(1, 2); let q: int = p;`,
+			[]string{"1:65: cannot use Point as int in let q"},
+		},
+		{
+			`let f = fn(x: int) { fn(y: string) { x + y } };`,
+			[]string{"1:40: invalid operation: int + string"},
+		},
+	}
+
+	for _, tt := range tests {
+		errors := New().Check(parse(t, tt.input))
+
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of errors. want=%d, got=%d (%v)",
+				tt.input, len(tt.expected), len(errors), errors)
+			continue
+		}
+
+		for i, err := range errors {
+			if err.Error() != tt.expected[i] {
+				t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected[i], err.Error())
+			}
+		}
+	}
+}
+
+func TestCheckerAcceptsValidPrograms(t *testing.T) {
+	tests := []string{
+		`let x = 1; let y: int = x * 2; y - 3`,
+		`let s: string = "a" + "b"; let t = s + "c";`,
+		`let f = fn(a, b) { a + b }; f(1, 2); f("a", "b");`,
+		`let f: fn = fn(a: int): int { a }; let n: int = f(1);`,
+		`let xs: array = [1, 2]; let h: hash = {"a": 1}; let s: set = {1, 2}; xs[0] + h["a"]`,
+		`let fact = fn(n: int): int { if (n < 2) { return 1; } n * fact(n - 1) };`,
+		`let gen = fn(): int { yield 1; }; let g: generator = gen();`,
+		`let total = len([1, 2]) + 1; let c: channel = spawn(fn() { 1 });`,
+		`for (x in [1, 2]) { puts(x + 1) }`,
+		`let b: bool = 1 in {1} == true;`,
+		`struct Point { x, y }; let p: Point = Point(1, 2); p.x + 1`,
+	}
+
+	for _, input := range tests {
+		errors := New().Check(parse(t, input))
+		if len(errors) != 0 {
+			t.Errorf("%q: unexpected errors: %v", input, errors)
+		}
+	}
+}
+
+func TestCheckerKeepsBindingsBetweenChecks(t *testing.T) {
+	c := New()
+
+	if errors := c.Check(parse(t, `let name: string = "monkey";`)); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	errors := c.Check(parse(t, `name - 1`))
+	if len(errors) != 1 || errors[0].Error() != "1:6: invalid operation: string - int" {
+		t.Fatalf("wrong errors. got=%v", errors)
+	}
+}
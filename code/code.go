@@ -106,6 +106,14 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpTailCall
+	OpYield
+	OpGetField
+	OpIter
+	OpIterNext
+	OpSet
+	OpIn
+	OpGetFieldIndex
 )
 
 // Definition helps us understand Opcode defintions. A Definition
@@ -151,12 +159,24 @@ var definitions = map[Opcode]*Definition{
 	OpReturn:        {"OpReturn", []int{}},         //OpReturn does not have any operands
 	OpSetLocal:      {"OpSetLocal", []int{1}},      //OpSetLocal has one one-byte operand. The operand refers to the unique index of a local binding
 	OpGetLocal:      {"OpGetLocal", []int{1}},      //OpGetLocal has one one-byte operand. The operand refers to the unique index of a local binding
-	OpGetBuiltin:    {"OpGetBuiltin", []int{1}},    //OpGetBuiltin has one one-byte operand. The operand refers to the unique index of the BuiltIn function in object.Builtins.
+	OpGetBuiltin:    {"OpGetBuiltin", []int{2}},    //OpGetBuiltin has one two-byte operand. The operand refers to the unique index of the BuiltIn function in its object.BuiltinSet.
 	OpClosure:       {"OpClosure", []int{2, 1}},    /**OpClosure has two operands. The first operand is two-bytes wide and refers to the
 	index of the object.CompiledFunction in the constants pool. The second operand is one-byte wide and specifies how many free variables sit on the stack and need to
 	be transferred to the about-to-be-created closure **/
 	OpGetFree:        {"OpGetFree", []int{1}},       //OpGetFree has one one-byte operand. The operand refers to the unique index of a free variable.
 	OpCurrentClosure: {"OpCurrentClosure", []int{}}, //OpCurrentClosure does not have any operands
+	OpTailCall:       {"OpTailCall", []int{1}},      //OpTailCall has one one-byte operand. The operand refers to the number of arguments of the calling function.
+	OpYield:          {"OpYield", []int{}},          //OpYield does not have any operands
+	OpGetField:       {"OpGetField", []int{2}},      //OpGetField has one two-byte operand. The operand refers to the index of the field name in the constants pool.
+	OpIter:           {"OpIter", []int{}},           //OpIter does not have any operands
+	OpIterNext:       {"OpIterNext", []int{2, 1}},   /**OpIterNext has two operands. The first operand is two-bytes wide and refers to the
+	position to jump to once the iterator is exhausted. The second operand is one-byte wide and specifies whether only the value (1)
+	or the key and the value (2) of the next element are pushed on to the stack **/
+	OpSet:           {"OpSet", []int{2}},              //OpSet has one two-byte operand. The operand is the number of elements in a set literal.
+	OpIn:            {"OpIn", []int{}},                //OpIn does not have any operands
+	OpGetFieldIndex: {"OpGetFieldIndex", []int{2, 2}}, /**OpGetFieldIndex has two two-byte operands. The first operand refers to the
+	index of the object.StructType the compiler expects the accessed value to have in the constants pool. The second operand is the
+	position of the field in the layout of that struct type **/
 }
 
 // Lookup simply finds the definition of the provided op (Opcode)
@@ -90,6 +90,7 @@ func TestReadOperands(t *testing.T) {
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpGetFieldIndex, []int{65535, 1}, 4},
 	}
 
 	for _, tt := range tests {
@@ -112,3 +113,34 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestPositionsLookup(t *testing.T) {
+	positions := Positions{
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 3, Line: 1, Column: 5},
+		{Offset: 7, Line: 2, Column: 3},
+	}
+
+	tests := []struct {
+		offset       int
+		line, column int
+	}{
+		{0, 1, 1},
+		{2, 1, 1},
+		{3, 1, 5},
+		{6, 1, 5},
+		{7, 2, 3},
+		{100, 2, 3},
+	}
+
+	for _, tt := range tests {
+		line, column := positions.Lookup(tt.offset)
+		if line != tt.line || column != tt.column {
+			t.Errorf("wrong position for offset %d. want=%d:%d, got=%d:%d", tt.offset, tt.line, tt.column, line, column)
+		}
+	}
+
+	if line, column := (Positions{}).Lookup(0); line != 0 || column != 0 {
+		t.Errorf("expected unknown position. got=%d:%d", line, column)
+	}
+}
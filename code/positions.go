@@ -0,0 +1,25 @@
+package code
+
+import "sort"
+
+// Position records where in the source the instructions starting at Offset were compiled from.
+// Line and Column are the position of the token of the expression, both start at 1.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Positions maps the instructions of a function to the source they were compiled from,
+// it is ordered by Offset. An instruction belongs to the last Position at or before its offset.
+type Positions []Position
+
+// Lookup returns the line and column of the source of the instruction at offset,
+// they are 0 if the position of the instruction is unknown
+func (ps Positions) Lookup(offset int) (int, int) {
+	i := sort.Search(len(ps), func(i int) bool { return ps[i].Offset > offset })
+	if i == 0 {
+		return 0, 0
+	}
+	return ps[i-1].Line, ps[i-1].Column
+}
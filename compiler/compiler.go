@@ -2,11 +2,11 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
 
 	"github.com/yourfavoritedev/golang-interpreter/ast"
 	"github.com/yourfavoritedev/golang-interpreter/code"
 	"github.com/yourfavoritedev/golang-interpreter/object"
+	"github.com/yourfavoritedev/golang-interpreter/token"
 )
 
 // Compiler will create Bytecode for the VM to execute.
@@ -16,11 +16,19 @@ import (
 // symbolTable keeps track of the identifiers observed by the compiler.
 // scopes is a stack used to keep record of unique scopes as their instructions are being compiled
 // scopeIndex refers to the current scope being compiled
+// position is the token of the innermost node being compiled, the emitted instructions are mapped to it
+// fieldNames maps the field names accessed by the program to their constant, each name is added once.
+// structTypes maps the symbols bound by struct declarations to the constant of their StructType and
+// structValues the symbols bound to a constructed struct to the constant of its StructType.
 type Compiler struct {
-	constants   []object.Object
-	symbolTable *SymbolTable
-	scopes      []CompilationScope
-	scopeIndex  int
+	constants    []object.Object
+	symbolTable  *SymbolTable
+	scopes       []CompilationScope
+	scopeIndex   int
+	position     token.Token
+	fieldNames   map[string]int
+	structTypes  map[Symbol]int
+	structValues map[Symbol]int
 }
 
 // EmittedInstruction is the struct that describes an instruction that was
@@ -36,14 +44,22 @@ type EmittedInstruction struct {
 // they don't become entangled in the parent/global scope.
 // LastInstruction is the most recent instruction that was emitted in this scope.
 // PreviousInstruction is the one before that.
+// Positions maps the instructions to the source they were compiled from.
 type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	positions           code.Positions
 }
 
-// New simply initializes a new Compiler
+// New simply initializes a new Compiler with the default builtin functions (see object.DefaultBuiltins)
 func New() *Compiler {
+	return NewWithBuiltins(object.DefaultBuiltins())
+}
+
+// NewWithBuiltins initializes a new Compiler whose programs can use the builtin functions of the given set.
+// The set is passed on to the VM along with the Bytecode.
+func NewWithBuiltins(builtins *object.BuiltinSet) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
@@ -51,16 +67,16 @@ func New() *Compiler {
 	}
 
 	// initialize symbol table with built-in functions
-	symbolTable := NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	symbolTable := NewSymbolTableWithBuiltins(builtins)
 
 	return &Compiler{
-		constants:   []object.Object{},
-		symbolTable: symbolTable,
-		scopes:      []CompilationScope{mainScope},
-		scopeIndex:  0,
+		constants:    []object.Object{},
+		symbolTable:  symbolTable,
+		scopes:       []CompilationScope{mainScope},
+		scopeIndex:   0,
+		fieldNames:   make(map[string]int),
+		structTypes:  make(map[Symbol]int),
+		structValues: make(map[Symbol]int),
 	}
 }
 
@@ -75,6 +91,13 @@ func (c *Compiler) currentInstructions() code.Instructions {
 // to be added to the constants pool, and builds the necessary instructions
 // for the VM to execute.
 func (c *Compiler) Compile(node ast.Node) error {
+	// the instructions emitted for the node are mapped to its token, until a nested node takes over
+	if tok, ok := nodeToken(node); ok {
+		outer := c.position
+		c.position = tok
+		defer func() { c.position = outer }()
+	}
+
 	switch node := node.(type) {
 	// our starting point
 	case *ast.Program:
@@ -138,8 +161,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
+		case "in":
+			c.emit(code.OpIn)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return c.errorf("unknown operator %s", node.Operator)
 		}
 
 	// compile prefix expression - work our way down to the literals
@@ -154,7 +179,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "!":
 			c.emit(code.OpBang)
 		default:
-			return fmt.Errorf("unknown operator: %s", node.Operator)
+			return c.errorf("unknown operator: %s", node.Operator)
 		}
 
 	// compile an if expression - work our way down conditions and block statements
@@ -229,6 +254,45 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// replace code.OpJump's operand with the new position, the position after the alternative or OpNull instruction (afterAlternativePos)
 		c.changeOperand(jumpPos, afterAlternativePos)
 
+	// compile a for-in loop. The iterable is replaced by an iterator (OpIter) that stays on the stack
+	// for the duration of the loop. Every iteration starts with an OpIterNext instruction which pushes
+	// the next element, or pops the iterator and jumps past the loop once it is exhausted.
+	// The loop itself evaluates to null, so it can be used as an expression like an if-expression.
+	case *ast.ForExpression:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIter)
+
+		// push only the value or the key and the value, depending on the number of loop variables
+		numValues := 1
+		if node.Key != nil {
+			numValues = 2
+		}
+		// Emit an 'OpIterNext' with a bogus jump position to be backpatched after the body is compiled
+		iterNextPos := c.emit(code.OpIterNext, 9999, numValues)
+
+		// the value sits on top of the stack, above the key
+		c.setSymbol(c.symbolTable.Define(node.Value.Value))
+		if node.Key != nil {
+			c.setSymbol(c.symbolTable.Define(node.Key.Value))
+		}
+
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		// go back to fetch the next element
+		c.emit(code.OpJump, iterNextPos)
+
+		afterBodyPos := len(c.currentInstructions())
+		c.replaceInstruction(iterNextPos, code.Make(code.OpIterNext, afterBodyPos, numValues))
+
+		c.emit(code.OpNull)
+
 	// compile a block statement
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
@@ -240,12 +304,26 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 	// compile a let statement and update the symbolTable
 	case *ast.LetStatement:
-		// define the identifier in the symbol table
-		symbol := c.symbolTable.Define(node.Name.Value)
+		// a function literal may refer to itself, so its name is defined before the value is compiled.
+		// Any other value is compiled first, a reference to the name in it reads the previous binding.
+		var symbol Symbol
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		if isFunction {
+			symbol = c.symbolTable.Redefine(node.Name.Value)
+		}
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
+		if !isFunction {
+			symbol = c.symbolTable.Redefine(node.Name.Value)
+		}
+		delete(c.structTypes, symbol)
+		if structConst, ok := c.staticStructType(node.Value); ok {
+			c.structValues[symbol] = structConst
+		} else {
+			delete(c.structValues, symbol)
+		}
 		// the symbol for that identifier now has an index, which we use as an operand
 		// to construct the instruction
 		if symbol.Scope == GlobalScope {
@@ -260,7 +338,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// grab the identiier from the symbol table
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable: %s", node.Value)
+			return c.errorf("undefined variable: %s", node.Value)
 		}
 
 		// construct an instruction with the symbol's index as the operand
@@ -282,17 +360,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 	// compile a hash literal, it should construct an OpHash instruction with the operand
 	// being the combined number of keys and values in the hash
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		// get keys from hash
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-
-		// sort keys in descending/increasing order to guarantee a consistent order before we compile them
-		// our tests assert that the instructions are generated in a specific order
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
+		// the keys are compiled in the order they appear in the source,
+		// so the hash keeps them in that order
+		keys := node.Keys
 
 		// build Opcode instructions for keys and their values which should lead to a series
 		// of OpConstants if the hash is not empty
@@ -309,6 +379,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpHash, len(node.Pairs)*2)
 
+	// compile a set literal, it should construct an OpSet instruction with the operand
+	// being the number of elements in the set.
+	case *ast.SetLiteral:
+		for _, e := range node.Elements {
+			err := c.Compile(e)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSet, len(node.Elements))
+
 	// compile an index expression. it should simply compile the object being indexed and then the index itself,
 	// then finally emit an OpIndex instruction.
 	case *ast.IndexExpression:
@@ -324,6 +406,46 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpIndex)
 
+	// compile a field access expression. If the struct type of the accessed value is known, the
+	// field is read from its position in the layout of that type with an OpGetFieldIndex instruction.
+	// Otherwise the field name is added to the constants pool and its index is used as the operand
+	// of the OpGetField instruction.
+	case *ast.FieldExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		if structConst, ok := c.staticStructType(node.Left); ok {
+			structType := c.constants[structConst].(*object.StructType)
+			if index, ok := structType.FieldIndex(node.Field.Value); ok {
+				c.emit(code.OpGetFieldIndex, structConst, index)
+				break
+			}
+		}
+		c.emit(code.OpGetField, c.fieldNameConstant(node.Field.Value))
+
+	// compile a struct declaration. The struct type is a constant that is bound
+	// to the name of the struct, just like a let statement would.
+	case *ast.StructStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+
+		fields := make([]string, len(node.Fields))
+		for i, f := range node.Fields {
+			fields[i] = f.Value
+		}
+		structType := object.NewStructType(node.Name.Value, fields)
+		structConst := c.addConstant(structType)
+		c.emit(code.OpConstant, structConst)
+		c.structTypes[symbol] = structConst
+		delete(c.structValues, symbol)
+
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
 	// compile a function literal. It should create a unique scope for the function and compile its body into
 	// instructions, use those instructions to build a object.CompiledFunction, push that object to the
 	// constants pool and finally emit an OpClosure instruction for the function literal.
@@ -358,8 +480,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpReturn)
 		}
 
+		// calls whose result is immediately returned can reuse the caller's frame in the VM
+		c.markTailCalls()
+
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		positions := c.scopes[c.scopeIndex].positions
 		instructions := c.leaveScope()
 
 		// Before leaving the inner-function's scope, we stored its free-variables in freeSymbols.
@@ -376,6 +502,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			IsGenerator:   node.IsGenerator,
+			Positions:     positions,
 		}
 
 		// add the compiledFn into the constants pool and use its index as the first operand
@@ -391,6 +519,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpReturnValue)
 
+	// compile a yield statement, it should emit an OpYield instruction which suspends
+	// the generator with the value of the expression
+	case *ast.YieldStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpYield)
+
 	// compile a call expression
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
@@ -438,6 +576,46 @@ func (c *Compiler) addConstant(obj object.Object) int {
 	return len(c.constants) - 1
 }
 
+// fieldNameConstant returns the index of the constant holding the field name, the accesses
+// to the same field share the constant
+func (c *Compiler) fieldNameConstant(name string) int {
+	if index, ok := c.fieldNames[name]; ok {
+		return index
+	}
+
+	index := c.addConstant(&object.String{Value: name})
+	c.fieldNames[name] = index
+	return index
+}
+
+// staticStructType returns the constant of the StructType of the struct that node evaluates to, if the compiler
+// knows it: node calls the name of a struct declaration or reads a name bound to such a call. This is a guess,
+// a loop may rebind the name before the node runs again, so the VM checks the type of the struct it reads.
+func (c *Compiler) staticStructType(node ast.Expression) (int, bool) {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		ident, ok := node.Function.(*ast.Identifier)
+		if !ok {
+			return 0, false
+		}
+		symbol, ok := c.symbolTable.Resolve(ident.Value)
+		if !ok {
+			return 0, false
+		}
+		structConst, ok := c.structTypes[symbol]
+		return structConst, ok
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return 0, false
+		}
+		structConst, ok := c.structValues[symbol]
+		return structConst, ok
+	default:
+		return 0, false
+	}
+}
+
 // emit generates an instruction for the compiler using the given params
 // and then returns the starting position of the new instruction. The Compiler
 // will keep track of the instruction it last emitted.
@@ -457,10 +635,89 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
 	c.scopes[c.scopeIndex].instructions = updatedInstructions
+	c.addPosition(posNewInstruction)
 
 	return posNewInstruction
 }
 
+// addPosition maps the instruction at offset to the current position in the source,
+// unless the previous instructions are already mapped to it
+func (c *Compiler) addPosition(offset int) {
+	if c.position.Line == 0 {
+		return
+	}
+
+	positions := c.scopes[c.scopeIndex].positions
+	if n := len(positions); n > 0 && positions[n-1].Line == c.position.Line && positions[n-1].Column == c.position.Column {
+		return
+	}
+
+	c.scopes[c.scopeIndex].positions = append(positions, code.Position{
+		Offset: offset,
+		Line:   c.position.Line,
+		Column: c.position.Column,
+	})
+}
+
+// Error is an error the Compiler ran into, along with the position in the source where it was found
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error returns the message of the Error prefixed with its position (line:column: message)
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// errorf returns a new Error at the position of the node being compiled
+func (c *Compiler) errorf(format string, args ...interface{}) error {
+	return &Error{
+		Line:    c.position.Line,
+		Column:  c.position.Column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// nodeToken returns the token the instructions of node are mapped to, if node can run into an error at runtime
+func nodeToken(node ast.Node) (token.Token, bool) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token, true
+	case *ast.ReturnStatement:
+		return node.Token, true
+	case *ast.YieldStatement:
+		return node.Token, true
+	case *ast.ExpressionStatement:
+		return node.Token, true
+	case *ast.StructStatement:
+		return node.Token, true
+	case *ast.Identifier:
+		return node.Token, true
+	case *ast.PrefixExpression:
+		return node.Token, true
+	case *ast.InfixExpression:
+		return node.Token, true
+	case *ast.IfExpression:
+		return node.Token, true
+	case *ast.ForExpression:
+		return node.Token, true
+	case *ast.CallExpression:
+		return node.Token, true
+	case *ast.IndexExpression:
+		return node.Token, true
+	case *ast.FieldExpression:
+		return node.Token, true
+	case *ast.HashLiteral:
+		return node.Token, true
+	case *ast.SetLiteral:
+		return node.Token, true
+	default:
+		return token.Token{}, false
+	}
+}
+
 // setLastInstruction helps the compiler keep track of the instructions that
 // it has emitted. When a new instruction is emitted, the lastInstructon recorded
 // will become the previousInstruction and the new instruction will
@@ -491,6 +748,13 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	// forget the positions of the removed instruction
+	positions := c.scopes[c.scopeIndex].positions
+	for len(positions) > 0 && positions[len(positions)-1].Offset >= last.Position {
+		positions = positions[:len(positions)-1]
+	}
+	c.scopes[c.scopeIndex].positions = positions
 }
 
 // replaceInstruction will replace an instruction starting at the absolute offset (pos)
@@ -511,6 +775,49 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+// markTailCalls rewrites every OpCall in the current scope that is in tail position into an OpTailCall.
+// A call is in tail position when its result is returned right away, that is the next instruction
+// is an OpReturnValue or an OpJump that lands on one (the consequence of an if-expression jumps
+// over the alternative to the OpReturnValue that ends the function body). Both opcodes have the
+// same operand width, so the instruction can be swapped in place.
+func (c *Compiler) markTailCalls() {
+	ins := c.currentInstructions()
+
+	i := 0
+	for i < len(ins) {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+
+		_, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+
+		if code.Opcode(ins[i]) == code.OpCall && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+
+		i = next
+	}
+}
+
+// returnsAt reports whether executing the instructions from pos onwards leads straight to an
+// OpReturnValue, following any OpJump instructions on the way.
+func returnsAt(ins code.Instructions, pos int) bool {
+	for pos < len(ins) {
+		switch code.Opcode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			pos = int(code.ReadUint16(ins[pos+1:]))
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
 // NewWithState keeps global state in the REPL so the compiler can continue
 // to run with the generated bytecode from a previous compilation.
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
@@ -558,6 +865,15 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+// setSymbol emits the instruction that pops the top of the stack into the binding of the symbol
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
 // loadSymbol uses the scope of the given Symbol to determine what Opcode instruction to emit
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
@@ -580,13 +896,19 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Builtins:     c.symbolTable.Builtins(),
 	}
 }
 
 // Bytecode is the struct for the representation of bytecode that
 // will be passed to the VM. The Compiler will generate the Instructions
-// and the Constants that were evaluated.
+// and the Constants that were evaluated. Positions maps the Instructions
+// to the source they were compiled from. Builtins is the set of builtin functions the
+// instructions refer to, the VM uses the default builtins when it is nil.
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Positions    code.Positions
+	Builtins     *object.BuiltinSet
 }
@@ -189,6 +189,17 @@ func testConstants(
 				return fmt.Errorf("constant %d - testInstructions failed: %s",
 					i, err)
 			}
+		case *object.StructType:
+			st, ok := actual[i].(*object.StructType)
+			if !ok {
+				return fmt.Errorf("constant %d - not a struct type: %T",
+					i, actual[i])
+			}
+
+			if st.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong struct type. want=%q, got=%q",
+					i, constant.Inspect(), st.Inspect())
+			}
 		}
 	}
 
@@ -454,6 +465,21 @@ func TestGlobalLetStatements(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input: `
+			let one = 1;
+			let one = one + 1;
+			`,
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -567,6 +593,21 @@ func TestHashLiterals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			// keys are compiled in the order they appear in the source
+			input:             "{5: 6, 1: 2, 3: 4}",
+			expectedConstants: []interface{}{5, 6, 1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpHash, 6),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -986,7 +1027,7 @@ func TestBuiltins(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpGetBuiltin, 0),
 					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -1224,7 +1265,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -1253,7 +1294,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 				1,
@@ -1262,7 +1303,7 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpTailCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
@@ -1277,3 +1318,467 @@ func TestRecursiveFunctions(t *testing.T) {
 	}
 	runCompilerTests(t, tests)
 }
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let countDown = fn(x) { return countDown(x - 1); };
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `
+			let countDown = fn(x) { if (x) { countDown(x - 1) } else { countDown(0) } };
+			`,
+			expectedConstants: []interface{}{
+				1,
+				0,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 17),
+					// 0005
+					code.Make(code.OpCurrentClosure),
+					// 0006
+					code.Make(code.OpGetLocal, 0),
+					// 0008
+					code.Make(code.OpConstant, 0),
+					// 0011
+					code.Make(code.OpSub),
+					// 0012
+					code.Make(code.OpTailCall, 1),
+					// 0014
+					code.Make(code.OpJump, 23),
+					// 0017
+					code.Make(code.OpCurrentClosure),
+					// 0018
+					code.Make(code.OpConstant, 1),
+					// 0021
+					code.Make(code.OpTailCall, 1),
+					// 0023
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			input: `
+			let sum = fn(x) { sum(x) + 1; };
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	input := `fn() { yield 1; yield 2; }`
+
+	program := parse(input)
+
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	err = testConstants(t, []interface{}{
+		1,
+		2,
+		[]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpYield),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpYield),
+			code.Make(code.OpReturn),
+		},
+	}, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	fn := bytecode.Constants[2].(*object.CompiledFunction)
+	if !fn.IsGenerator {
+		t.Fatalf("compiled function is not a generator")
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	// spawn is a builtin function, the last one of object.Builtins
+	spawn := len(object.Builtins) - 1
+
+	tests := []compilerTestCase{
+		{
+			input: `spawn(fn(a) { a }, 1);`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, spawn),
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let spawn = fn(a) { a }; spawn(1);`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `struct Point { x, y }; Point(1, 2).y;`,
+			expectedConstants: []interface{}{
+				object.NewStructType("Point", []string{"x", "y"}),
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpGetFieldIndex, 0, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `struct Point { x, y }; let p = Point(1, 2); p.x + p.y;`,
+			expectedConstants: []interface{}{
+				object.NewStructType("Point", []string{"x", "y"}),
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetFieldIndex, 0, 0),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetFieldIndex, 0, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `struct Point { x, y }; let p = Point(1, 2); p.z;`,
+			expectedConstants: []interface{}{
+				object.NewStructType("Point", []string{"x", "y"}),
+				1,
+				2,
+				"z",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpGetField, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let p = 1; p.x + p.y + p.x;`,
+			expectedConstants: []interface{}{
+				1,
+				"x",
+				"y",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetField, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetField, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpGetField, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { struct Pair { a, b }; Pair }`,
+			expectedConstants: []interface{}{
+				object.NewStructType("Pair", []string{"a", "b"}),
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `for (x in [1]) { x }`,
+			expectedConstants: []interface{}{
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpIterNext, 21, 1),
+				// 0011
+				code.Make(code.OpSetGlobal, 0),
+				// 0014
+				code.Make(code.OpGetGlobal, 0),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpJump, 7),
+				// 0021
+				code.Make(code.OpNull),
+				// 0022
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(h) { for (k, v in h) { v } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpIter),
+					// 0003
+					code.Make(code.OpIterNext, 17, 2),
+					// 0007
+					code.Make(code.OpSetLocal, 1),
+					// 0009
+					code.Make(code.OpSetLocal, 2),
+					// 0011
+					code.Make(code.OpGetLocal, 1),
+					// 0013
+					code.Make(code.OpPop),
+					// 0014
+					code.Make(code.OpJump, 3),
+					// 0017
+					code.Make(code.OpNull),
+					// 0018
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSetLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{1, 2, 3}",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSet, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 in {1}",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSet, 1),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestPositions(t *testing.T) {
+	input := "let x = 1;\nx +\n  x;\nlet f = fn() {\n  x * x\n};"
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	line, column := bytecode.Positions.Lookup(opcodeOffset(t, bytecode.Instructions, code.OpAdd))
+	if line != 2 || column != 3 {
+		t.Errorf("wrong position of OpAdd. want=2:3, got=%d:%d", line, column)
+	}
+
+	fn := bytecode.Constants[1].(*object.CompiledFunction)
+	line, column = fn.Positions.Lookup(opcodeOffset(t, fn.Instructions, code.OpMul))
+	if line != 5 || column != 5 {
+		t.Errorf("wrong position of OpMul. want=5:5, got=%d:%d", line, column)
+	}
+}
+
+func TestCompilerErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nx + y", "2:5: undefined variable: y"},
+		{"fn() {\n  missing(1)\n}", "2:3: undefined variable: missing"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("%q: expected compiler error, got none", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+// opcodeOffset returns the offset of the first op instruction in ins
+func opcodeOffset(t *testing.T, ins code.Instructions, op code.Opcode) int {
+	t.Helper()
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			t.Fatalf("lookup failed: %s", err)
+		}
+		if code.Opcode(ins[i]) == op {
+			return i
+		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+	}
+
+	t.Fatalf("instruction %d not found", op)
+	return -1
+}
+
+func TestCustomBuiltins(t *testing.T) {
+	builtins := object.NewBuiltinSet()
+	// identifiers cannot hold digits, the builtins are named a, b, ..., z, ba, bb, ...
+	for i := 0; i < 300; i++ {
+		name := ""
+		for n := i; ; n /= 26 {
+			name = string(rune('a'+n%26)) + name
+			if n < 26 {
+				break
+			}
+		}
+		builtins.Define(name, &object.Builtin{})
+	}
+
+	comp := NewWithBuiltins(builtins)
+	if err := comp.Compile(parse(`ln`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	err := testInstructions([]code.Instructions{
+		code.Make(code.OpGetBuiltin, 299),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	if bytecode.Builtins != builtins {
+		t.Errorf("the bytecode does not refer to the builtins it was compiled with")
+	}
+
+	if err := NewWithBuiltins(builtins).Compile(parse(`puts`)); err == nil {
+		t.Errorf("puts should not be defined")
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "github.com/yourfavoritedev/golang-interpreter/object"
+
 // SymbolScope is the unique scope a symbol belongs to
 type SymbolScope string
 
@@ -27,11 +29,13 @@ type Symbol struct {
 // numDefinitions simply refers to the total number of unique definitions in the store.
 // Outer points to the SymbolTable that encloses the current one.
 // FreeSymbols refers to the free-variables defined in the Symbol Tables enclosing scopes (if any).
+// builtins is the set of builtin functions the BuiltinScope symbols refer to, it is only set on the outermost table.
 type SymbolTable struct {
 	Outer          *SymbolTable
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+	builtins       *object.BuiltinSet
 }
 
 // NewSymbolTable creates a new SymbolTable with an empty store
@@ -41,6 +45,45 @@ func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{store: s, FreeSymbols: free}
 }
 
+// NewSymbolTableWithBuiltins creates a new SymbolTable defining the builtin functions of the given set.
+// The programs compiled with it must run with the same set (see Builtins).
+func NewSymbolTableWithBuiltins(builtins *object.BuiltinSet) *SymbolTable {
+	st := NewSymbolTable()
+	st.builtins = builtins
+	for i, name := range builtins.Names() {
+		if name != "" {
+			st.DefineBuiltin(i, name)
+		}
+	}
+	return st
+}
+
+// Copy returns a copy of the SymbolTable, defining symbols in one of them does not affect the other.
+// The copy shares the enclosing tables and the set of builtin functions of st.
+func (st *SymbolTable) Copy() *SymbolTable {
+	store := make(map[string]Symbol, len(st.store))
+	for name, symbol := range st.store {
+		store[name] = symbol
+	}
+
+	return &SymbolTable{
+		Outer:          st.Outer,
+		store:          store,
+		numDefinitions: st.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, st.FreeSymbols...),
+		builtins:       st.builtins,
+	}
+}
+
+// Builtins returns the set of builtin functions the outermost SymbolTable was created with,
+// it is nil if the builtins were defined one by one with DefineBuiltin.
+func (st *SymbolTable) Builtins() *object.BuiltinSet {
+	for st.Outer != nil {
+		st = st.Outer
+	}
+	return st.builtins
+}
+
 // Define sets an identifier/symbol association in the SymbolTable's store.
 // Upon setting an association, we increment the number of definitions. A new
 // Symbol is constructed for the given identifier and its Index is set to
@@ -59,8 +102,18 @@ func (st *SymbolTable) Define(name string) Symbol {
 	return symbol
 }
 
+// Redefine returns the symbol a let statement binds name to. A name already defined in this
+// SymbolTable keeps its index, like the evaluator a let statement in a loop then updates the
+// binding that the next iteration reads. Any other name is defined as a new symbol.
+func (st *SymbolTable) Redefine(name string) Symbol {
+	if symbol, ok := st.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+	return st.Define(name)
+}
+
 // DefineBuiltin sets an identifier/symbol association for a builtin function in the SymbolTable's store.
-// It uses the index of the builtin function in Builtins and its name to create a new symbol with the BuiltinScope
+// It uses the index of the builtin function in its BuiltinSet and its name to create a new symbol with the BuiltinScope
 func (st *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	st.store[name] = symbol
@@ -4,12 +4,15 @@ import (
 	"github.com/yourfavoritedev/golang-interpreter/object"
 )
 
-// builtins is a dictionary that keeps track of built-in functions
-var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltInByName("len"),
-	"first": object.GetBuiltInByName("first"),
-	"last":  object.GetBuiltInByName("last"),
-	"rest":  object.GetBuiltInByName("rest"),
-	"push":  object.GetBuiltInByName("push"),
-	"puts":  object.GetBuiltInByName("puts"),
+// defaultBuiltins are the built-in functions of the environments that were not created with a set of their own
+// (see object.NewEnvironmentWithBuiltins). It is built from object.Builtins, so every builtin is available to both engines.
+var defaultBuiltins = object.DefaultBuiltins()
+
+// lookupBuiltin finds the built-in function with the given name in the builtins of env
+func lookupBuiltin(env *object.Environment, name string) (*object.Builtin, bool) {
+	builtins := env.Builtins()
+	if builtins == nil {
+		builtins = defaultBuiltins
+	}
+	return builtins.Lookup(name)
 }
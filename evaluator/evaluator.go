@@ -1,19 +1,24 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/yourfavoritedev/golang-interpreter/ast"
 	"github.com/yourfavoritedev/golang-interpreter/object"
 )
 
+// MaxCallDepth is the number of nested function calls the evaluator allows,
+// a deeper call is a stack overflow instead of exhausting the stack of the goroutine.
+const MaxCallDepth = 10000
+
 var (
 	// null can be referenced instead of allocating a new object each time we evaluate a node.
-	NULL = &object.Null{}
+	NULL = object.NULL
 	// there will only ever be two variations of object.Booleans,
 	// it is more beneficial to reference them instead of allocating new ones.
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 // Eval accepts an AST Node and determines the best way to evaluate it.
@@ -24,6 +29,13 @@ var (
 // evaluating its own nodes. This will lead to evaluating the actual Expression Nodes,
 // where the Value of the node can be consumed and stored in an Object.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	// every node is a step of the evaluation, the evaluation stops once the limits are exceeded
+	if limits := env.Limits(); limits != nil {
+		if err := limits.Step(); err != nil {
+			return newError("%s", err)
+		}
+	}
+
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
@@ -44,6 +56,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.YieldStatement:
+		// evaluate the expression associated with the yield statement and hand the value
+		// to the generator, which suspends the evaluation until it is resumed
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if err := env.Yield(val); err != nil {
+			return err
+		}
 	case *ast.LetStatement:
 		// first we need to evaluate the expression of the LetStatement
 		val := Eval(node.Value, env)
@@ -52,6 +74,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		// set the identifier name and the evaluated value to the environment
 		env.Set(node.Name.Value, val)
+	case *ast.StructStatement:
+		// bind the struct type to its name, the struct type serves as the constructor of the struct
+		fields := make([]string, len(node.Fields))
+		for i, f := range node.Fields {
+			fields[i] = f.Value
+		}
+		env.Set(node.Name.Value, object.NewStructType(node.Name.Value, fields))
 
 	// Expressions
 	case *ast.PrefixExpression:
@@ -76,6 +105,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
+		// a concatenated string is accounted before it is built
+		if l, ok := left.(*object.String); ok && node.Operator == "+" {
+			if r, ok := right.(*object.String); ok {
+				if err := allocate(env, int64(len(l.Value)+len(r.Value))); err != nil {
+					return err
+				}
+			}
+		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
 		// evaluate if expression
@@ -96,7 +133,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return allocated(env, object.NewArray(elements))
 	case *ast.IndexExpression:
 		// Evaluate the index operator expression. First evaluate the object being operated on, it
 		// can take the form of any expression. Then evaluate the index which is also an expression.
@@ -109,9 +146,30 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.ForExpression:
+		// Evaluate the collection being walked, then evaluate the body for each of its elements
+		iterable := Eval(node.Iterable, env)
+		if isError(iterable) {
+			return iterable
+		}
+		return evalForExpression(node, iterable, env)
+	case *ast.FieldExpression:
+		// Evaluate the struct being accessed, then look up the value of its field
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalFieldExpression(left, node.Field.Value)
 	case *ast.HashLiteral:
 		// Simply evaluates a hash literal
-		return evalHashLiteral(node, env)
+		return allocated(env, evalHashLiteral(node, env))
+	case *ast.SetLiteral:
+		// Evaluate the elements of the set literal, then build the set
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return allocated(env, object.NewSet(elements))
 
 	// Identifiers
 	case *ast.Identifier:
@@ -125,7 +183,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// they will be evaluated during function calls
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Body: body, Env: env, IsGenerator: node.IsGenerator}
 	case *ast.CallExpression:
 		// Evaluate the call expression, simply getting back the function we want to call,
 		// it can be the form of an ast.Identifier or an ast.FunctionLiteral, it still
@@ -143,35 +201,172 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 
 		// call the function!
-		return applyFunction(function, args)
+		return applyFunction(function, args, env)
 	}
 
 	return nil
 }
 
+// EvalContext evaluates node like Eval, but stops the evaluation once ctx is done. The error returned
+// then is ctx.Err(), the errors the program runs into are returned as object.Error values like Eval does.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) (object.Object, error) {
+	return EvalWithLimits(node, env, object.NewLimits(ctx, 0))
+}
+
+// EvalWithLimits evaluates node like Eval, but stops the evaluation once it exceeds limits (a node is
+// a step). The error returned then is object.ErrStepLimit, object.ErrMemoryLimit or the error of the context
+// of limits. The calls nested deeper than MaxCallDepth return a stack overflow error, with or without limits. The limits
+// are set on env for the time of the evaluation (see object.Environment.SetLimits). The functions started with spawn
+// are bound by them as well, including the ones still running once EvalWithLimits returned, and so are the
+// generators resumed by the evaluation.
+func EvalWithLimits(node ast.Node, env *object.Environment, limits *object.Limits) (object.Object, error) {
+	env.SetLimits(limits)
+	defer env.SetLimits(nil)
+
+	result := Eval(node, env)
+	if err := limits.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // applyFunction accepts an already evaluated function and evaluated arguments.
 // If fn is of type object.Function, it will bind the function and arguments to a new inner environment then evaluate it.
 // If fn is type object.Builtin, it will call the built-in function with the given arguments.
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// caller is the environment of the call, the call is nested in the calls of caller.
+func applyFunction(fn object.Object, args []object.Object, caller *object.Environment) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		// calling a generator function does not evaluate its body yet
+		if fn.IsGenerator {
+			return newGenerator(fn, args, caller)
+		}
+		depth := caller.CallDepth() + 1
+		if depth > MaxCallDepth {
+			return newError("%s: more than %d nested calls", object.ErrStackOverflow, MaxCallDepth)
+		}
 		// bind function and arguments to a new inner environment
 		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv.SetCallDepth(depth)
+		extendedEnv.ShareLimits(caller)
 		// evaluate the function body within this extended environemnt
 		evaluated := Eval(fn.Body, extendedEnv)
 		// unwrap object if its a return value object
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		// call the built-in function with the evaluated arguments
-		if result := fn.Fn(args...); result != nil {
-			return result
+		// call the built-in function with the evaluated arguments, it can call back
+		// into the evaluator to apply functions
+		result := fn.Fn(runtime{env: caller}, args...)
+		if result == nil {
+			return NULL
 		}
-		return NULL
+		// the memory the builtin allocated for its result is accounted once it returns
+		if limits := caller.Limits(); limits != nil {
+			if err := limits.AllocateResult(result, args); err != nil {
+				return newError("%s", err)
+			}
+		}
+		return result
+	case *object.StructType:
+		// calling a struct type constructs a new struct with the arguments as its fields
+		return fn.Instantiate(args)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// runtime lets builtins call back into the evaluator (it implements object.Runtime, object.Allocator,
+// object.IOProvider, object.RandomProvider, object.LimitsProvider and object.Spawner).
+// env is the environment the builtin was called in.
+type runtime struct {
+	env *object.Environment
+}
+
+// Apply calls fn with the given arguments and returns its result, or the error it ran into.
+// A function without a result, like one with an empty body, returns null.
+func (rt runtime) Apply(fn object.Object, args ...object.Object) object.Object {
+	if result := applyFunction(fn, args, rt.env); result != nil {
+		return result
+	}
+	return NULL
+}
+
+// IO returns the input and output of the evaluation, the builtins write to and read from it
+func (rt runtime) IO() *object.IO {
+	return rt.env.IO()
+}
+
+// CanAllocate returns an error if the evaluation may not allocate size more bytes
+func (rt runtime) CanAllocate(size int64) error {
+	if limits := rt.env.Limits(); limits != nil {
+		return limits.CanAllocate(size)
+	}
+	return nil
+}
+
+// Random returns the source of the random builtins of the evaluation, nil if it uses the shared one
+func (rt runtime) Random() *object.Random {
+	return rt.env.Random()
+}
+
+// Limits returns the limits of the evaluation, the builtins waiting on channels stop once it must stop
+func (rt runtime) Limits() *object.Limits {
+	return rt.env.Limits()
+}
+
+// Spawn applies fn with args on a goroutine of its own, the spawn builtin calls it (see spawnFunction)
+func (rt runtime) Spawn(fn object.Object, args []object.Object) object.Object {
+	return spawnFunction(fn, args, rt.env)
+}
+
+// spawnFunction applies fn with the given arguments on a goroutine of its own. It returns a channel
+// that receives the result of the function (which can be an error) and is closed afterwards.
+func spawnFunction(fn object.Object, args []object.Object, caller *object.Environment) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		if fn.IsGenerator {
+			return newError("cannot spawn a generator function")
+		}
+	case *object.Builtin:
+	default:
+		return newError("spawn requires a function, got %s", fn.Type())
+	}
+
+	// the function keeps the limits of the caller, even once the evaluation of the caller returned
+	// and they are removed from its environment
+	env := object.NewEnclosedEnvironment(caller)
+	env.DetachLimits()
+
+	result := object.NewChannel(1)
+	go func() {
+		defer result.Close()
+		result.Send(applyFunction(fn, args, env))
+	}()
+
+	return result
+}
+
+// allocate accounts for the size bytes the evaluation in env is about to allocate,
+// it returns an error once the evaluation exceeds its memory limit
+func allocate(env *object.Environment, size int64) *object.Error {
+	if limits := env.Limits(); limits != nil {
+		if err := limits.Allocate(size); err != nil {
+			return newError("%s", err)
+		}
+	}
+	return nil
+}
+
+// allocated accounts for the memory of obj, built by the evaluation in env, and returns it.
+// It returns an error instead once the evaluation exceeds its memory limit.
+func allocated(env *object.Environment, obj object.Object) object.Object {
+	if err := allocate(env, object.Size(obj)); err != nil {
+		return err
+	}
+	return obj
+}
+
 // extendFunctionEnv creates a new inner environment for an object.Function
 // It binds the function's parameters and already evaluated arguments to
 // the new inner environment. The environment is enclosed by the initial environment (outer)
@@ -270,18 +465,19 @@ func evalInfixExpression(
 	left, right object.Object,
 ) object.Object {
 	switch {
+	// the `in` operator checks whether left is part of the collection on the right
+	case operator == "in":
+		return object.Member(left, right)
 	// evaluate the infix expression where both left and right nodes are operating on integers
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
-	// When the nodes are not integers then they are object.Booleans.
-	// We can do a pointer comparison here to check for equality between booleans.
-	// This is possible because the nodes here have already been evaluated
-	// to pointers of the object.Booleans we defined as TRUE and FALSE. So if left
-	// is &Object.Boolean{Value: true}, its the same TRUE we defined, the same memory address.
+	// When the nodes are not integers we compare their values. Strings, arrays, hashes
+	// and the other values are equal when they hold the same value, functions and
+	// channels are only equal to themselves (see object.Equal).
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	// infix expression is trying to perform an operation of mismatched types,
 	// this should return an error
 	case left.Type() != right.Type():
@@ -444,7 +640,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := lookupBuiltin(env, node.Value); ok {
 		return builtin
 	}
 
@@ -490,32 +686,73 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+// evalForExpression walks the elements of iterable, binding the loop variables in env and evaluating
+// the body of the loop for each element. The loop evaluates to null, unless the body
+// returns early or produces an error, which is handed back instead.
+func evalForExpression(node *ast.ForExpression, iterable object.Object, env *object.Environment) object.Object {
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	iterator := it.Iterate()
+	for {
+		key, value, ok := iterator.Next(runtime{env: env})
+		if !ok {
+			return NULL
+		}
+
+		// a generator that fails hands out the error as its value
+		if isError(value) {
+			return value
+		}
+
+		if node.Key != nil {
+			env.Set(node.Key.Value, key)
+		}
+		env.Set(node.Value.Value, value)
+
+		result := evalBlockStatement(node.Body, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+}
+
+// evalFieldExpression returns the value of the named field of a struct. It returns an error
+// if left is not a struct or its struct type does not declare the field.
+func evalFieldExpression(left object.Object, name string) object.Object {
+	st, ok := left.(*object.Struct)
+	if !ok {
+		return newError("field access not supported: %s", left.Type())
+	}
+	return st.GetField(name)
+}
+
 // evalHashIndexExpression will return the evaluated value in the Hash (left)
 // at the given key (index). If the key (index) does not exist in the Hash,
 // it will return NULL.
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	// assert that the index object is hashable
-	key, ok := index.(object.Hashable)
-	if !ok {
+	if !object.IsHashable(index) {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	// assert hash as an Object.Hash to get access to Hash.Pairs
+	// assert hash as an Object.Hash to look up the key
 	hashObject := hash.(*object.Hash)
-	pairs := hashObject.Pairs
 
-	// use the key to construct the HashKey struct
-	hashKey := key.HashKey()
-	// We can use that same hashKey struct to look up the pairs map since its keys are
-	// also hashKey structs. When looking up the key in the map, Go performs an equality
-	// comparison between the structs, ie: object.Integer{1: 1} == object.Integer{1: 1}.
+	// The hash looks up the pair by the HashKey struct of the key. When looking up the key,
+	// Go performs an equality comparison between the structs, ie: object.Integer{1: 1} == object.Integer{1: 1}.
 	// This is a valid comparison operation which leads to finding the matching key-value pair.
-	pair, ok := pairs[hashKey]
+	value, ok := hashObject.Get(index)
 	if !ok {
 		return NULL
 	}
 
-	return pair.Value
+	return value
 }
 
 // evalArrayIndexExpression will return the evaluated element in the array (left)
@@ -526,43 +763,40 @@ func evalArrayIndexExpression(left, index object.Object) object.Object {
 	array := left.(*object.Array)
 	// assert that index is an object.Integer so that we can access its Value
 	idx := index.(*object.Integer).Value
-	maxIdx := int64(len(array.Elements) - 1)
+	maxIdx := int64(array.Len() - 1)
 	if idx > maxIdx || idx < 0 {
 		return NULL
 	}
-	return array.Elements[idx]
+	return array.At(int(idx))
 }
 
 // evalHashLiteral evaluates a ast.HashLiteral node to construct an object.Hash.
-// It iterates through all the Pairs in the HashLiteral, evaluating all key and value
-// nodes to construct the new object.Hash.
+// It iterates through all the Pairs in the HashLiteral in the order of their keys
+// in the source, evaluating all key and value nodes to construct the new object.Hash.
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
-		hashable, ok := key.(object.Hashable)
-		if !ok {
+		if !object.IsHashable(key) {
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
-		// construct haskKey struct from hashable object
-		hashKey := hashable.HashKey()
-		// set hashKey struct as new key and assign it a hashPair value
-		pairs[hashKey] = object.HashPair{Key: key, Value: value}
+		// bind the key to its value, the hash remembers the order of the keys
+		hash.Set(key, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
@@ -1,7 +1,14 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	goruntime "runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/yourfavoritedev/golang-interpreter/lexer"
 	"github.com/yourfavoritedev/golang-interpreter/object"
@@ -382,25 +389,21 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
 		{
 			`let arr = [1,2,3]; rest(arr);`,
-			&object.Array{
-				Elements: []object.Object{
-					&object.Integer{Value: 2},
-					&object.Integer{Value: 3},
-				},
-			},
+			object.NewArray([]object.Object{
+				&object.Integer{Value: 2},
+				&object.Integer{Value: 3},
+			}),
 		},
 		{`rest()`, "wrong number of arguments. got=0, want=1"},
 		{`rest(1)`, "argument to `rest` must be ARRAY, got INTEGER"},
 		{
 			`let arr = [1,2,3]; push(arr, 4);`,
-			&object.Array{
-				Elements: []object.Object{
-					&object.Integer{Value: 1},
-					&object.Integer{Value: 2},
-					&object.Integer{Value: 3},
-					&object.Integer{Value: 4},
-				},
-			},
+			object.NewArray([]object.Object{
+				&object.Integer{Value: 1},
+				&object.Integer{Value: 2},
+				&object.Integer{Value: 3},
+				&object.Integer{Value: 4},
+			}),
 		},
 		{`push()`, "wrong number of arguments. got=0, want=2"},
 		{`push(1, 2)`, "argument to `push` must be ARRAY, got INTEGER"},
@@ -434,13 +437,13 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(result.Elements) != 3 {
-		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	if result.Len() != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", result.Len())
 	}
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+	testIntegerObject(t, result.At(0), 1)
+	testIntegerObject(t, result.At(1), 4)
+	testIntegerObject(t, result.At(2), 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -527,12 +530,17 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, pair := range result.Pairs() {
+		pairs[pair.Key.(object.Hashable).HashKey()] = pair
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := pairs[expectedKey]
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -586,3 +594,884 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`let gen = fn() { yield 1; yield 2; }(); next(gen) + next(gen);`,
+			3,
+		},
+		{
+			`let gen = fn() { yield 1; }(); next(gen); next(gen);`,
+			nil,
+		},
+		{
+			`
+			let counter = fn(from) {
+				yield from;
+				if (from > 1) { yield from * 10; }
+				return 0;
+				yield 99;
+			};
+			let gen = counter(5);
+			let sum = fn(gen, acc) {
+				if (done(gen)) { return acc; }
+				sum(gen, acc + next(gen));
+			};
+			sum(gen, 0);
+			`,
+			55,
+		},
+		{
+			`let gen = fn() { yield 1 + true; }(); next(gen);`,
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			`let gen = fn() { yield 1; }(); done(gen);`,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestGeneratorClose(t *testing.T) {
+	evaluated := testEval(`let gen = fn() { yield 1; yield 2; }(); next(gen); gen`)
+	gen, ok := evaluated.(*object.Generator)
+	if !ok {
+		t.Fatalf("object is not Generator. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	// the body is parked at its first yield statement until the generator is closed
+	parked := goruntime.NumGoroutine()
+	gen.Close()
+	if value, ok := gen.Next(nil); ok {
+		t.Errorf("expected a closed generator to be finished. got=%v", value)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for goruntime.NumGoroutine() >= parked {
+		if time.Now().After(deadline) {
+			t.Fatalf("the goroutine of the closed generator did not exit")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGeneratorLimits(t *testing.T) {
+	env := object.NewEnvironment()
+	input := `let gen = fn() { for (x in range(1000000000000)) { x }; yield 1 }();`
+	if result := Eval(parser.New(lexer.New(input)).ParseProgram(), env); isError(result) {
+		t.Fatalf("unexpected error: %s", result.Inspect())
+	}
+
+	// the body is bound by the limits of the evaluation resuming it
+	_, err := EvalWithLimits(parser.New(lexer.New(`next(gen)`)).ParseProgram(), env, object.NewLimits(nil, 1000))
+	if !errors.Is(err, object.ErrStepLimit) {
+		t.Errorf("expected object.ErrStepLimit. got=%v", err)
+	}
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`
+			let square = fn(x) { x * x };
+			let a = spawn(square, 3);
+			let b = spawn(square, 4);
+			recv(a) + recv(b);
+			`,
+			25,
+		},
+		{
+			`
+			let base = 10;
+			let results = channel(2);
+			let worker = fn(i) { send(results, base + i) };
+			spawn(worker, 1);
+			spawn(worker, 2);
+			let other = 5;
+			recv(results) + recv(results) + other;
+			`,
+			28,
+		},
+		{
+			`let a = channel(); let b = channel(1); send(b, 7); select([a, b])[1];`,
+			7,
+		},
+		{`let c = channel(1); close(c); recv(c);`, nil},
+		{`let c = channel(1); close(c); close(c);`, "close of closed channel"},
+		{`spawn(1)`, "spawn requires a function, got INTEGER"},
+		{`let spawn = fn(x) { x * 2 }; spawn(21)`, 42},
+		{`let run = fn(spawn) { recv(spawn(len, "four")) }; run(spawn)`, 4},
+		{`recv(spawn(fn() { 1 + true }));`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`struct Point { x, y }; let p = Point(1, 2); p.x + p.y`, 3},
+		{
+			`
+			struct Point { x, y };
+			struct Line { from, to };
+			let l = Line(Point(1, 2), Point(3, 4));
+			l.to.x - l.from.y
+			`,
+			1,
+		},
+		{`struct Box { items }; Box([1, 2, 3]).items[1]`, 2},
+		{`struct Point { x, y }; Point(1, 2).z`, "unknown field z for struct Point"},
+		{`struct Point { x, y }; Point(1)`, "wrong number of fields for struct Point: want=2, got=1"},
+		{`{"x": 1}.x`, "field access not supported: HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestStructInspect(t *testing.T) {
+	evaluated := testEval(`struct Point { x, y }; Point(1, "two")`)
+
+	if evaluated.Inspect() != "Point{x: 1, y: two}" {
+		t.Errorf("wrong Inspect. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`
+			let out = channel(10);
+			for (x in [1, 2, 3]) { send(out, x * 2) };
+			recv(out) + recv(out) + recv(out)
+			`,
+			12,
+		},
+		{`let acc = []; for (i in range(3)) { let acc = push(acc, i) }; len(acc)`, 3},
+		{`let sum = 0; for (x in range(5)) { let sum = sum + x }; sum`, 10},
+		{`let sum = 0; for (i, x in [5, 6, 7]) { let sum = sum + i }; sum`, 3},
+		{`let sum = 0; for (k, v in {"a": 1, "b": 2, "c": 3}) { let sum = sum + v }; sum`, 6},
+		{`let n = 0; for (c in "héllo") { let n = n + 1 }; n`, 5},
+		{`let last = 0; for (x in range(10, 0, -3)) { let last = x }; last`, 1},
+		{
+			`
+			let contains = fn(arr, target) {
+				for (x in arr) {
+					if (x == target) { return 1; }
+				}
+				0
+			};
+			contains([1, 2, 3], 2) + contains([1, 2, 3], 4)
+			`,
+			1,
+		},
+		{
+			`
+			let countTo = fn(n) { for (i in range(1, n + 1)) { yield i } };
+			let sum = 0;
+			for (x in countTo(3)) { let sum = sum + x };
+			sum
+			`,
+			6,
+		},
+		{`for (x in [1, 2]) { x }`, nil},
+		{`for (x in 5) { x }`, "cannot iterate over INTEGER"},
+		{`for (x in [1, 2]) { x + true }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`range(1, 2, 0)`, "step of `range` must not be zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len({1, 2, 2, 3, 1})`, 3},
+		{`len(to_set(["a", "b", "a"]))`, 2},
+		{`if (2 in {1, 2}) { 1 } else { 0 }`, 1},
+		{`if ([1] in {1}) { 1 } else { 0 }`, 0},
+		{`len(union({1, 2}, {2, 3}))`, 3},
+		{`len(intersection({1, 2, 3}, {2, 3, 4}))`, 2},
+		{`let d = difference({1, 2, 3}, {2}); if (2 in d) { 0 } else { len(d) }`, 2},
+		{`if ("ell" in "hello") { 1 } else { 0 }`, 1},
+		{`{[1, fn() {}]}`, "unusable as set element: ARRAY"},
+		{`1 in 2`, "operator `in` not supported: INTEGER"},
+		{`intersection(1, {1})`, "first argument to `intersection` must be SET, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestTypeAnnotationsAreIgnored(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let x: int = 5; x`, 5},
+		{`let add = fn(a: int, b: int): int { a + b }; add(1, 2)`, 3},
+		{`let f: fn = fn(x): string { x * 2 }; f(4)`, 8},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`[1, 2, 3] |> len`, 3},
+		{`let double = fn(x) { x * 2 }; 5 |> double |> double`, 20},
+		{`let add = fn(a, b) { a + b }; 1 |> add(2) |> add(3)`, 6},
+		{`[1] |> push(2) |> rest |> first`, 2},
+		{`3 |> fn(x) { x * x }`, 9},
+		{`let adder = fn(n) { fn(x) { x + n } }; 5 |> (adder(1))`, 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// twice is a builtin that applies its first argument two times, starting with its second argument.
+// It calls back into the evaluator through the object.Runtime it is given.
+var twice = &object.Builtin{
+	Fn: func(rt object.Runtime, args ...object.Object) object.Object {
+		once := rt.Apply(args[0], args[1])
+		if _, ok := once.(*object.Error); ok {
+			return once
+		}
+		return rt.Apply(args[0], once)
+	},
+}
+
+func TestBuiltinCallbacks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`twice(fn(x) { x * 2 }, 3)`, 12},
+		{`let offset = 10; twice(fn(x) { x + offset }, 1)`, 21},
+		{`twice(fn(x) { twice(fn(y) { y + 1 }, x) }, 0)`, 4},
+		{`let count = fn(n) { if (n == 0) { 0 } else { twice(fn(x) { x }, count(n - 1)) + 1 } }; count(50)`, 50},
+		{`twice(fn(x) { return x + 1; 100 }, 1)`, 3},
+		{`twice(len, "abc")`, "argument to `len` not supported, got=INTEGER"},
+		{`struct Box { value }; twice(fn(b) { Box(b.value * 3) }, Box(1)).value`, 9},
+		{`twice(fn(x) { x + true }, 1)`, "type mismatch: INTEGER + BOOLEAN"},
+		{`twice(1, 1)`, "not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		env := object.NewEnvironment()
+		env.Set("twice", twice)
+
+		evaluated := Eval(program, env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let factor = 3; map([1, 2], fn(x) { x * factor })`, "[3, 6]"},
+		{`map([[1], [2, 3]], len)`, "[1, 2]"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, "10"},
+		{`reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])`, "[1, 4, 9]"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([1, 3, 2], fn(a, b) { return a > b; })`, "[3, 2, 1]"},
+		{`sort_by(["ccc", "a", "bb"], len)`, "[a, bb, ccc]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`flatten([1, [2, 3], [[4]]])`, "[1, 2, 3, [4]]"},
+		{`flatten([1, [2, [3, [4]]]], 10)`, "[1, 2, 3, 4]"},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, "false"},
+		{`find([1, 2, 3, 4], fn(x) { x > 2 })`, "3"},
+		{`find([1, 2], fn(x) { x > 2 })`, "null"},
+		{`let a = map([1, 2], fn(x) {}); a`, "[null, null]"},
+		{`str(map([1], fn(x) {}))`, "[null]"},
+		{`reduce([1, 2], fn(acc, x) {}, 0)`, "null"},
+		{`filter([1, 2], fn(x) { if (x > 1) { true } })`, "[2]"},
+		{`index_of([1, 2, 3], 2)`, "1"},
+		{`contains(["a", "b"], "c")`, "false"},
+		{`[1, 2, 3, 4] |> filter(fn(x) { x > 2 }) |> map(fn(x) { x * 10 }) |> reduce(fn(a, b) { a + b })`, "70"},
+		{`map(1, fn(x) { x })`, "ERROR: first argument to `map` must be ARRAY, got INTEGER"},
+		{`reduce([], fn(a, b) { a + b })`, "ERROR: `reduce` of empty array with no initial value"},
+		{`sort([1, "a"])`, "ERROR: cannot compare STRING with INTEGER"},
+		{`map([1, 2], fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`sort([2, 1], fn(a, b) { a + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,c", ",")`, "[a, b, c]"},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`trim("  hello ")`, "hello"},
+		{`upper("Hello")`, "HELLO"},
+		{`lower("Hello")`, "hello"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`contains("monkey", "key")`, "true"},
+		{`starts_with("monkey", "mon")`, "true"},
+		{`ends_with("monkey", "mon")`, "false"},
+		{`index_of("monkey", "key")`, "3"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 9223372036854775807)`, "ERROR: result of `repeat` is too large"},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`pad_right("7", 3, "0")`, "700"},
+		{`format("%s is %d", "monkey", 5)`, "monkey is 5"},
+		{`format("%d", "x")`, "ERROR: format: %d cannot format STRING"},
+		{`format("%s and %s", "a")`, "ERROR: format: missing argument for %s"},
+		{`format("%s", "a", "b")`, "ERROR: format: too many arguments. got=2, used=1"},
+		{`"a b c" |> split() |> map(upper) |> join("-")`, "A-B-C"},
+		{`lower(1)`, "ERROR: argument to `lower` must be STRING, got INTEGER"},
+		{`starts_with("a", 1)`, "ERROR: second argument to `starts_with` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"b": 2, "a": 1, "c": 3})`, "[b, a, c]"},
+		{`keys({true: 1, 2: 2, "x": 3, false: 4})`, "[true, 2, x, false]"},
+		{`values({"b": 2, "a": 1, "c": 3})`, "[2, 1, 3]"},
+		{`entries({"b": 2, "a": 1})`, "[[b, 2], [a, 1]]"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": if (false) { 1 }}, "a")`, "true"},
+		{`has({"a": 1}, "b")`, "false"},
+		{`set({1: 1}, 2, 2)[2]`, "2"},
+		{`let h = {1: 1}; set(h, 2, 2); has(h, 2)`, "false"},
+		{`has(delete({1: 1, 2: 2}, 1), 1)`, "false"},
+		{`values(merge({1: 1, 2: 2}, {2: 20, 3: 30}))`, "[1, 20, 30]"},
+		{`values([1])`, "ERROR: argument to `values` must be HASH, got ARRAY"},
+		{`has({}, [fn() {}])`, "ERROR: unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json_parse(json_stringify({"a": [1, 2]}))["a"]`, "[1, 2]"},
+		{`json_stringify({"b": [1, "x"], "a": if (false) { 1 }})`, `{"b":[1,"x"],"a":null}`},
+		{`json_stringify({"a": 1}, true)`, "{\n  \"a\": 1\n}"},
+		{`json_parse("[1,")`, "ERROR: invalid JSON: unexpected end of input at line 1, column 4"},
+		{`json_stringify([fn() {}])`, "ERROR: unsupported type for JSON: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`abs(-5)`, "5"},
+		{`min(3, 1, 2)`, "1"},
+		{`max([4, -2, 8])`, "8"},
+		{`pow(2, 10)`, "1024"},
+		{`sqrt(17)`, "4"},
+		{`div_floor(-7, 2)`, "-4"},
+		{`div_ceil(-7, 2)`, "-3"},
+		{`div_round(7, 2)`, "4"},
+		{`clamp(5, 0, 3)`, "3"},
+		{`sum([1, 2, 3])`, "6"},
+		{`random_int(3, 3)`, "3"},
+		{`random_seed(1); let a = random(); random_seed(1); a == random()`, "true"},
+		{`sqrt(-1)`, "ERROR: argument to `sqrt` must not be negative, got -1"},
+		{`div_round(1, 0)`, "ERROR: division by zero in `div_round`"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestEvalRandom(t *testing.T) {
+	env := object.NewEnvironment()
+	env.SetRandom(object.NewRandom(0))
+
+	// random_seed seeds the source of the environment, the shared one is left alone
+	object.SeedRandom(9)
+	evaluated := Eval(parser.New(lexer.New(`random_seed(42); [random(), recv(spawn(random))]`)).ParseProgram(), env)
+	expected := object.NewRandom(42)
+	if want := fmt.Sprintf("[%d, %d]", expected.Int63(), expected.Int63()); evaluated.Inspect() != want {
+		t.Errorf("wrong draws. want=%s, got=%s", want, evaluated.Inspect())
+	}
+
+	shared := object.NewRandom(9)
+	if evaluated := testEval(`random()`); evaluated.Inspect() != fmt.Sprint(shared.Int63()) {
+		t.Errorf("expected the shared source to be left alone. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestTypeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type(1)`, "int"},
+		{`type(fn() {})`, "fn"},
+		{`struct Point { x, y }; type(Point(1, 2))`, "Point"},
+		{`is_string("1")`, "true"},
+		{`is_int("1")`, "false"},
+		{`int("42") + 1`, "43"},
+		{`str(42) + "!"`, "42!"},
+		{`bool("false")`, "false"},
+		{`int("4a")`, `ERROR: cannot convert "4a" to int`},
+		{`bool([])`, "ERROR: cannot convert array to bool"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+		{`"a" != "a"`, false},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} != {"a": 2}`, true},
+		{`{1, 2} == {2, 1}`, true},
+		{`if (false) { 1 } == first([])`, true},
+		{`1 == "1"`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`[1, 2] in [[1, 2], [3]]`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"c": 1, "a": 2, "b": 3}`, "{c: 1, a: 2, b: 3}"},
+		{`{3: "x", 1: "y", true: "z"}`, "{3: x, 1: y, true: z}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+		{`set({"b": 1, "a": 2}, "c", 3)`, "{b: 1, a: 2, c: 3}"},
+		{`delete({"c": 1, "a": 2, "b": 3}, "a")`, "{c: 1, b: 3}"},
+		{`let ks = fn(h) { for (k, v in h) { yield k; } }; let g = ks({"b": 1, "c": 2, "a": 3}); [next(g), next(g), next(g)]`, "[b, c, a]"},
+		{`{3, 1, 2}`, "{3, 1, 2}"},
+		{`union({3, 1}, {2, 3, 0})`, "{3, 1, 2, 0}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestPushAndRestOnLargeArrays(t *testing.T) {
+	input := `
+	let grow = fn(arr, n) { if (n == 0) { arr } else { grow(push(arr, len(arr)), n - 1) } };
+	let drop = fn(arr, n) { if (n == 0) { arr } else { drop(rest(arr), n - 1) } };
+	let steps = grow([], 100);
+	let numbers = reduce(steps, fn(arr, i) { grow(arr, 500) }, []);
+	let tail = reduce(rest(steps), fn(arr, i) { drop(arr, 500) }, numbers);
+	[len(numbers), first(numbers), last(numbers), len(tail), first(tail), last(tail), len(push(tail, 0)), len(numbers)]
+	`
+	expected := "[50000, 0, 49999, 500, 49500, 49999, 501, 50000]"
+
+	evaluated := testEval(input)
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong result. expected=%q, got=%q", expected, evaluated.Inspect())
+	}
+}
+
+func TestCompositeHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{[1, 2]: "cell"}[[1, 2]]`, "cell"},
+		{`{[1, 2]: "cell"}[[2, 1]]`, "null"},
+		{`let grid = {[0, 0]: 1, [0, 1]: 2}; grid[[0, 1]] + grid[[0, 0]]`, "3"},
+		{`{{"a": 1, "b": 2}: "x"}[{"b": 2, "a": 1}]`, "x"},
+		{`{[1, 2]: 1, [1, 2]: 2}`, "{[1, 2]: 2}"},
+		{`[3, 4] in {[1, 2], [3, 4]}`, "true"},
+		{`{[1, fn() {}]: 1}`, "ERROR: unusable as hash key: ARRAY"},
+		{`{"a": 1}[[fn() {}]]`, "ERROR: unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCustomBuiltins(t *testing.T) {
+	builtins := object.DefaultBuiltins()
+	builtins.Remove("len")
+	builtins.Define("answer", &object.Builtin{
+		Fn: func(rt object.Runtime, args ...object.Object) object.Object {
+			return &object.Integer{Value: 42}
+		},
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`answer()`, "42"},
+		{`let f = fn() { answer() + 1 }; f()`, "43"},
+		{`map([1], fn(x) { answer() + x })`, "[43]"},
+		{`len([])`, "ERROR: identifier not found: len"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result := Eval(program, object.NewEnvironmentWithBuiltins(builtins))
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// the default builtins are not affected
+	if result := testEval(`len([1])`); result.Inspect() != "1" {
+		t.Errorf("len is not defined by default. got=%s", result.Inspect())
+	}
+}
+
+func TestEvalWithLimits(t *testing.T) {
+	evalWithLimits := func(input string, limits *object.Limits) (object.Object, error) {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return EvalWithLimits(program, object.NewEnvironment(), limits)
+	}
+
+	result, err := evalWithLimits(`let sum = 0; for (x in range(10)) { let sum = sum + x }; sum`, object.NewLimits(nil, 1000))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, result, 45)
+
+	tests := []string{
+		`for (x in range(1000000000000)) { x }`,
+		`let loop = fn(n) { loop(n + 1) }; loop(0)`,
+		`map([1], fn(x) { for (y in range(1000000000000)) { y } })`,
+		`recv(spawn(fn() { for (x in range(1000000000000)) { x } }))`,
+		`let g = fn() { for (x in range(1000000000000)) { yield x } }; for (x in g()) { x }`,
+	}
+
+	for _, input := range tests {
+		_, err := evalWithLimits(input, object.NewLimits(nil, 1000))
+		if !errors.Is(err, object.ErrStepLimit) {
+			t.Errorf("%q: expected object.ErrStepLimit. got=%v", input, err)
+		}
+	}
+
+	// the functions started with spawn keep the limits once the evaluation returned
+	result, err = evalWithLimits(`spawn(fn() { for (x in range(1000000000000)) { x } })`, object.NewLimits(nil, 1000))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	spawned, ok := result.(*object.Channel)
+	if !ok {
+		t.Fatalf("object is not Channel. got=%T (%+v)", result, result)
+	}
+	if value, _ := spawned.Recv(); !isError(value) || !strings.Contains(value.Inspect(), object.ErrStepLimit.Error()) {
+		t.Errorf("expected the spawned function to run into the step limit. got=%v", value)
+	}
+}
+
+func TestEvalMemoryLimit(t *testing.T) {
+	evalWithMemoryLimit := func(input string) (object.Object, error) {
+		limits := object.NewLimits(nil, 0)
+		limits.SetMemoryLimit(1 << 20)
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return EvalWithLimits(program, object.NewEnvironment(), limits)
+	}
+
+	result, err := evalWithMemoryLimit(`len(repeat("ab", 100) + join(map([1, 2, 3], str), ","))`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, result, 205)
+
+	tests := []string{
+		`let s = "ab"; for (x in range(40)) { let s = s + s }; len(s)`,
+		`len(repeat("ab", 100000000))`,
+		`pad_right("a", 100000000)`,
+		`let s = repeat("x", 100000); join(map(split(repeat("a", 20000), ""), fn(x) { s }))`,
+		`replace(repeat("a", 10000), "a", repeat("x", 100000))`,
+		`format(repeat("%[1]s", 1000), repeat("x", 100000))`,
+		`let s = repeat("x", 100000); json_stringify(map(split(repeat("a", 20000), ""), fn(x) { s }))`,
+		`let arr = []; for (x in range(100000)) { let arr = push(arr, x) }; len(arr)`,
+		`let acc = []; for (x in range(100000)) { let acc = [acc, {"x": x}, {x}] }; acc`,
+		`recv(spawn(fn() { repeat("ab", 100000000) }))`,
+	}
+
+	for _, input := range tests {
+		_, err := evalWithMemoryLimit(input)
+		if !errors.Is(err, object.ErrMemoryLimit) {
+			t.Errorf("%q: expected object.ErrMemoryLimit. got=%v", input, err)
+		}
+	}
+}
+
+func TestCallDepth(t *testing.T) {
+	tests := []string{
+		`let f = fn(n) { 1 + f(n + 1) }; f(0)`,
+		`map([1], fn(x) { let f = fn(n) { 1 + f(n + 1) }; f(0) })`,
+		// the body of a generator is nested in the calls of the generator function call
+		`
+		let gen = fn() { let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; yield f(100) };
+		let deep = fn(n) { if (n == 0) { next(gen()) } else { deep(n - 1) } };
+		deep(9950)
+		`,
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("%q: no error object returned. got=%T (%+v)", input, evaluated, evaluated)
+		}
+		expected := fmt.Sprintf("stack overflow: more than %d nested calls", MaxCallDepth)
+		if errObj.Message != expected {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", input, expected, errObj.Message)
+		}
+	}
+
+	// the depth is the number of nested calls, not the number of calls
+	evaluated := testEval(`let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(5000) + count(5000)`)
+	testIntegerObject(t, evaluated, 10000)
+}
+
+func TestEvalContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New(`for (x in range(1000000000000)) { x }`)).ParseProgram()
+	_, err := EvalContext(ctx, program, env)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded. got=%v", err)
+	}
+
+	// the limits only apply to the evaluation they were given to
+	if result := Eval(parser.New(lexer.New(`1 + 1`)).ParseProgram(), env); result.Inspect() != "2" {
+		t.Errorf("wrong result after the limited evaluation. got=%s", result.Inspect())
+	}
+
+	// the builtins waiting on a channel stop waiting once the context is done
+	blocking := []string{
+		`recv(channel())`,
+		`send(channel(), 1)`,
+		`select([channel(), channel()])`,
+		`recv(spawn(fn() { recv(channel()) }))`,
+	}
+
+	for _, input := range blocking {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := EvalContext(ctx, parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%q: expected context.DeadlineExceeded. got=%v", input, err)
+		}
+	}
+}
+
+func TestEvalIO(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetIO(object.NewIO(strings.NewReader("Monkey\nlast"), &out))
+
+	input := `
+	let greet = fn(name) { puts("hello " + name) };
+	let name = input("name? ");
+	recv(spawn(greet, name));
+	puts(read_line(), read_line())
+	`
+	evaluated := Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	if isError(evaluated) {
+		t.Fatalf("unexpected error: %s", evaluated.Inspect())
+	}
+
+	expected := "name? hello Monkey\nlast\nnull\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
@@ -0,0 +1,89 @@
+package evaluator
+
+import (
+	goruntime "runtime"
+	"sync"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+// errGeneratorStopped ends the evaluation of the body of a generator that was stopped (see object.Generator.Close)
+var errGeneratorStopped = newError("generator stopped")
+
+// newGenerator creates the generator produced by calling the generator function fn with args, the body
+// is nested in the calls of caller. A tree-walking evaluation cannot be paused half-way, so the function
+// body is evaluated on its own goroutine which hands over control at every yield statement: it sends the
+// yielded value and waits to be resumed. The goroutine is only started by the first resume and it exits
+// once the body has been evaluated, or once the generator is stopped: by Close, or when the generator is
+// garbage collected before it finished. A generator stored in an environment its own body can reach is
+// only stopped by Close.
+// The body is bound by the limits of the evaluation resuming it, they are set on its environment at
+// every resume.
+func newGenerator(fn *object.Function, args []object.Object, caller *object.Environment) *object.Generator {
+	env := extendFunctionEnv(fn, args)
+	env.SetCallDepth(caller.CallDepth() + 1)
+	env.DetachLimits()
+
+	values := make(chan object.Object)
+	next := make(chan struct{})
+	stopped := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { close(stopped) })
+	}
+
+	env.SetYielder(func(val object.Object) *object.Error {
+		select {
+		case values <- val:
+		case <-stopped:
+			return errGeneratorStopped
+		}
+
+		select {
+		case <-next:
+			return nil
+		case <-stopped:
+			return errGeneratorStopped
+		}
+	})
+
+	started := false
+	finished := false
+
+	resume := func(rt object.Runtime) (object.Object, bool) {
+		if finished {
+			return nil, false
+		}
+
+		if provider, ok := rt.(object.LimitsProvider); ok {
+			env.SetLimits(provider.Limits())
+		}
+
+		if !started {
+			started = true
+			go func() {
+				defer close(values)
+				if result := Eval(fn.Body, env); isError(result) && result != errGeneratorStopped {
+					select {
+					case values <- result:
+					case <-stopped:
+					}
+				}
+			}()
+		} else {
+			next <- struct{}{}
+		}
+
+		val, ok := <-values
+		if !ok || isError(val) {
+			finished = true
+		}
+
+		return val, ok
+	}
+
+	// the goroutine does not reference the generator, which can be collected while the goroutine is parked
+	generator := &object.Generator{Resume: resume, Stop: stop}
+	goruntime.SetFinalizer(generator, func(*object.Generator) { stop() })
+	return generator
+}
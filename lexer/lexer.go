@@ -13,10 +13,19 @@ type Lexer struct {
 	position     int  // current position in input (points to the current char)
 	readPosition int  // current reading position in input (points to the char that will be read next)
 	ch           byte // current char under examination
+	line         int  // line of the current char
+	column       int  // column of the current char
 }
 
 // readChar finds the next character in the input and then advances our position in the input
 func (l *Lexer) readChar() {
+	// moving past a newline starts the next line
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // 0 is the ASCII code for the "NUL" character
 	} else {
@@ -76,11 +85,22 @@ func (l *Lexer) readString() string {
 }
 
 // NextToken looks at the current character under examination and returns a Token depending on which character it is.
+// The Token is marked with the position of its first character.
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
 
+	line, column := l.line, l.column
+	tok := l.readToken()
+	tok.Line = line
+	tok.Column = column
+
+	return tok
+}
+
+// readToken reads the Token starting at the current character under examination
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -104,6 +124,15 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '|':
+		if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.PIPE, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '/':
@@ -116,6 +145,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COMMA, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -178,7 +209,7 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 // It calls readChar a single time to initialize the first char to be examined,
 // then sets the position and the next readPosition for the lexer
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
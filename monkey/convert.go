@@ -0,0 +1,497 @@
+package monkey
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+// The conversions between Go values and Monkey objects follow the types of both languages:
+//
+//	Go                              Monkey
+//	nil, nil pointers               null
+//	bool                            BOOLEAN
+//	int, int8, ..., uint64          INTEGER
+//	string                          STRING
+//	slices and arrays               ARRAY
+//	maps                            HASH
+//	structs                         HASH of the exported fields (or a Monkey struct, see FromObject)
+//	funcs                           BUILTIN (see NewFunc)
+//	object.Object                   the object itself
+//
+// Struct fields are named like in Go, the `monkey:"name"` tag renames a field and `monkey:"-"` skips it.
+// Monkey has no floating point numbers, so floats, complex numbers and channels are not converted.
+
+var objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+
+// ToObject converts the Go value v into a Monkey object. The pairs of a hash converted from a map
+// are ordered by their keys, so converting the same map always produces the same hash.
+// A value that contains itself, through pointers, maps or slices, cannot be converted.
+func ToObject(v interface{}) (object.Object, error) {
+	if v == nil {
+		return object.NULL, nil
+	}
+	return toObject(reflect.ValueOf(v), visiting{})
+}
+
+// reference identifies a pointer, a map or a slice whose value is being converted.
+// A slice is identified by its length as well, a slice and its prefix share their first element.
+type reference struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// visiting holds the pointers, maps and slices enclosing the value being converted,
+// converting one of them again would never end
+type visiting map[reference]bool
+
+// enter records that the value of ref is being converted, it returns an error if it already is
+func (vs visiting) enter(v reflect.Value, ref reference) error {
+	if vs[ref] {
+		return fmt.Errorf("cannot convert %s: the value contains itself", v.Type())
+	}
+	vs[ref] = true
+	return nil
+}
+
+// toObject converts the Go value v into a Monkey object, vs holds the values enclosing v
+func toObject(v reflect.Value, vs visiting) (object.Object, error) {
+	if v.Type().Implements(objectType) {
+		if (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) && v.IsNil() {
+			return object.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return nativeBool(v.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := v.Uint()
+		if n > 1<<63-1 {
+			return nil, fmt.Errorf("cannot convert %d to INTEGER: out of range", n)
+		}
+		return &object.Integer{Value: int64(n)}, nil
+
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return object.NULL, nil
+		}
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			ref := reference{typ: v.Type(), ptr: v.Pointer(), len: v.Len()}
+			if err := vs.enter(v, ref); err != nil {
+				return nil, err
+			}
+			defer delete(vs, ref)
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := toObject(v.Index(i), vs)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return object.NewArray(elements), nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		ref := reference{typ: v.Type(), ptr: v.Pointer()}
+		if err := vs.enter(v, ref); err != nil {
+			return nil, err
+		}
+		defer delete(vs, ref)
+		return mapToHash(v, vs)
+
+	case reflect.Struct:
+		hash := object.NewHash()
+		for _, field := range structFields(v.Type()) {
+			value, err := toObject(v.Field(field.index), vs)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&object.String{Value: field.name}, value)
+		}
+		return hash, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		if v.Kind() == reflect.Ptr {
+			ref := reference{typ: v.Type(), ptr: v.Pointer()}
+			if err := vs.enter(v, ref); err != nil {
+				return nil, err
+			}
+			defer delete(vs, ref)
+		}
+		return toObject(v.Elem(), vs)
+
+	case reflect.Func:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return newFunc("function", v)
+
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Monkey value", v.Type())
+	}
+}
+
+// mapToHash converts the map v into a Hash, adding its pairs in the order of their keys
+func mapToHash(v reflect.Value, vs visiting) (object.Object, error) {
+	type pair struct {
+		key, value object.Object
+	}
+
+	pairs := make([]pair, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := toObject(iter.Key(), vs)
+		if err != nil {
+			return nil, err
+		}
+		value, err := toObject(iter.Value(), vs)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{key, value})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return lessKey(pairs[i].key, pairs[j].key) })
+
+	hash := object.NewHash()
+	for _, p := range pairs {
+		if err := hash.Set(p.key, p.value); err != nil {
+			return nil, fmt.Errorf("%s", err.Message)
+		}
+	}
+	return hash, nil
+}
+
+// lessKey orders the keys of a converted map. Integers and strings are ordered by their value,
+// keys of different types by the name of their type.
+func lessKey(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		if b, ok := b.(*object.Integer); ok {
+			return a.Value < b.Value
+		}
+	case *object.String:
+		if b, ok := b.(*object.String); ok {
+			return a.Value < b.Value
+		}
+	}
+
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+// structField is an exported field of a Go struct and its name in Monkey
+type structField struct {
+	index int
+	name  string
+}
+
+// structFields returns the exported fields of the struct type t that are converted
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("monkey"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{index: i, name: name})
+	}
+	return fields
+}
+
+// FromObject converts the Monkey object obj into the Go value target points to, like json.Unmarshal.
+// An interface{} receives the natural Go value of obj: int64, string, bool, nil, []interface{}
+// or a map (map[string]interface{} if all the keys are strings, map[interface{}]interface{} otherwise).
+// A struct can be filled from a hash with string keys or from a Monkey struct, the keys or fields
+// without a matching Go field are ignored.
+func FromObject(obj object.Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("target of FromObject must be a non-nil pointer, got %T", target)
+	}
+	return fromObject(obj, v.Elem())
+}
+
+// fromObject converts obj into the Go value v, which must be settable
+func fromObject(obj object.Object, v reflect.Value) error {
+	t := v.Type()
+
+	if t == objectType {
+		v.Set(reflect.ValueOf(&obj).Elem())
+		return nil
+	}
+	if objValue := reflect.ValueOf(obj); objValue.Type().AssignableTo(t) && t.Kind() != reflect.Interface {
+		v.Set(objValue)
+		return nil
+	}
+
+	if _, ok := obj.(*object.Null); ok {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		natural, err := naturalValue(obj)
+		if err != nil {
+			return err
+		}
+		if natural == nil {
+			v.Set(reflect.Zero(t))
+		} else {
+			v.Set(reflect.ValueOf(natural))
+		}
+		return nil
+
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			v.SetBool(b.Value)
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := obj.(*object.Integer); ok {
+			if v.OverflowInt(n.Value) {
+				return fmt.Errorf("cannot convert %d to %s: out of range", n.Value, t)
+			}
+			v.SetInt(n.Value)
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := obj.(*object.Integer); ok {
+			if n.Value < 0 || v.OverflowUint(uint64(n.Value)) {
+				return fmt.Errorf("cannot convert %d to %s: out of range", n.Value, t)
+			}
+			v.SetUint(uint64(n.Value))
+			return nil
+		}
+
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			v.SetString(s.Value)
+			return nil
+		}
+
+	case reflect.Slice, reflect.Array:
+		elements, ok := sequence(obj)
+		if !ok {
+			break
+		}
+		if t.Kind() == reflect.Array && len(elements) != t.Len() {
+			return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(elements), t)
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(elements), len(elements)))
+		}
+		for i, el := range elements {
+			if err := fromObject(el, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			break
+		}
+		m := reflect.MakeMapWithSize(t, hash.Len())
+		for _, pair := range hash.Pairs() {
+			key := reflect.New(t.Key()).Elem()
+			if err := fromObject(pair.Key, key); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := fromObject(pair.Value, value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+
+	case reflect.Struct:
+		return fromStructLike(obj, v)
+
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := fromObject(obj, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+// fromStructLike fills the Go struct v from a hash with string keys or from a Monkey struct
+func fromStructLike(obj object.Object, v reflect.Value) error {
+	var lookup func(name string) (object.Object, bool)
+
+	switch obj := obj.(type) {
+	case *object.Hash:
+		lookup = func(name string) (object.Object, bool) {
+			return obj.Get(&object.String{Value: name})
+		}
+	case *object.Struct:
+		lookup = func(name string) (object.Object, bool) {
+			for i, field := range obj.StructType.Fields {
+				if field == name {
+					return obj.Fields[i], true
+				}
+			}
+			return nil, false
+		}
+	default:
+		return fmt.Errorf("cannot convert %s to %s", obj.Type(), v.Type())
+	}
+
+	for _, field := range structFields(v.Type()) {
+		value, ok := lookup(field.name)
+		if !ok {
+			continue
+		}
+		if err := fromObject(value, v.Field(field.index)); err != nil {
+			return fmt.Errorf("field %s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+// sequence returns the elements of an array or a set
+func sequence(obj object.Object) ([]object.Object, bool) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return obj.Elements(), true
+	case *object.Set:
+		return obj.Elements(), true
+	default:
+		return nil, false
+	}
+}
+
+// naturalValue returns the Go value obj naturally converts to (see FromObject)
+func naturalValue(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Array, *object.Set:
+		elements, _ := sequence(obj)
+		result := make([]interface{}, len(elements))
+		for i, el := range elements {
+			value, err := naturalValue(el)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	case *object.Hash:
+		return naturalMap(obj)
+	case *object.Struct:
+		result := make(map[string]interface{}, len(obj.Fields))
+		for i, field := range obj.StructType.Fields {
+			value, err := naturalValue(obj.Fields[i])
+			if err != nil {
+				return nil, err
+			}
+			result[field] = value
+		}
+		return result, nil
+	default:
+		return obj, nil
+	}
+}
+
+// naturalMap returns the Go map the hash naturally converts to (see FromObject)
+func naturalMap(hash *object.Hash) (interface{}, error) {
+	pairs := hash.Pairs()
+
+	stringKeys := true
+	for _, pair := range pairs {
+		if _, ok := pair.Key.(*object.String); !ok {
+			stringKeys = false
+		}
+	}
+
+	if stringKeys {
+		result := make(map[string]interface{}, len(pairs))
+		for _, pair := range pairs {
+			value, err := naturalValue(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			result[pair.Key.(*object.String).Value] = value
+		}
+		return result, nil
+	}
+
+	result := make(map[interface{}]interface{}, len(pairs))
+	for _, pair := range pairs {
+		switch pair.Key.(type) {
+		case *object.Integer, *object.Boolean:
+		default:
+			return nil, fmt.Errorf("cannot convert hash key of type %s to a Go map key", pair.Key.Type())
+		}
+		key, _ := naturalValue(pair.Key)
+		value, err := naturalValue(pair.Value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// nativeBool returns the shared TRUE or FALSE object for the given bool
+func nativeBool(value bool) *object.Boolean {
+	if value {
+		return object.TRUE
+	}
+	return object.FALSE
+}
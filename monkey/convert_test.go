@@ -0,0 +1,248 @@
+package monkey
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+type point struct {
+	X, Y   int
+	Label  string `monkey:"label"`
+	Hidden string `monkey:"-"`
+	secret int
+}
+
+func TestToObject(t *testing.T) {
+	n := 7
+	var nilPoint *point
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{42, "42"},
+		{uint8(200), "200"},
+		{int64(-5), "-5"},
+		{"monkey", "monkey"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]interface{}{1, "a", nil}, "[1, a, null]"},
+		{map[string]int{"b": 2, "a": 1, "c": 3}, "{a: 1, b: 2, c: 3}"},
+		{map[int]bool{3: true, 1: false}, "{1: false, 3: true}"},
+		{point{X: 1, Y: 2, Label: "p", Hidden: "h", secret: 3}, "{X: 1, Y: 2, label: p}"},
+		{&point{X: 1}, "{X: 1, Y: 0, label: }"},
+		{nilPoint, "null"},
+		{&n, "7"},
+		{&object.Integer{Value: 5}, "5"},
+		{[]object.Object{object.TRUE}, "[true]"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Fatalf("%#v: unexpected error: %s", tt.input, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%#v: wrong object. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+func TestToObjectErrors(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{1.5, "cannot convert float64 to a Monkey value"},
+		{[]float32{1}, "cannot convert float32 to a Monkey value"},
+		{uint64(1 << 63), "cannot convert 9223372036854775808 to INTEGER: out of range"},
+		{make(chan int), "cannot convert chan int to a Monkey value"},
+	}
+
+	for _, tt := range tests {
+		_, err := ToObject(tt.input)
+		if err == nil {
+			t.Fatalf("%#v: expected an error", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%#v: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestToObjectCycles(t *testing.T) {
+	type node struct {
+		Value int
+		Next  *node
+	}
+
+	n := &node{Value: 1}
+	n.Next = &node{Value: 2, Next: n}
+
+	m := map[string]interface{}{"a": 1}
+	m["self"] = m
+
+	sl := []interface{}{1, nil}
+	sl[1] = sl
+
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{"pointer", n, "cannot convert *monkey.node: the value contains itself"},
+		{"map", m, "cannot convert map[string]interface {}: the value contains itself"},
+		{"slice", sl, "cannot convert []interface {}: the value contains itself"},
+	}
+
+	for _, tt := range tests {
+		_, err := ToObject(tt.input)
+		if err == nil {
+			t.Fatalf("%s: expected an error", tt.name)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err.Error())
+		}
+	}
+
+	// a value referenced twice without containing itself is converted twice
+	shared := &point{X: 1}
+	obj, err := ToObject([]*point{shared, shared})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "[{X: 1, Y: 0, label: }, {X: 1, Y: 0, label: }]"
+	if obj.Inspect() != expected {
+		t.Errorf("wrong object. want=%q, got=%q", expected, obj.Inspect())
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	interpreter := New()
+	eval := func(src string) object.Object {
+		obj, err := interpreter.Eval(src)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", src, err)
+		}
+		return obj
+	}
+
+	var n int
+	if err := FromObject(eval(`40 + 2`), &n); err != nil || n != 42 {
+		t.Errorf("wrong int. got=%d (%v)", n, err)
+	}
+
+	var s string
+	if err := FromObject(eval(`"mon" + "key"`), &s); err != nil || s != "monkey" {
+		t.Errorf("wrong string. got=%q (%v)", s, err)
+	}
+
+	var b bool
+	if err := FromObject(eval(`1 < 2`), &b); err != nil || !b {
+		t.Errorf("wrong bool. got=%t (%v)", b, err)
+	}
+
+	var ints []int8
+	if err := FromObject(eval(`[1, 2, 3]`), &ints); err != nil || !reflect.DeepEqual(ints, []int8{1, 2, 3}) {
+		t.Errorf("wrong slice. got=%v (%v)", ints, err)
+	}
+
+	var pair [2]string
+	if err := FromObject(eval(`["a", "b"]`), &pair); err != nil || pair != [2]string{"a", "b"} {
+		t.Errorf("wrong array. got=%v (%v)", pair, err)
+	}
+
+	var m map[string]int
+	if err := FromObject(eval(`{"a": 1, "b": 2}`), &m); err != nil || !reflect.DeepEqual(m, map[string]int{"a": 1, "b": 2}) {
+		t.Errorf("wrong map. got=%v (%v)", m, err)
+	}
+
+	var p point
+	if err := FromObject(eval(`{"X": 1, "Y": 2, "label": "p", "Hidden": "h", "Z": 3}`), &p); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p != (point{X: 1, Y: 2, Label: "p"}) {
+		t.Errorf("wrong struct. got=%+v", p)
+	}
+
+	var pp *point
+	if err := FromObject(eval(`struct P { X, Y }; P(3, 4)`), &pp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pp == nil || *pp != (point{X: 3, Y: 4}) {
+		t.Errorf("wrong struct. got=%+v", pp)
+	}
+	if err := FromObject(eval(`if (false) { 1 }`), &pp); err != nil || pp != nil {
+		t.Errorf("null should set the pointer to nil. got=%+v (%v)", pp, err)
+	}
+
+	var obj object.Object
+	if err := FromObject(eval(`[1]`), &obj); err != nil || obj.Inspect() != "[1]" {
+		t.Errorf("wrong object. got=%v (%v)", obj, err)
+	}
+
+	var arr *object.Array
+	if err := FromObject(eval(`[1, 2]`), &arr); err != nil || arr.Len() != 2 {
+		t.Errorf("wrong array object. got=%v (%v)", arr, err)
+	}
+}
+
+func TestFromObjectNaturalValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`1`, int64(1)},
+		{`"a"`, "a"},
+		{`true`, true},
+		{`if (false) { 1 }`, nil},
+		{`[1, "a", [true]]`, []interface{}{int64(1), "a", []interface{}{true}}},
+		{`{"a": 1, "b": [2]}`, map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2)}}},
+		{`{1: "a", true: "b"}`, map[interface{}]interface{}{int64(1): "a", true: "b"}},
+	}
+
+	for _, tt := range tests {
+		obj, err := New().Eval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+
+		var value interface{}
+		if err := FromObject(obj, &value); err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("%q: wrong value. want=%#v, got=%#v", tt.input, tt.expected, value)
+		}
+	}
+}
+
+func TestFromObjectErrors(t *testing.T) {
+	tests := []struct {
+		input    object.Object
+		target   interface{}
+		expected string
+	}{
+		{&object.String{Value: "a"}, new(int), "cannot convert STRING to int"},
+		{&object.Integer{Value: 300}, new(uint8), "cannot convert 300 to uint8: out of range"},
+		{&object.Integer{Value: -1}, new(uint), "cannot convert -1 to uint: out of range"},
+		{object.NewArray([]object.Object{object.TRUE}), new([2]bool), "cannot convert ARRAY of length 1 to [2]bool"},
+		{object.NewArray([]object.Object{object.TRUE}), new([]string), "cannot convert BOOLEAN to string"},
+		{object.NULL, new(int), "cannot convert NULL to int"},
+		{&object.Integer{Value: 1}, 0, "target of FromObject must be a non-nil pointer, got int"},
+	}
+
+	for _, tt := range tests {
+		err := FromObject(tt.input, tt.target)
+		if err == nil {
+			t.Fatalf("%s: expected an error", tt.input.Inspect())
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input.Inspect(), tt.expected, err.Error())
+		}
+	}
+}
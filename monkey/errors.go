@@ -0,0 +1,79 @@
+package monkey
+
+import "fmt"
+
+// ErrorKind tells in which step of running a program an Error was found
+type ErrorKind int
+
+const (
+	SyntaxError  ErrorKind = iota // the source could not be parsed
+	TypeError                     // the type checker rejected the program
+	CompileError                  // the compiler rejected the program
+	RuntimeError                  // the program stopped while running
+)
+
+// String returns the name of the kind of error as it is printed by Error.Error
+func (k ErrorKind) String() string {
+	switch k {
+	case SyntaxError:
+		return "syntax error"
+	case TypeError:
+		return "type error"
+	case CompileError:
+		return "compile error"
+	case RuntimeError:
+		return "runtime error"
+	default:
+		return "error"
+	}
+}
+
+// Error is an error found while running a program, along with the position in the source where
+// it was found. Line and Column start at 1, they are 0 when the position is unknown.
+// Err is the error a runtime error originates from, if any: errors.Is finds context.Canceled,
+// context.DeadlineExceeded or object.ErrStepLimit through the Error of a program that was stopped.
+type Error struct {
+	Kind    ErrorKind
+	Line    int
+	Column  int
+	Message string
+	Err     error
+}
+
+// Error returns the message of the Error prefixed with its position and kind (line:column: kind: message)
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Kind, e.Message)
+}
+
+// Unwrap returns the error the Error originates from
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList is returned when parsing or type checking a program finds several errors at once
+type ErrorList []*Error
+
+// Error returns the first error of the list and the number of the others
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	case 2:
+		return l[0].Error() + " (and 1 more error)"
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", l[0].Error(), len(l)-1)
+	}
+}
+
+// Unwrap returns the first error of the list, so errors.As finds it
+func (l ErrorList) Unwrap() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l[0]
+}
@@ -0,0 +1,149 @@
+package monkey
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	runtimeType = reflect.TypeOf((*object.Runtime)(nil)).Elem()
+)
+
+// NewFunc wraps the Go function fn into a builtin function Monkey programs can call, name is used
+// in the error messages. The arguments are converted with FromObject, a parameter of type
+// object.Object receives the argument as it is. A first parameter of type object.Runtime receives
+// the runtime calling the builtin, fn can use it to call the Monkey functions it is passed.
+// Variadic functions are supported.
+//
+// fn can return nothing, a value, an error, or a value and an error. The value is converted with
+// ToObject, a non-nil error is returned to the program as a Monkey error. Wrong arguments are
+// reported to the program like those of the other builtin functions, and so is a panic of fn.
+func NewFunc(name string, fn interface{}) (*object.Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("%s must be a function, got %T", name, fn)
+	}
+	return newFunc(name, v)
+}
+
+// newFunc wraps the Go function fn into a builtin function (see NewFunc)
+func newFunc(name string, fn reflect.Value) (*object.Builtin, error) {
+	t := fn.Type()
+
+	switch {
+	case t.NumOut() > 2:
+		return nil, fmt.Errorf("%s must return at most a value and an error, got %s", name, t)
+	case t.NumOut() == 2 && t.Out(1) != errorType:
+		return nil, fmt.Errorf("the second result of %s must be an error, got %s", name, t)
+	}
+
+	params := make([]reflect.Type, t.NumIn())
+	for i := range params {
+		params[i] = t.In(i)
+	}
+
+	withRuntime := len(params) > 0 && params[0] == runtimeType
+	if withRuntime {
+		params = params[1:]
+	}
+
+	// the number of the arguments that must be given, a variadic function takes more
+	want := len(params)
+	if t.IsVariadic() {
+		want--
+	}
+
+	call := func(rt object.Runtime, args ...object.Object) (result object.Object) {
+		defer func() {
+			if r := recover(); r != nil {
+				result = newError("error in `%s`: %v", name, r)
+			}
+		}()
+
+		switch {
+		case t.IsVariadic() && len(args) < want:
+			return newError("wrong number of arguments. got=%d, want at least %d", len(args), want)
+		case !t.IsVariadic() && len(args) != want:
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+		}
+
+		in := make([]reflect.Value, 0, len(args)+1)
+		if withRuntime {
+			in = append(in, reflect.ValueOf(&rt).Elem())
+		}
+
+		for i, arg := range args {
+			var param reflect.Type
+			if i < want {
+				param = params[i]
+			} else {
+				param = params[want].Elem()
+			}
+
+			value := reflect.New(param).Elem()
+			if err := fromObject(arg, value); err != nil {
+				if typeName(param) == string(arg.Type()) {
+					return newError("argument %d to `%s`: %s", i+1, name, err)
+				}
+				return newError("argument %d to `%s` must be %s, got %s", i+1, name, typeName(param), arg.Type())
+			}
+			in = append(in, value)
+		}
+
+		return results(fn.Call(in))
+	}
+
+	return &object.Builtin{Fn: call}, nil
+}
+
+// results converts the results of a Go function wrapped by NewFunc into a Monkey object
+func results(out []reflect.Value) object.Object {
+	if len(out) == 0 {
+		return object.NULL
+	}
+
+	last := out[len(out)-1]
+	if last.Type() == errorType {
+		if !last.IsNil() {
+			return &object.Error{Message: last.Interface().(error).Error()}
+		}
+		if len(out) == 1 {
+			return object.NULL
+		}
+	}
+
+	result, err := toObject(out[0], visiting{})
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return result
+}
+
+// typeName returns the name of the Monkey type the Go type t is converted from
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return string(object.BOOLEAN_OBJ)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return string(object.INTEGER_OBJ)
+	case reflect.String:
+		return string(object.STRING_OBJ)
+	case reflect.Slice, reflect.Array:
+		return string(object.ARRAY_OBJ)
+	case reflect.Map, reflect.Struct:
+		return string(object.HASH_OBJ)
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	default:
+		return t.String()
+	}
+}
+
+// newError returns a Monkey error with the formatted message
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
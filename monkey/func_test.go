@@ -0,0 +1,125 @@
+package monkey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+func TestBind(t *testing.T) {
+	interpreter := New()
+
+	bindings := map[string]interface{}{
+		"add":    func(a, b int) int { return a + b },
+		"join":   func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"origin": point{Label: "origin"},
+		"names":  []string{"a", "b"},
+		"divide": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return a / b, nil
+		},
+		"check": func(ok bool) error {
+			if !ok {
+				return errors.New("check failed")
+			}
+			return nil
+		},
+		"first": func(p []point) point { return p[0] },
+		"apply": func(rt object.Runtime, fn object.Object, n int) object.Object {
+			return rt.Apply(fn, &object.Integer{Value: int64(n)})
+		},
+		"nothing": func() {},
+		"explode": func() int { panic("boom") },
+	}
+	for name, value := range bindings {
+		if err := interpreter.Bind(name, value); err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`add(1, 2)`, "3"},
+		{`join("-")`, ""},
+		{`join("-", "a", "b", "c")`, "a-b-c"},
+		{`origin["label"]`, "origin"},
+		{`names[1]`, "b"},
+		{`divide(7, 2)`, "3"},
+		{`str(divide(1, 0))`, "ERROR: division by zero"},
+		{`check(true)`, "null"},
+		{`str(check(false))`, "ERROR: check failed"},
+		{`first([{"X": 1, "Y": 2}])["Y"]`, "2"},
+		{`apply(fn(n) { n * 2 }, 21)`, "42"},
+		{`nothing()`, "null"},
+	}
+
+	for _, tt := range tests {
+		result, err := interpreter.Eval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`add(1)`, "runtime error: wrong number of arguments. got=1, want=2"},
+		{`join()`, "runtime error: wrong number of arguments. got=0, want at least 1"},
+		{`add(1, "2")`, "runtime error: argument 2 to `add` must be INTEGER, got STRING"},
+		{`join("-", "a", 1)`, "runtime error: argument 3 to `join` must be STRING, got INTEGER"},
+		{`first([1])`, "runtime error: argument 1 to `first`: cannot convert INTEGER to monkey.point"},
+		{`divide(1, 0)`, "runtime error: division by zero"},
+		{`explode()`, "runtime error: error in `explode`: boom"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := interpreter.Eval(tt.input)
+		if err == nil {
+			t.Fatalf("%q: expected an error", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestNewFunc(t *testing.T) {
+	builtin, err := NewFunc("square", func(n int) int { return n * n })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result := builtin.Fn(nil, &object.Integer{Value: 9})
+	if result.Inspect() != "81" {
+		t.Errorf("wrong result. want=81, got=%s", result.Inspect())
+	}
+
+	invalid := []struct {
+		fn       interface{}
+		expected string
+	}{
+		{42, "f must be a function, got int"},
+		{func() (int, int) { return 0, 0 }, "the second result of f must be an error, got func() (int, int)"},
+		{func() (int, int, error) { return 0, 0, nil }, "f must return at most a value and an error, got func() (int, int, error)"},
+	}
+
+	for _, tt := range invalid {
+		_, err := NewFunc("f", tt.fn)
+		if err == nil {
+			t.Fatalf("%T: expected an error", tt.fn)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%T: wrong error. want=%q, got=%q", tt.fn, tt.expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package monkey embeds Monkey into Go programs. An Interpreter parses, type checks, compiles
+// and runs Monkey source on the VM. Like the REPL, it keeps the global bindings of the programs
+// it ran, so a later program can use what an earlier one defined, and the Go program can read and
+// write these bindings or call the functions they hold.
+package monkey
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/yourfavoritedev/golang-interpreter/ast"
+	"github.com/yourfavoritedev/golang-interpreter/checker"
+	"github.com/yourfavoritedev/golang-interpreter/compiler"
+	"github.com/yourfavoritedev/golang-interpreter/lexer"
+	"github.com/yourfavoritedev/golang-interpreter/object"
+	"github.com/yourfavoritedev/golang-interpreter/parser"
+	"github.com/yourfavoritedev/golang-interpreter/vm"
+)
+
+// Interpreter runs Monkey programs sharing the same global bindings, and the same source of random
+// numbers: `random_seed` only seeds the numbers of the Interpreter it runs in.
+// It must not be used by several goroutines at once.
+type Interpreter struct {
+	builtins    *object.BuiltinSet
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     *vm.GlobalStore
+	checker     *checker.Checker
+	maxSteps    int64
+	maxMemory   int64
+	stdio       *object.IO
+	random      *object.Random
+}
+
+// New creates a new Interpreter without any global bindings besides the default builtin functions
+func New() *Interpreter {
+	return NewWithBuiltins(object.DefaultBuiltins())
+}
+
+// NewWithBuiltins creates a new Interpreter whose programs can use the builtin functions of the given set.
+// The Interpreter keeps a copy of the set, changing it afterwards does not affect the Interpreter.
+func NewWithBuiltins(builtins *object.BuiltinSet) *Interpreter {
+	builtins = builtins.Copy()
+
+	return &Interpreter{
+		builtins:    builtins,
+		symbolTable: compiler.NewSymbolTableWithBuiltins(builtins),
+		constants:   []object.Object{},
+		globals:     vm.NewGlobalStore(),
+		checker:     checker.New(),
+		random:      object.NewRandom(time.Now().UnixNano()),
+	}
+}
+
+// Program is Monkey source compiled by an Interpreter, it runs with the global bindings of the Interpreter
+type Program struct {
+	interpreter *Interpreter
+	bytecode    *compiler.Bytecode
+	hasResult   bool // whether the last statement is an expression statement
+}
+
+// Compile parses, type checks and compiles src. The global bindings src defines are known to the
+// Interpreter from now on, the programs compiled afterwards can use them. Syntax and type errors are
+// returned as an ErrorList, a compile error as an Error. Once src fails to compile, the Interpreter
+// knows none of the bindings it defines.
+func (in *Interpreter) Compile(src string) (*Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.PositionedErrors(); len(errs) != 0 {
+		list := make(ErrorList, len(errs))
+		for i, err := range errs {
+			list[i] = &Error{Kind: SyntaxError, Line: err.Line, Column: err.Column, Message: err.Message}
+		}
+		return nil, list
+	}
+
+	// the checker and the symbol table learn the bindings of src as they go through it,
+	// they are restored if it fails to compile
+	checker, symbolTable := in.checker.Copy(), in.symbolTable.Copy()
+
+	if errs := in.checker.Check(program); len(errs) != 0 {
+		in.checker, in.symbolTable = checker, symbolTable
+		list := make(ErrorList, len(errs))
+		for i, err := range errs {
+			list[i] = &Error{Kind: TypeError, Line: err.Line, Column: err.Column, Message: err.Message}
+		}
+		return nil, list
+	}
+
+	comp := compiler.NewWithState(in.symbolTable, in.constants)
+	if err := comp.Compile(program); err != nil {
+		in.checker, in.symbolTable = checker, symbolTable
+		result := &Error{Kind: CompileError, Message: err.Error()}
+		if err, ok := err.(*compiler.Error); ok {
+			result.Line, result.Column, result.Message = err.Line, err.Column, err.Message
+		}
+		return nil, result
+	}
+
+	bytecode := comp.Bytecode()
+	in.constants = bytecode.Constants
+
+	hasResult := false
+	if n := len(program.Statements); n > 0 {
+		_, hasResult = program.Statements[n-1].(*ast.ExpressionStatement)
+	}
+
+	return &Program{interpreter: in, bytecode: bytecode, hasResult: hasResult}, nil
+}
+
+// Run runs the program and returns the value of its last statement, or null if it is not an expression statement.
+// An error stopping the program, or a Monkey error value as the result, is returned as an Error.
+func (p *Program) Run() (object.Object, error) {
+	return p.RunContext(context.Background())
+}
+
+// RunContext runs the program like Run, but stops it once ctx is done or once it executed more instructions
+// than allowed by SetStepLimit, or allocated more memory than allowed by SetMemoryLimit. The Error returned
+// then wraps ctx.Err(), object.ErrStepLimit or object.ErrMemoryLimit.
+func (p *Program) RunContext(ctx context.Context) (object.Object, error) {
+	machine := vm.NewWithGlobals(p.bytecode, p.interpreter.globals)
+	machine.SetStepLimit(p.interpreter.maxSteps)
+	machine.SetMemoryLimit(p.interpreter.maxMemory)
+	machine.SetIO(p.interpreter.stdio)
+	machine.SetRandom(p.interpreter.random)
+	if err := machine.RunContext(ctx); err != nil {
+		return nil, runtimeError(err)
+	}
+
+	if !p.hasResult {
+		return vm.Null, nil
+	}
+	return result(machine.LastPoppedStackElem())
+}
+
+// Eval compiles and runs src, it returns the value of its last statement
+// (see Compile and Run for the errors it returns)
+func (in *Interpreter) Eval(src string) (object.Object, error) {
+	return in.EvalContext(context.Background(), src)
+}
+
+// EvalContext compiles and runs src like Eval, the program is stopped once ctx is done (see RunContext)
+func (in *Interpreter) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	program, err := in.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return program.RunContext(ctx)
+}
+
+// SetStepLimit sets the number of instructions every run of a program or call of a function may execute,
+// they stop with an Error wrapping object.ErrStepLimit once they executed more. A limit of 0 or less
+// removes the limit.
+func (in *Interpreter) SetStepLimit(maxSteps int64) {
+	in.maxSteps = maxSteps
+}
+
+// SetMemoryLimit sets the number of bytes every run of a program or call of a function may allocate for
+// strings, arrays, hashes and sets, they stop with an Error wrapping object.ErrMemoryLimit once they
+// allocated more. A limit of 0 or less removes the limit.
+func (in *Interpreter) SetMemoryLimit(maxMemory int64) {
+	in.maxMemory = maxMemory
+}
+
+// SetIO sets the input and output of the programs run and the functions called afterwards: `puts` writes
+// to out, `read_line` and `input` read from in. A nil in is empty and a nil out discards the output.
+// The interpreters without an IO of their own use os.Stdin and os.Stdout.
+func (in *Interpreter) SetIO(input io.Reader, output io.Writer) {
+	in.stdio = object.NewIO(input, output)
+}
+
+// SetGlobal binds name to value in the global scope, the programs compiled afterwards can use it.
+// The type checker does not know the type of value, so it checks the uses of name like those of an
+// unannotated binding.
+func (in *Interpreter) SetGlobal(name string, value object.Object) {
+	symbol, ok := in.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = in.symbolTable.Define(name)
+	}
+
+	in.globals.Set(symbol.Index, value)
+}
+
+// Bind converts the Go value to a Monkey object with ToObject and binds name to it like SetGlobal.
+// A Go function is bound as a builtin function (see NewFunc).
+func (in *Interpreter) Bind(name string, value interface{}) error {
+	var obj object.Object
+	var err error
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Func && !v.IsNil() {
+		obj, err = newFunc(name, v)
+	} else {
+		obj, err = ToObject(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	in.SetGlobal(name, obj)
+	return nil
+}
+
+// GetGlobal returns the value bound to name in the global scope, and reports whether there is one
+func (in *Interpreter) GetGlobal(name string) (object.Object, bool) {
+	symbol, ok := in.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, false
+	}
+
+	value := in.globals.Get(symbol.Index)
+	return value, value != nil
+}
+
+// Call calls the function bound to fnName with args and returns its result. The function can be
+// bound in the global scope or be a builtin function. Errors are returned like Run does.
+func (in *Interpreter) Call(fnName string, args ...object.Object) (object.Object, error) {
+	return in.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext calls the function bound to fnName like Call, the call is stopped once ctx is done (see RunContext)
+func (in *Interpreter) CallContext(ctx context.Context, fnName string, args ...object.Object) (object.Object, error) {
+	var fn object.Object
+
+	symbol, ok := in.symbolTable.Resolve(fnName)
+	switch {
+	case ok && symbol.Scope == compiler.GlobalScope && in.globals.Get(symbol.Index) != nil:
+		fn = in.globals.Get(symbol.Index)
+	case ok && symbol.Scope == compiler.BuiltinScope:
+		fn = in.builtins.At(symbol.Index)
+	default:
+		return nil, &Error{Kind: RuntimeError, Message: "undefined variable: " + fnName}
+	}
+
+	machine := vm.NewWithGlobals(&compiler.Bytecode{Constants: in.constants, Builtins: in.builtins}, in.globals)
+	machine.SetStepLimit(in.maxSteps)
+	machine.SetMemoryLimit(in.maxMemory)
+	machine.SetIO(in.stdio)
+	machine.SetRandom(in.random)
+	value, err := machine.CallContext(ctx, fn, args...)
+	if err != nil {
+		return nil, runtimeError(err)
+	}
+
+	return result(value)
+}
+
+// result returns the value a program or a call produced, null stands for no value.
+// A Monkey error value is returned as an Error.
+func result(value object.Object) (object.Object, error) {
+	if value == nil {
+		return vm.Null, nil
+	}
+
+	if err, ok := value.(*object.Error); ok {
+		return nil, &Error{Kind: RuntimeError, Message: err.Message}
+	}
+
+	return value, nil
+}
+
+// runtimeError returns the error the VM ran into as an Error
+func runtimeError(err error) error {
+	result := &Error{Kind: RuntimeError, Message: err.Error(), Err: err}
+	if err, ok := err.(*vm.Error); ok {
+		result.Line, result.Column = err.Line, err.Column
+	}
+
+	return result
+}
@@ -0,0 +1,393 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 + 2`, "3"},
+		{`let add = fn(a, b) { a + b }; add(2, 3)`, "5"},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let x = 1;`, "null"},
+		{``, "null"},
+	}
+
+	for _, tt := range tests {
+		result, err := New().Eval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestEvalKeepsGlobals(t *testing.T) {
+	interpreter := New()
+
+	for _, src := range []string{`let x = 10;`, `let double = fn(n) { n * 2 };`} {
+		if _, err := interpreter.Eval(src); err != nil {
+			t.Fatalf("%q: unexpected error: %s", src, err)
+		}
+	}
+
+	result, err := interpreter.Eval(`double(x) + 1`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "21" {
+		t.Errorf("wrong result. want=21, got=%s", result.Inspect())
+	}
+}
+
+func TestSpawnedFunctionsShareGlobals(t *testing.T) {
+	interpreter := New()
+
+	// the spawned function keeps reading x while the Go program writes it and the following programs run
+	src := `let x = 0; let done = spawn(fn() { for (i in range(20000)) { x }; 1 });`
+	if _, err := interpreter.Eval(src); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i := 1; i <= 100; i++ {
+		interpreter.SetGlobal("x", &object.Integer{Value: int64(i)})
+		if _, err := interpreter.Eval(`let y = x;`); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	result, err := interpreter.Eval(`recv(done) + y`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "101" {
+		t.Errorf("wrong result. want=101, got=%s", result.Inspect())
+	}
+}
+
+func TestCompile(t *testing.T) {
+	interpreter := New()
+	interpreter.SetGlobal("n", &object.Integer{Value: 1})
+
+	program, err := interpreter.Compile(`n + 1`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// a compiled program runs with the current values of the globals
+	for _, n := range []int64{1, 41} {
+		interpreter.SetGlobal("n", &object.Integer{Value: n})
+		result, err := program.Run()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result.(*object.Integer).Value != n+1 {
+			t.Errorf("wrong result. want=%d, got=%s", n+1, result.Inspect())
+		}
+	}
+}
+
+func TestFailedCompile(t *testing.T) {
+	interpreter := New()
+
+	tests := []struct {
+		input string
+		kind  ErrorKind
+	}{
+		{`let a = 1; let b: int = "b";`, TypeError},
+		{`let c: string = "c"; let d = missing;`, CompileError},
+	}
+
+	for _, tt := range tests {
+		_, err := interpreter.Compile(tt.input)
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != tt.kind {
+			t.Fatalf("%q: expected a %s. got=%v", tt.input, tt.kind, err)
+		}
+	}
+
+	// the programs that failed to compile define none of their bindings
+	for _, name := range []string{"a", "b", "c", "d"} {
+		_, err := interpreter.Eval(name + " + 1")
+		testError(t, err, CompileError, "1:1: compile error: undefined variable: "+name)
+
+		if _, ok := interpreter.GetGlobal(name); ok {
+			t.Errorf("expected no global %s", name)
+		}
+	}
+
+	// c is unknown to the checker as well, a new binding of it can have any type
+	result, err := interpreter.Eval(`let c: int = 3; c * 2`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "6" {
+		t.Errorf("wrong result. want=6, got=%s", result.Inspect())
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	interpreter := New()
+
+	interpreter.SetGlobal("name", &object.String{Value: "monkey"})
+	if _, err := interpreter.Eval(`let greeting = "hello " + name;`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	greeting, ok := interpreter.GetGlobal("greeting")
+	if !ok || greeting.Inspect() != "hello monkey" {
+		t.Errorf("wrong global greeting. got=%v (%t)", greeting, ok)
+	}
+
+	// setting a global again replaces its value
+	interpreter.SetGlobal("name", &object.String{Value: "world"})
+	name, _ := interpreter.GetGlobal("name")
+	if name.Inspect() != "world" {
+		t.Errorf("wrong global name. got=%s", name.Inspect())
+	}
+
+	if _, ok := interpreter.GetGlobal("missing"); ok {
+		t.Errorf("expected no global for an undefined name")
+	}
+	if _, ok := interpreter.GetGlobal("len"); ok {
+		t.Errorf("expected no global for a builtin function")
+	}
+}
+
+func TestCall(t *testing.T) {
+	interpreter := New()
+	if _, err := interpreter.Eval(`let add = fn(a, b) { a + b }; let fail = fn(x) { x + 1 };`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := interpreter.Call("add", &object.Integer{Value: 2}, &object.Integer{Value: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "5" {
+		t.Errorf("wrong result of add. want=5, got=%s", result.Inspect())
+	}
+
+	result, err = interpreter.Call("len", &object.String{Value: "four"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "4" {
+		t.Errorf("wrong result of len. want=4, got=%s", result.Inspect())
+	}
+
+	// the interpreter can still be used after a call failed
+	_, err = interpreter.Call("fail", &object.String{Value: "a"})
+	testError(t, err, RuntimeError, "1:52: runtime error: unsupported types for binary operation: STRING, INTEGER")
+
+	_, err = interpreter.Call("add", &object.Integer{Value: 1})
+	testError(t, err, RuntimeError, "runtime error: wrong number of arguments: want=2, got=1")
+
+	_, err = interpreter.Call("missing")
+	testError(t, err, RuntimeError, "runtime error: undefined variable: missing")
+
+	result, err = interpreter.Call("add", &object.Integer{Value: 1}, &object.Integer{Value: 1})
+	if err != nil || result.Inspect() != "2" {
+		t.Errorf("wrong result after a failed call. got=%v, %v", result, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		kind     ErrorKind
+		expected string
+	}{
+		{"let x 5;", SyntaxError, "1:7: syntax error: expected next token to be =, got INT instead"},
+		{"let x = 1;\nlet y: int = \"a\";", TypeError, "2:14: type error: cannot use string as int in let y"},
+		{"1 +\n  missing", CompileError, "2:3: compile error: undefined variable: missing"},
+		{"let f = fn(x) {\n  x + 1\n};\nf(\"a\")", RuntimeError, "2:5: runtime error: unsupported types for binary operation: STRING, INTEGER"},
+		{"let h = {};\nh[fn() {}]", RuntimeError, "2:2: runtime error: unusable as hash key: CLOSURE"},
+		{`len(1)`, RuntimeError, "runtime error: argument to `len` not supported, got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := New().Eval(tt.input)
+		testError(t, err, tt.kind, tt.expected)
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	_, err := New().Eval(`let = 1; let = 2;`)
+
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) < 2 {
+		t.Fatalf("expected an ErrorList of several errors. got=%v", err)
+	}
+
+	var first *Error
+	if !errors.As(err, &first) || first != list[0] {
+		t.Errorf("expected errors.As to find the first error of the list")
+	}
+
+	expected := fmt.Sprintf("%s (and %d more errors)", list[0], len(list)-1)
+	if err.Error() != expected {
+		t.Errorf("wrong message. want=%q, got=%q", expected, err.Error())
+	}
+}
+
+func testError(t *testing.T, err error, kind ErrorKind, expected string) {
+	t.Helper()
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an Error. got=%T (%v)", err, err)
+	}
+	if e.Kind != kind {
+		t.Errorf("wrong kind of error. want=%s, got=%s", kind, e.Kind)
+	}
+	if e.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, e.Error())
+	}
+}
+
+func TestNewWithBuiltins(t *testing.T) {
+	builtins := object.NewBuiltinSet()
+	greet, err := NewFunc("greet", func(name string) string { return "hello " + name })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	builtins.Define("greet", greet)
+
+	interpreter := NewWithBuiltins(builtins)
+	// the interpreter keeps its own copy of the set
+	builtins.Remove("greet")
+
+	result, err := interpreter.Eval(`greet("monkey")`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "hello monkey" {
+		t.Errorf("wrong result. want=%q, got=%q", "hello monkey", result.Inspect())
+	}
+
+	result, err = interpreter.Call("greet", &object.String{Value: "go"})
+	if err != nil || result.Inspect() != "hello go" {
+		t.Errorf("wrong result of Call. got=%v (%v)", result, err)
+	}
+
+	_, err = interpreter.Eval(`len([])`)
+	testError(t, err, CompileError, "1:1: compile error: undefined variable: len")
+}
+
+func TestLimits(t *testing.T) {
+	interpreter := New()
+	if _, err := interpreter.Eval(`let loop = fn() { for (x in range(1000000000000)) { x } };`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := interpreter.EvalContext(ctx, `loop()`)
+	// the position is the instruction the deadline interrupted, somewhere in loop
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != RuntimeError || e.Message != "context deadline exceeded" {
+		t.Fatalf("expected a runtime error. got=%v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded. got=%v", err)
+	}
+
+	interpreter.SetStepLimit(10000)
+	_, err = interpreter.Call("loop")
+	if !errors.Is(err, object.ErrStepLimit) {
+		t.Errorf("expected object.ErrStepLimit. got=%v", err)
+	}
+
+	// the limit applies to every run on its own
+	for i := 0; i < 3; i++ {
+		result, err := interpreter.Eval(`let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(100)`)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result.Inspect() != "5050" {
+			t.Errorf("wrong result. want=5050, got=%s", result.Inspect())
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	interpreter := New()
+	interpreter.SetMemoryLimit(1 << 20)
+
+	result, err := interpreter.Eval(`let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } }; len(double("ab", 10))`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.Inspect() != "2048" {
+		t.Errorf("wrong result. want=2048, got=%s", result.Inspect())
+	}
+
+	_, err = interpreter.Call("double", &object.String{Value: "ab"}, &object.Integer{Value: 40})
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != RuntimeError || e.Message != "memory limit exceeded" {
+		t.Fatalf("expected a runtime error. got=%v", err)
+	}
+	if !errors.Is(err, object.ErrMemoryLimit) {
+		t.Errorf("expected object.ErrMemoryLimit. got=%v", err)
+	}
+
+	_, err = interpreter.Eval(`let f = fn(n) { 1 + f(n + 1) }; f(0)`)
+	if !errors.Is(err, object.ErrStackOverflow) {
+		t.Errorf("expected object.ErrStackOverflow. got=%v", err)
+	}
+}
+
+func TestSetIO(t *testing.T) {
+	var out bytes.Buffer
+	interpreter := New()
+	interpreter.SetIO(strings.NewReader("1\n2\n"), &out)
+
+	if _, err := interpreter.Eval(`let echo = fn() { puts(input("> ")) }; echo()`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := interpreter.Call("echo"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := interpreter.Call("echo"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := "> 1\n> 2\n> null\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestRandomPerInterpreter(t *testing.T) {
+	seeded, other := New(), New()
+	if _, err := seeded.Eval(`random_seed(42)`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// seeding another interpreter, or the shared source, does not affect the draws of the seeded one
+	if _, err := other.Eval(`random_seed(7); random()`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	object.SeedRandom(9)
+
+	result, err := seeded.Eval(`random()`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := fmt.Sprint(object.NewRandom(42).Int63()); result.Inspect() != want {
+		t.Errorf("wrong draw. want=%s, got=%s", want, result.Inspect())
+	}
+}
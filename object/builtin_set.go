@@ -0,0 +1,95 @@
+package object
+
+// BuiltinSet is a set of named builtin functions. Every compiler, VM and evaluator can be configured
+// with a set of its own (see DefaultBuiltins), so programs running in the same Go program can use
+// different builtins.
+//
+// The compiler refers to a builtin by its index in the set, so a program must run with the set it
+// was compiled with. Defining a new builtin appends it and overriding one keeps its index. Removing a
+// builtin leaves its index empty, the programs compiled before that call it get an Error. All three are
+// safe once programs were compiled.
+type BuiltinSet struct {
+	names    []string
+	builtins []*Builtin
+	index    map[string]int
+}
+
+// NewBuiltinSet creates a BuiltinSet without any builtins
+func NewBuiltinSet() *BuiltinSet {
+	return &BuiltinSet{index: map[string]int{}}
+}
+
+// DefaultBuiltins creates a BuiltinSet holding the builtins defined in Builtins.
+// Every call returns a new set, changing it does not affect the others.
+func DefaultBuiltins() *BuiltinSet {
+	s := NewBuiltinSet()
+	for _, def := range Builtins {
+		s.Define(def.Name, def.Builtin)
+	}
+	return s
+}
+
+// Define adds the builtin to the set under name, it replaces the builtin already defined with that name
+func (s *BuiltinSet) Define(name string, builtin *Builtin) {
+	if i, ok := s.index[name]; ok {
+		s.builtins[i] = builtin
+		return
+	}
+
+	s.index[name] = len(s.names)
+	s.names = append(s.names, name)
+	s.builtins = append(s.builtins, builtin)
+}
+
+// Remove removes the builtin with the given name from the set, if there is one. The indexes of the
+// other builtins do not change, the removed one is replaced by a builtin returning an Error.
+func (s *BuiltinSet) Remove(name string) {
+	i, ok := s.index[name]
+	if !ok {
+		return
+	}
+
+	s.names[i] = ""
+	s.builtins[i] = &Builtin{
+		Fn: func(rt Runtime, args ...Object) Object {
+			return newError("builtin `%s` was removed", name)
+		},
+	}
+	delete(s.index, name)
+}
+
+// Lookup returns the builtin with the given name, and reports whether there is one
+func (s *BuiltinSet) Lookup(name string) (*Builtin, bool) {
+	i, ok := s.index[name]
+	if !ok {
+		return nil, false
+	}
+	return s.builtins[i], true
+}
+
+// At returns the builtin at index i, i must be less than Len
+func (s *BuiltinSet) At(i int) *Builtin { return s.builtins[i] }
+
+// Len returns the number of indexes in the set, the removed builtins included
+func (s *BuiltinSet) Len() int { return len(s.names) }
+
+// Names returns the names of the builtins in the order of their indexes, the name of a removed builtin is empty
+func (s *BuiltinSet) Names() []string {
+	names := make([]string, len(s.names))
+	copy(names, s.names)
+	return names
+}
+
+// Copy returns a new BuiltinSet holding the same builtins, changing one set does not affect the other
+func (s *BuiltinSet) Copy() *BuiltinSet {
+	c := &BuiltinSet{
+		names:    s.Names(),
+		builtins: make([]*Builtin, len(s.builtins)),
+		index:    make(map[string]int, len(s.index)),
+	}
+	copy(c.builtins, s.builtins)
+	for name, i := range s.index {
+		c.index[name] = i
+	}
+	return c
+}
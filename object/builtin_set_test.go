@@ -0,0 +1,77 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuiltinSet(t *testing.T) {
+	a, b, c := &Builtin{}, &Builtin{}, &Builtin{}
+
+	s := NewBuiltinSet()
+	s.Define("a", a)
+	s.Define("b", b)
+	s.Define("c", c)
+
+	if !reflect.DeepEqual(s.Names(), []string{"a", "b", "c"}) {
+		t.Fatalf("wrong names. got=%v", s.Names())
+	}
+
+	// overriding a builtin keeps its index
+	override := &Builtin{}
+	s.Define("b", override)
+	if s.Len() != 3 || s.At(1) != override {
+		t.Errorf("b was not overridden in place. names=%v", s.Names())
+	}
+
+	copied := s.Copy()
+
+	// removing a builtin keeps the indexes of the others
+	s.Remove("a")
+	s.Remove("unknown")
+	if !reflect.DeepEqual(s.Names(), []string{"", "b", "c"}) {
+		t.Fatalf("wrong names after Remove. got=%v", s.Names())
+	}
+	if builtin, ok := s.Lookup("c"); !ok || builtin != c || s.At(2) != c {
+		t.Errorf("c was not found at its index")
+	}
+	if _, ok := s.Lookup("a"); ok {
+		t.Errorf("a was not removed")
+	}
+	if err, ok := s.At(0).Fn(nil).(*Error); !ok || err.Message != "builtin `a` was removed" {
+		t.Errorf("the removed builtin did not return an error. got=%v", s.At(0).Fn(nil))
+	}
+
+	// a removed builtin can be defined again, it gets a new index
+	s.Define("a", a)
+	if builtin, ok := s.Lookup("a"); !ok || builtin != a || s.At(3) != a {
+		t.Errorf("a was not defined again")
+	}
+	s.Remove("a")
+
+	// the copy is not affected
+	if !reflect.DeepEqual(copied.Names(), []string{"a", "b", "c"}) {
+		t.Errorf("the copy was changed. got=%v", copied.Names())
+	}
+	if builtin, _ := copied.Lookup("a"); builtin != a {
+		t.Errorf("the copy lost a")
+	}
+}
+
+func TestDefaultBuiltins(t *testing.T) {
+	s := DefaultBuiltins()
+	if s.Len() != len(Builtins) {
+		t.Fatalf("wrong number of builtins. want=%d, got=%d", len(Builtins), s.Len())
+	}
+	for i, def := range Builtins {
+		if s.Names()[i] != def.Name || s.At(i) != def.Builtin {
+			t.Errorf("builtin %d is not %s", i, def.Name)
+		}
+	}
+
+	// every call returns a set of its own
+	s.Remove("len")
+	if _, ok := DefaultBuiltins().Lookup("len"); !ok {
+		t.Errorf("removing len from a set removed it from the default builtins")
+	}
+}
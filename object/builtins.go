@@ -1,6 +1,9 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
 // Builtins contains a mapping of the supported built-in functions.
 var Builtins = []struct {
@@ -10,37 +13,29 @@ var Builtins = []struct {
 	{
 		"len",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(rt Runtime, args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, want=1", len(args))
 				}
 
 				switch arg := args[0].(type) {
 				case *Array:
-					return &Integer{Value: int64(len(arg.Elements))}
+					return &Integer{Value: int64(arg.Len())}
 				case *String:
 					return &Integer{Value: int64(len(arg.Value))}
+				case *Set:
+					return &Integer{Value: int64(arg.Len())}
 				default:
 					return newError("argument to `len` not supported, got=%s", args[0].Type())
 				}
 			},
 		},
 	},
-	{
-		"puts",
-		&Builtin{
-			Fn: func(args ...Object) Object {
-				for _, arg := range args {
-					fmt.Println(arg.Inspect())
-				}
-				return nil
-			},
-		},
-	},
+	{"puts", &Builtin{Fn: builtinPuts}},
 	{
 		"first",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(rt Runtime, args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, want=1", len(args))
 				}
@@ -50,8 +45,8 @@ var Builtins = []struct {
 				}
 
 				arr := args[0].(*Array)
-				if len(arr.Elements) > 0 {
-					return arr.Elements[0]
+				if arr.Len() > 0 {
+					return arr.At(0)
 				}
 
 				return nil
@@ -61,7 +56,7 @@ var Builtins = []struct {
 	{
 		"last",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(rt Runtime, args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, want=1", len(args))
 				}
@@ -71,9 +66,9 @@ var Builtins = []struct {
 				}
 
 				arr := args[0].(*Array)
-				length := len(arr.Elements)
+				length := arr.Len()
 				if length > 0 {
-					return arr.Elements[length-1]
+					return arr.At(length - 1)
 				}
 
 				return nil
@@ -83,7 +78,7 @@ var Builtins = []struct {
 	{
 		"rest",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(rt Runtime, args ...Object) Object {
 				if len(args) != 1 {
 					return newError("wrong number of arguments. got=%d, want=1", len(args))
 				}
@@ -93,11 +88,8 @@ var Builtins = []struct {
 				}
 
 				arr := args[0].(*Array)
-				length := len(arr.Elements)
-				if length > 0 {
-					newElements := make([]Object, length-1, length-1)
-					copy(newElements, arr.Elements[1:length])
-					return &Array{Elements: newElements}
+				if arr.Len() > 0 {
+					return arr.Rest()
 				}
 
 				return nil
@@ -107,7 +99,7 @@ var Builtins = []struct {
 	{
 		"push",
 		&Builtin{
-			Fn: func(args ...Object) Object {
+			Fn: func(rt Runtime, args ...Object) Object {
 				if len(args) != 2 {
 					return newError("wrong number of arguments. got=%d, want=2", len(args))
 				}
@@ -117,16 +109,367 @@ var Builtins = []struct {
 				}
 
 				arr := args[0].(*Array)
-				length := len(arr.Elements)
+				return arr.Push(args[1])
+			},
+		},
+	},
+	{
+		"next",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
 
-				newElements := make([]Object, length+1, length+1)
-				copy(newElements, arr.Elements)
-				newElements[length] = args[1]
+				if args[0].Type() != GENERATOR_OBJ {
+					return newError("argument to `next` must be GENERATOR, got %s", args[0].Type())
+				}
+
+				value, ok := args[0].(*Generator).Next(rt)
+				if !ok {
+					return nil
+				}
 
-				return &Array{Elements: newElements}
+				return value
 			},
 		},
 	},
+	{
+		"done",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				if args[0].Type() != GENERATOR_OBJ {
+					return newError("argument to `done` must be GENERATOR, got %s", args[0].Type())
+				}
+
+				if args[0].(*Generator).Done(rt) {
+					return TRUE
+				}
+
+				return FALSE
+			},
+		},
+	},
+	{
+		"channel",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+
+				if len(args) == 0 {
+					return NewChannel(0)
+				}
+
+				size, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `channel` must be INTEGER, got %s", args[0].Type())
+				}
+
+				if size.Value < 0 {
+					return newError("channel size must not be negative, got %d", size.Value)
+				}
+
+				return NewChannel(int(size.Value))
+			},
+		},
+	},
+	{
+		"send",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				if args[0].Type() != CHANNEL_OBJ {
+					return newError("argument to `send` must be CHANNEL, got %s", args[0].Type())
+				}
+
+				limits := runtimeLimits(rt)
+				ok, interrupted := args[0].(*Channel).SendUntil(args[1], limits.Done())
+				if interrupted {
+					return newError("%s", limits.Interrupt())
+				}
+				if !ok {
+					return newError("send on closed channel")
+				}
+
+				return nil
+			},
+		},
+	},
+	{
+		"recv",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				if args[0].Type() != CHANNEL_OBJ {
+					return newError("argument to `recv` must be CHANNEL, got %s", args[0].Type())
+				}
+
+				// a closed channel produces null once it has been drained
+				limits := runtimeLimits(rt)
+				value, ok, interrupted := args[0].(*Channel).RecvUntil(limits.Done())
+				if interrupted {
+					return newError("%s", limits.Interrupt())
+				}
+				if !ok {
+					return nil
+				}
+
+				return value
+			},
+		},
+	},
+	{
+		"close",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				if args[0].Type() != CHANNEL_OBJ {
+					return newError("argument to `close` must be CHANNEL, got %s", args[0].Type())
+				}
+
+				if !args[0].(*Channel).Close() {
+					return newError("close of closed channel")
+				}
+
+				return nil
+			},
+		},
+	},
+	{
+		"select",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `select` must be ARRAY, got %s", args[0].Type())
+				}
+
+				// wait on all channels at once, the first one to produce a value wins
+				channels := args[0].(*Array).Elements()
+				cases := make([]reflect.SelectCase, len(channels))
+				for i, el := range channels {
+					ch, ok := el.(*Channel)
+					if !ok {
+						return newError("elements of `select` must be CHANNEL, got %s", el.Type())
+					}
+					cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.Ch)}
+				}
+
+				if len(cases) == 0 {
+					return newError("`select` requires at least one channel")
+				}
+
+				// the last case stops waiting once the program must stop
+				limits := runtimeLimits(rt)
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(limits.Done())})
+
+				// the result is a pair of the index of the channel and the value it produced,
+				// which is null when the channel is closed
+				chosen, value, ok := reflect.Select(cases)
+				if chosen == len(channels) {
+					return newError("%s", limits.Interrupt())
+				}
+				var received Object = NULL
+				if ok {
+					received = value.Interface().(Object)
+				}
+
+				return NewArray([]Object{&Integer{Value: int64(chosen)}, received})
+			},
+		},
+	},
+	{
+		"range",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments. got=%d, want=1, 2 or 3", len(args))
+				}
+
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					n, ok := arg.(*Integer)
+					if !ok {
+						return newError("arguments to `range` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = n.Value
+				}
+
+				// range(end) counts from 0, range(start, end) and range(start, end, step) from start
+				r := &Range{Start: 0, End: bounds[0], Step: 1}
+				if len(bounds) > 1 {
+					r.Start, r.End = bounds[0], bounds[1]
+				}
+				if len(bounds) > 2 {
+					r.Step = bounds[2]
+				}
+
+				if r.Step == 0 {
+					return newError("step of `range` must not be zero")
+				}
+
+				return r
+			},
+		},
+	},
+	{
+		"to_set",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+
+				if len(args) == 0 {
+					return NewSet(nil)
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					return NewSet(arg.Elements())
+				case *Set:
+					return arg
+				default:
+					return newError("argument to `to_set` must be ARRAY or SET, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"union",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				a, b, err := setArgs("union", args)
+				if err != nil {
+					return err
+				}
+				return a.Union(b)
+			},
+		},
+	},
+	{
+		"intersection",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				a, b, err := setArgs("intersection", args)
+				if err != nil {
+					return err
+				}
+				return a.Intersection(b)
+			},
+		},
+	},
+	{
+		"difference",
+		&Builtin{
+			Fn: func(rt Runtime, args ...Object) Object {
+				a, b, err := setArgs("difference", args)
+				if err != nil {
+					return err
+				}
+				return a.Difference(b)
+			},
+		},
+	},
+	{"map", &Builtin{Fn: builtinMap}},
+	{"filter", &Builtin{Fn: builtinFilter}},
+	{"reduce", &Builtin{Fn: builtinReduce}},
+	{"sort", &Builtin{Fn: builtinSort}},
+	{"sort_by", &Builtin{Fn: builtinSortBy}},
+	{"reverse", &Builtin{Fn: builtinReverse}},
+	{"zip", &Builtin{Fn: builtinZip}},
+	{"flatten", &Builtin{Fn: builtinFlatten}},
+	{"any", &Builtin{Fn: builtinAny}},
+	{"all", &Builtin{Fn: builtinAll}},
+	{"find", &Builtin{Fn: builtinFind}},
+	{"index_of", &Builtin{Fn: builtinIndexOf}},
+	{"contains", &Builtin{Fn: builtinContains}},
+	{"split", &Builtin{Fn: builtinSplit}},
+	{"join", &Builtin{Fn: builtinJoin}},
+	{"trim", &Builtin{Fn: builtinTrim}},
+	{"upper", &Builtin{Fn: builtinUpper}},
+	{"lower", &Builtin{Fn: builtinLower}},
+	{"replace", &Builtin{Fn: builtinReplace}},
+	{"starts_with", &Builtin{Fn: builtinStartsWith}},
+	{"ends_with", &Builtin{Fn: builtinEndsWith}},
+	{"repeat", &Builtin{Fn: builtinRepeat}},
+	{"pad_left", &Builtin{Fn: builtinPadLeft}},
+	{"pad_right", &Builtin{Fn: builtinPadRight}},
+	{"format", &Builtin{Fn: builtinFormat}},
+	{"keys", &Builtin{Fn: builtinKeys}},
+	{"values", &Builtin{Fn: builtinValues}},
+	{"has", &Builtin{Fn: builtinHas}},
+	{"set", &Builtin{Fn: builtinSet}},
+	{"delete", &Builtin{Fn: builtinDelete}},
+	{"merge", &Builtin{Fn: builtinMerge}},
+	{"entries", &Builtin{Fn: builtinEntries}},
+	{"json_parse", &Builtin{Fn: builtinJSONParse}},
+	{"json_stringify", &Builtin{Fn: builtinJSONStringify}},
+	{"abs", &Builtin{Fn: builtinAbs}},
+	{"min", &Builtin{Fn: builtinMin}},
+	{"max", &Builtin{Fn: builtinMax}},
+	{"pow", &Builtin{Fn: builtinPow}},
+	{"sqrt", &Builtin{Fn: builtinSqrt}},
+	{"div_floor", &Builtin{Fn: builtinDivFloor}},
+	{"div_ceil", &Builtin{Fn: builtinDivCeil}},
+	{"div_round", &Builtin{Fn: builtinDivRound}},
+	{"clamp", &Builtin{Fn: builtinClamp}},
+	{"sum", &Builtin{Fn: builtinSum}},
+	{"random", &Builtin{Fn: builtinRandom}},
+	{"random_int", &Builtin{Fn: builtinRandomInt}},
+	{"random_seed", &Builtin{Fn: builtinRandomSeed}},
+	{"type", &Builtin{Fn: builtinType}},
+	{"is_int", typePredicate("int")},
+	{"is_string", typePredicate("string")},
+	{"is_bool", typePredicate("bool")},
+	{"is_null", typePredicate("null")},
+	{"is_array", typePredicate("array")},
+	{"is_hash", typePredicate("hash")},
+	{"is_set", typePredicate("set")},
+	{"is_fn", typePredicate("fn")},
+	{"int", &Builtin{Fn: builtinInt}},
+	{"str", &Builtin{Fn: builtinStr}},
+	{"bool", &Builtin{Fn: builtinBool}},
+	{"read_line", &Builtin{Fn: builtinReadLine}},
+	{"input", &Builtin{Fn: builtinInput}},
+	{"spawn", &Builtin{Fn: builtinSpawn}},
+}
+
+// setArgs validates the arguments of the builtins combining two sets
+func setArgs(name string, args []Object) (*Set, *Set, *Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	a, ok := args[0].(*Set)
+	if !ok {
+		return nil, nil, newError("first argument to `%s` must be SET, got %s", name, args[0].Type())
+	}
+
+	b, ok := args[1].(*Set)
+	if !ok {
+		return nil, nil, newError("second argument to `%s` must be SET, got %s", name, args[1].Type())
+	}
+
+	return a, b, nil
 }
 
 // newError constructs a object.Error with the given format and
@@ -0,0 +1,491 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// The builtins in this file work on arrays, `index_of` and `contains` work on strings too.
+// They are implemented natively, so they walk the elements of an array once instead of
+// copying it through `rest` and `push`.
+// The builtins taking a function call back into the running engine through the Runtime.
+// They never modify the given array, a new array is returned instead.
+
+// builtinMap returns a new array holding the result of fn for each element (map(arr, fn))
+func builtinMap(rt Runtime, args ...Object) Object {
+	arr, fn, err := arrayAndFunctionArgs("map", args)
+	if err != nil {
+		return err
+	}
+
+	result := make([]Object, arr.Len())
+	for i, el := range arr.Elements() {
+		value := rt.Apply(fn, el)
+		if isError(value) {
+			return value
+		}
+		result[i] = value
+	}
+
+	return NewArray(result)
+}
+
+// builtinFilter returns a new array holding the elements for which fn returns a truthy value (filter(arr, fn))
+func builtinFilter(rt Runtime, args ...Object) Object {
+	arr, fn, err := arrayAndFunctionArgs("filter", args)
+	if err != nil {
+		return err
+	}
+
+	result := []Object{}
+	for _, el := range arr.Elements() {
+		value := rt.Apply(fn, el)
+		if isError(value) {
+			return value
+		}
+		if isTruthy(value) {
+			result = append(result, el)
+		}
+	}
+
+	return NewArray(result)
+}
+
+// builtinReduce combines the elements into a single value by calling fn with the accumulated value
+// and each element (reduce(arr, fn, initial)). Without an initial value the first element is used.
+func builtinReduce(rt Runtime, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+
+	arr, fn, err := arrayAndFunctionArgs("reduce", args[:2])
+	if err != nil {
+		return err
+	}
+
+	elements := arr.Elements()
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elements) == 0 {
+			return newError("`reduce` of empty array with no initial value")
+		}
+		acc, elements = elements[0], elements[1:]
+	}
+
+	for _, el := range elements {
+		acc = rt.Apply(fn, acc, el)
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+// builtinSort returns a new array holding the elements in ascending order (sort(arr)).
+// Integers and strings are sorted by their natural order. An optional function fn(a, b)
+// can be given to decide the order, it returns a truthy value when a comes before b.
+// Sorting is stable, equal elements keep their original order.
+func builtinSort(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `sort` must be ARRAY, got %s", args[0].Type())
+	}
+
+	result := arr.Elements()
+
+	// the first error stops calling back into the engine, the remaining comparisons are irrelevant
+	var sortErr Object
+	less := func(a, b Object) bool {
+		cmp, err := compareObjects(a, b)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		return cmp < 0
+	}
+
+	if len(args) == 2 {
+		if !isCallable(args[1]) {
+			return newError("second argument to `sort` must be FUNCTION, got %s", args[1].Type())
+		}
+		less = func(a, b Object) bool {
+			value := rt.Apply(args[1], a, b)
+			if isError(value) {
+				sortErr = value
+				return false
+			}
+			return isTruthy(value)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		return less(result[i], result[j])
+	})
+
+	if sortErr != nil {
+		return sortErr
+	}
+
+	return NewArray(result)
+}
+
+// builtinSortBy returns a new array holding the elements in ascending order of the keys fn returns
+// for them (sort_by(arr, fn)). fn is called once per element and has to return integers or strings.
+func builtinSortBy(rt Runtime, args ...Object) Object {
+	arr, fn, err := arrayAndFunctionArgs("sort_by", args)
+	if err != nil {
+		return err
+	}
+
+	type keyed struct {
+		key   Object
+		value Object
+	}
+
+	items := make([]keyed, arr.Len())
+	for i, el := range arr.Elements() {
+		key := rt.Apply(fn, el)
+		if isError(key) {
+			return key
+		}
+		items[i] = keyed{key: key, value: el}
+	}
+
+	var sortErr *Error
+	sort.SliceStable(items, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		cmp, err := compareObjects(items[i].key, items[j].key)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		return cmp < 0
+	})
+
+	if sortErr != nil {
+		return sortErr
+	}
+
+	result := make([]Object, len(items))
+	for i, item := range items {
+		result[i] = item.value
+	}
+
+	return NewArray(result)
+}
+
+// builtinReverse returns a new array holding the elements in reverse order (reverse(arr))
+func builtinReverse(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `reverse` must be ARRAY, got %s", args[0].Type())
+	}
+
+	length := arr.Len()
+	result := make([]Object, length)
+	for i, el := range arr.Elements() {
+		result[length-1-i] = el
+	}
+
+	return NewArray(result)
+}
+
+// builtinZip returns a new array of arrays, the n-th array holds the n-th element of each
+// of the given arrays (zip(a, b, ...)). The result is as long as the shortest array.
+func builtinZip(rt Runtime, args ...Object) Object {
+	if len(args) < 2 {
+		return newError("wrong number of arguments. got=%d, want at least 2", len(args))
+	}
+
+	arrays := make([]*Array, len(args))
+	length := -1
+	for i, arg := range args {
+		arr, ok := arg.(*Array)
+		if !ok {
+			return newError("arguments to `zip` must be ARRAY, got %s", arg.Type())
+		}
+		arrays[i] = arr
+		if length == -1 || arr.Len() < length {
+			length = arr.Len()
+		}
+	}
+
+	result := make([]Object, length)
+	for i := range result {
+		tuple := make([]Object, len(arrays))
+		for j, arr := range arrays {
+			tuple[j] = arr.At(i)
+		}
+		result[i] = NewArray(tuple)
+	}
+
+	return NewArray(result)
+}
+
+// builtinFlatten returns a new array in which the nested arrays are replaced by their elements
+// (flatten(arr, depth)). By default a single level of nesting is removed.
+func builtinFlatten(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `flatten` must be ARRAY, got %s", args[0].Type())
+	}
+
+	depth := int64(1)
+	if len(args) == 2 {
+		d, ok := args[1].(*Integer)
+		if !ok {
+			return newError("second argument to `flatten` must be INTEGER, got %s", args[1].Type())
+		}
+		depth = d.Value
+	}
+
+	size := flattenedLen(arr, depth, map[flattenKey]int64{})
+	if err := canAllocate(rt, mulSize(size, elementSize)); err != nil {
+		return err
+	}
+
+	return NewArray(flatten(arr.Elements(), depth, make([]Object, 0, size)))
+}
+
+// flattenKey identifies an array flattened up to a depth
+type flattenKey struct {
+	arr   *Array
+	depth int64
+}
+
+// flattenedLen returns the number of elements of arr once flattened up to depth levels deep, without
+// flattening it. The lengths of the nested arrays are remembered in lengths, an array can hold the same
+// nested array many times.
+func flattenedLen(arr *Array, depth int64, lengths map[flattenKey]int64) int64 {
+	key := flattenKey{arr, depth}
+	if n, ok := lengths[key]; ok {
+		return n
+	}
+
+	n := int64(0)
+	for _, el := range arr.Elements() {
+		if nested, ok := el.(*Array); ok && depth > 0 {
+			n = addSize(n, flattenedLen(nested, depth-1, lengths))
+			continue
+		}
+		n++
+	}
+
+	lengths[key] = n
+	return n
+}
+
+// flatten appends the elements to result, replacing nested arrays by their elements up to depth levels deep
+func flatten(elements []Object, depth int64, result []Object) []Object {
+	for _, el := range elements {
+		if nested, ok := el.(*Array); ok && depth > 0 {
+			result = flatten(nested.Elements(), depth-1, result)
+			continue
+		}
+		result = append(result, el)
+	}
+	return result
+}
+
+// builtinAny reports whether fn returns a truthy value for at least one element (any(arr, fn)).
+// It stops calling fn at the first match.
+func builtinAny(rt Runtime, args ...Object) Object {
+	arr, fn, err := arrayAndFunctionArgs("any", args)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range arr.Elements() {
+		value := rt.Apply(fn, el)
+		if isError(value) {
+			return value
+		}
+		if isTruthy(value) {
+			return TRUE
+		}
+	}
+
+	return FALSE
+}
+
+// builtinAll reports whether fn returns a truthy value for every element (all(arr, fn)).
+// It stops calling fn at the first mismatch.
+func builtinAll(rt Runtime, args ...Object) Object {
+	arr, fn, err := arrayAndFunctionArgs("all", args)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range arr.Elements() {
+		value := rt.Apply(fn, el)
+		if isError(value) {
+			return value
+		}
+		if !isTruthy(value) {
+			return FALSE
+		}
+	}
+
+	return TRUE
+}
+
+// builtinFind returns the first element for which fn returns a truthy value, or null if there is none (find(arr, fn))
+func builtinFind(rt Runtime, args ...Object) Object {
+	arr, fn, err := arrayAndFunctionArgs("find", args)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range arr.Elements() {
+		value := rt.Apply(fn, el)
+		if isError(value) {
+			return value
+		}
+		if isTruthy(value) {
+			return el
+		}
+	}
+
+	return nil
+}
+
+// builtinIndexOf returns the position of the first element holding the same value as the second argument,
+// or -1 if there is none (index_of(arr, value)). For strings it returns the byte position of the first
+// occurrence of a substring (index_of(str, sub)).
+func builtinIndexOf(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	index, err := indexOf("index_of", args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	return &Integer{Value: int64(index)}
+}
+
+// builtinContains reports whether an element holds the same value as the second argument (contains(arr, value)).
+// For strings it reports whether the second argument is a substring (contains(str, sub)).
+func builtinContains(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	index, err := indexOf("contains", args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	return nativeBoolToBoolean(index != -1)
+}
+
+// indexOf returns the position of value in the array or string collection, or -1 if it is not found
+func indexOf(name string, collection, value Object) (int, *Error) {
+	switch collection := collection.(type) {
+	case *Array:
+		for i, el := range collection.Elements() {
+			if Equal(el, value) {
+				return i, nil
+			}
+		}
+		return -1, nil
+	case *String:
+		sub, ok := value.(*String)
+		if !ok {
+			return 0, newError("second argument to `%s` must be STRING, got %s", name, value.Type())
+		}
+		return strings.Index(collection.Value, sub.Value), nil
+	default:
+		return 0, newError("first argument to `%s` must be ARRAY or STRING, got %s", name, collection.Type())
+	}
+}
+
+// arrayAndFunctionArgs validates the arguments of the builtins calling a function for the elements of an array
+func arrayAndFunctionArgs(name string, args []Object) (*Array, Object, *Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, nil, newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	if !isCallable(args[1]) {
+		return nil, nil, newError("second argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+
+	return arr, args[1], nil
+}
+
+// compareObjects compares two integers or two strings by their natural order. It returns a negative
+// number when a comes before b, zero when they are equal and a positive number when a comes after b.
+func compareObjects(a, b Object) (int, *Error) {
+	switch a := a.(type) {
+	case *Integer:
+		if b, ok := b.(*Integer); ok {
+			switch {
+			case a.Value < b.Value:
+				return -1, nil
+			case a.Value > b.Value:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+	case *String:
+		if b, ok := b.(*String); ok {
+			return strings.Compare(a.Value, b.Value), nil
+		}
+	}
+
+	return 0, newError("cannot compare %s with %s", a.Type(), b.Type())
+}
+
+// isCallable reports whether obj can be called like a function
+func isCallable(obj Object) bool {
+	switch obj.(type) {
+	case *Function, *CompiledFunction, *Closure, *Builtin, *StructType:
+		return true
+	default:
+		return false
+	}
+}
+
+// isError reports whether obj is an Error
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+// isTruthy reports whether obj counts as true in a condition, only null and false do not
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return obj != nil
+	}
+}
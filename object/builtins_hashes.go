@@ -0,0 +1,150 @@
+package object
+
+// The builtins in this file work on hashes. They never modify the given hash,
+// the builtins updating a hash return a new one instead.
+// The builtins listing the pairs of a hash produce them in insertion order.
+
+// builtinKeys returns an array of the keys of the hash (keys(hash))
+func builtinKeys(rt Runtime, args ...Object) Object {
+	hash, err := hashArg("keys", args)
+	if err != nil {
+		return err
+	}
+
+	pairs := hash.Pairs()
+	elements := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		elements[i] = pair.Key
+	}
+
+	return NewArray(elements)
+}
+
+// builtinValues returns an array of the values of the hash (values(hash))
+func builtinValues(rt Runtime, args ...Object) Object {
+	hash, err := hashArg("values", args)
+	if err != nil {
+		return err
+	}
+
+	pairs := hash.Pairs()
+	elements := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		elements[i] = pair.Value
+	}
+
+	return NewArray(elements)
+}
+
+// builtinEntries returns an array of [key, value] pairs of the hash (entries(hash))
+func builtinEntries(rt Runtime, args ...Object) Object {
+	hash, err := hashArg("entries", args)
+	if err != nil {
+		return err
+	}
+
+	pairs := hash.Pairs()
+	elements := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		elements[i] = NewArray([]Object{pair.Key, pair.Value})
+	}
+
+	return NewArray(elements)
+}
+
+// builtinHas reports whether the hash holds a pair for the key (has(hash, key)).
+// Unlike an index expression it tells apart missing keys and keys bound to null.
+func builtinHas(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	hash, err := hashArg("has", args[:1])
+	if err != nil {
+		return err
+	}
+
+	if !IsHashable(args[1]) {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	_, ok := hash.Get(args[1])
+	return nativeBoolToBoolean(ok)
+}
+
+// builtinSet returns a new hash holding the pairs of the hash and the key bound to the value (set(hash, key, value)).
+// A new key is added after the existing ones.
+func builtinSet(rt Runtime, args ...Object) Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+
+	hash, err := hashArg("set", args[:1])
+	if err != nil {
+		return err
+	}
+
+	result := hash.Copy()
+	if err := result.Set(args[1], args[2]); err != nil {
+		return err
+	}
+
+	return result
+}
+
+// builtinDelete returns a new hash holding the pairs of the hash except the one for the key (delete(hash, key)).
+// Deleting a missing key returns a copy of the hash.
+func builtinDelete(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	hash, err := hashArg("delete", args[:1])
+	if err != nil {
+		return err
+	}
+
+	if !IsHashable(args[1]) {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	result := hash.Copy()
+	result.Delete(args[1])
+
+	return result
+}
+
+// builtinMerge returns a new hash holding the pairs of all given hashes (merge(a, b, ...)).
+// When several hashes hold the same key, the value of the last one wins and the key keeps its first position.
+func builtinMerge(rt Runtime, args ...Object) Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+
+	result := NewHash()
+	for _, arg := range args {
+		hash, ok := arg.(*Hash)
+		if !ok {
+			return newError("arguments to `merge` must be HASH, got %s", arg.Type())
+		}
+		for _, pair := range hash.Pairs() {
+			result.Set(pair.Key, pair.Value)
+		}
+	}
+
+	return result
+}
+
+// hashArg validates the single hash argument of the builtin name
+func hashArg(name string, args []Object) (*Hash, *Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+
+	return hash, nil
+}
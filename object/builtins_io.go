@@ -0,0 +1,64 @@
+package object
+
+// The builtins in this file write to and read from the IO of the runtime calling them (see IOProvider).
+
+// builtinPuts writes every argument on a line of its own (puts(a, b, ...))
+func builtinPuts(rt Runtime, args ...Object) Object {
+	out := newStringBuilder(rt, "puts")
+	for _, arg := range args {
+		if err := writeInspect(out, arg); err != nil {
+			return err
+		}
+		out.WriteByte('\n')
+	}
+	if err := out.Err(); err != nil {
+		return err
+	}
+
+	if err := runtimeIO(rt).Write(out.String()); err != nil {
+		return newError("failed to write the output: %s", err)
+	}
+	return nil
+}
+
+// builtinReadLine reads the next line of the input, it returns null once the input is exhausted (read_line())
+func builtinReadLine(rt Runtime, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	return readLine(runtimeIO(rt))
+}
+
+// builtinInput writes the prompt, without a newline, and reads the next line of the input like
+// read_line (input(), input(prompt))
+func builtinInput(rt Runtime, args ...Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+
+	stdio := runtimeIO(rt)
+	if len(args) == 1 {
+		prompt, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `input` must be STRING, got %s", args[0].Type())
+		}
+		if err := stdio.Write(prompt.Value); err != nil {
+			return newError("failed to write the output: %s", err)
+		}
+	}
+
+	return readLine(stdio)
+}
+
+// readLine reads the next line of stdio as a String, or null once the input is exhausted
+func readLine(stdio *IO) Object {
+	line, ok, err := stdio.ReadLine()
+	if err != nil {
+		return newError("failed to read the input: %s", err)
+	}
+	if !ok {
+		return NULL
+	}
+	return &String{Value: line}
+}
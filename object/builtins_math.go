@@ -0,0 +1,373 @@
+package object
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The builtins in this file do arithmetic on integers, the only numbers in our object system.
+// Without floats, `div_floor`, `div_ceil` and `div_round` divide two integers and round the
+// quotient the way their name says, `sqrt` returns the integer square root.
+
+// Random is the source of the random builtins. It is shared by all goroutines running the same
+// program, so it is guarded by a mutex. It can be seeded with the random_seed builtin to get a
+// repeatable sequence of numbers. The runtimes can give every program a Random of its own
+// (see RandomProvider), the others share the source of SeedRandom.
+type Random struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRandom creates a Random producing the numbers of the given seed
+func NewRandom(seed int64) *Random {
+	return &Random{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Seed resets the source, the same seed produces the same numbers
+func (r *Random) Seed(seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rand = rand.New(rand.NewSource(seed))
+}
+
+// Int63 returns a random non-negative int64
+func (r *Random) Int63() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Int63()
+}
+
+// Int63n returns a random int64 from 0 up to, but not including, n which must be positive
+func (r *Random) Int63n(n int64) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Int63n(n)
+}
+
+// Uint64 returns a random uint64
+func (r *Random) Uint64() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Uint64()
+}
+
+// sharedRandom is the source of the runtimes without a Random of their own
+var sharedRandom = NewRandom(time.Now().UnixNano())
+
+// SeedRandom resets the source shared by the runtimes without a Random of their own,
+// the same seed produces the same numbers
+func SeedRandom(seed int64) {
+	sharedRandom.Seed(seed)
+}
+
+// RandomProvider is implemented by the runtimes that were given a Random of their own
+type RandomProvider interface {
+	// Random returns the source of the random builtins of the program
+	Random() *Random
+}
+
+// runtimeRandom returns the Random of the runtime, or the shared one if it does not provide one
+func runtimeRandom(rt Runtime) *Random {
+	if provider, ok := rt.(RandomProvider); ok {
+		if r := provider.Random(); r != nil {
+			return r
+		}
+	}
+	return sharedRandom
+}
+
+// builtinAbs returns the absolute value of an integer (abs(n))
+func builtinAbs(rt Runtime, args ...Object) Object {
+	ns, err := integerArgs("abs", args, 1)
+	if err != nil {
+		return err
+	}
+
+	return &Integer{Value: abs(ns[0])}
+}
+
+// builtinMin returns the smallest of the integers, given as arguments or as an array (min(a, b, ...), min(arr))
+func builtinMin(rt Runtime, args ...Object) Object {
+	return extremum("min", args, func(a, b int64) bool { return a < b })
+}
+
+// builtinMax returns the largest of the integers, given as arguments or as an array (max(a, b, ...), max(arr))
+func builtinMax(rt Runtime, args ...Object) Object {
+	return extremum("max", args, func(a, b int64) bool { return a > b })
+}
+
+// extremum implements min and max, better reports whether a should replace the current result b
+func extremum(name string, args []Object, better func(a, b int64) bool) Object {
+	if len(args) == 1 {
+		if arr, ok := args[0].(*Array); ok {
+			if arr.Len() == 0 {
+				return newError("`%s` of empty array", name)
+			}
+			args = arr.Elements()
+		}
+	}
+
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+
+	ns, err := integerArgs(name, args, len(args))
+	if err != nil {
+		return err
+	}
+
+	result := 0
+	for i, n := range ns {
+		if better(n, ns[result]) {
+			result = i
+		}
+	}
+
+	return args[result]
+}
+
+// builtinPow returns base raised to the power of exp (pow(base, exp)), exp must not be negative
+func builtinPow(rt Runtime, args ...Object) Object {
+	ns, err := integerArgs("pow", args, 2)
+	if err != nil {
+		return err
+	}
+
+	base, exp := ns[0], ns[1]
+	if exp < 0 {
+		return newError("exponent of `pow` must not be negative, got %d", exp)
+	}
+
+	// exponentiation by squaring
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+
+	return &Integer{Value: result}
+}
+
+// builtinSqrt returns the integer square root of n, the largest integer whose square is not greater than n (sqrt(n))
+func builtinSqrt(rt Runtime, args ...Object) Object {
+	ns, err := integerArgs("sqrt", args, 1)
+	if err != nil {
+		return err
+	}
+
+	n := ns[0]
+	if n < 0 {
+		return newError("argument to `sqrt` must not be negative, got %d", n)
+	}
+
+	// correct the float estimate, it can be off by one for large numbers.
+	// the squares are compared by dividing, so they can not overflow.
+	root := int64(math.Sqrt(float64(n)))
+	for root > 0 && root > n/root {
+		root--
+	}
+	for root+1 <= n/(root+1) {
+		root++
+	}
+
+	return &Integer{Value: root}
+}
+
+// builtinDivFloor divides a by b and rounds the quotient down (div_floor(a, b))
+func builtinDivFloor(rt Runtime, args ...Object) Object {
+	return divide("div_floor", args, func(q, r, b int64) int64 {
+		if r != 0 && (r < 0) != (b < 0) {
+			return q - 1
+		}
+		return q
+	})
+}
+
+// builtinDivCeil divides a by b and rounds the quotient up (div_ceil(a, b))
+func builtinDivCeil(rt Runtime, args ...Object) Object {
+	return divide("div_ceil", args, func(q, r, b int64) int64 {
+		if r != 0 && (r < 0) == (b < 0) {
+			return q + 1
+		}
+		return q
+	})
+}
+
+// builtinDivRound divides a by b and rounds the quotient to the nearest integer, halves are rounded
+// away from zero (div_round(a, b))
+func builtinDivRound(rt Runtime, args ...Object) Object {
+	return divide("div_round", args, func(q, r, b int64) int64 {
+		if 2*abs(r) < abs(b) {
+			return q
+		}
+		// the remainder has the sign of a, so the exact quotient is negative when the signs of r and b differ
+		if (r < 0) != (b < 0) {
+			return q - 1
+		}
+		return q + 1
+	})
+}
+
+// abs returns the absolute value of n
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// divide implements div_floor, div_ceil and div_round. adjust corrects the quotient q, truncated towards zero,
+// using the remainder r of dividing by b.
+func divide(name string, args []Object, adjust func(q, r, b int64) int64) Object {
+	ns, err := integerArgs(name, args, 2)
+	if err != nil {
+		return err
+	}
+
+	a, b := ns[0], ns[1]
+	if b == 0 {
+		return newError("division by zero in `%s`", name)
+	}
+
+	return &Integer{Value: adjust(a/b, a%b, b)}
+}
+
+// builtinClamp limits n to the range from lo to hi (clamp(n, lo, hi))
+func builtinClamp(rt Runtime, args ...Object) Object {
+	ns, err := integerArgs("clamp", args, 3)
+	if err != nil {
+		return err
+	}
+
+	n, lo, hi := ns[0], ns[1], ns[2]
+	if lo > hi {
+		return newError("bounds of `clamp` are reversed, got %d > %d", lo, hi)
+	}
+
+	switch {
+	case n < lo:
+		return args[1]
+	case n > hi:
+		return args[2]
+	default:
+		return args[0]
+	}
+}
+
+// builtinSum returns the sum of the integers in an array (sum(arr)), the sum of an empty array is 0
+func builtinSum(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `sum` must be ARRAY, got %s", args[0].Type())
+	}
+
+	total := int64(0)
+	for _, el := range arr.Elements() {
+		n, ok := el.(*Integer)
+		if !ok {
+			return newError("elements of `sum` must be INTEGER, got %s", el.Type())
+		}
+		total += n.Value
+	}
+
+	return &Integer{Value: total}
+}
+
+// builtinRandom returns a random non-negative integer (random()), or a random integer
+// from 0 up to, but not including, n (random(n))
+func builtinRandom(rt Runtime, args ...Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+
+	ns, err := integerArgs("random", args, len(args))
+	if err != nil {
+		return err
+	}
+
+	random := runtimeRandom(rt)
+	if len(ns) == 0 {
+		return &Integer{Value: random.Int63()}
+	}
+
+	if ns[0] <= 0 {
+		return newError("argument to `random` must be positive, got %d", ns[0])
+	}
+
+	return &Integer{Value: random.Int63n(ns[0])}
+}
+
+// builtinRandomInt returns a random integer from min up to and including max (random_int(min, max))
+func builtinRandomInt(rt Runtime, args ...Object) Object {
+	ns, err := integerArgs("random_int", args, 2)
+	if err != nil {
+		return err
+	}
+
+	lo, hi := ns[0], ns[1]
+	if lo > hi {
+		return newError("bounds of `random_int` are reversed, got %d > %d", lo, hi)
+	}
+
+	random := runtimeRandom(rt)
+
+	// the span does not fit into an int64 when the bounds are far apart,
+	// it wraps around to 0 when they are the smallest and the largest integer
+	span := uint64(hi-lo) + 1
+	if span == 0 {
+		return &Integer{Value: int64(random.Uint64())}
+	}
+	if span > math.MaxInt64 {
+		// the numbers from the last, incomplete run of span values would come up more often
+		// than the others, they are drawn again
+		limit := math.MaxUint64 - math.MaxUint64%span
+		x := random.Uint64()
+		for x >= limit {
+			x = random.Uint64()
+		}
+		return &Integer{Value: lo + int64(x%span)}
+	}
+
+	return &Integer{Value: lo + random.Int63n(int64(span))}
+}
+
+// builtinRandomSeed seeds the random builtins, the same seed produces the same numbers (random_seed(n))
+func builtinRandomSeed(rt Runtime, args ...Object) Object {
+	ns, err := integerArgs("random_seed", args, 1)
+	if err != nil {
+		return err
+	}
+
+	runtimeRandom(rt).Seed(ns[0])
+	return nil
+}
+
+// integerArgs validates that the builtin name got want arguments which are all integers and returns their values
+func integerArgs(name string, args []Object, want int) ([]int64, *Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	values := make([]int64, len(args))
+	for i, arg := range args {
+		n, ok := arg.(*Integer)
+		if !ok {
+			if len(args) == 1 {
+				return nil, newError("argument to `%s` must be INTEGER, got %s", name, arg.Type())
+			}
+			return nil, newError("arguments to `%s` must be INTEGER, got %s", name, arg.Type())
+		}
+		values[i] = n.Value
+	}
+
+	return values, nil
+}
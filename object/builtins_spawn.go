@@ -0,0 +1,28 @@
+package object
+
+// Spawner is implemented by the runtimes that can apply a function on a goroutine of its own.
+// The VM runs the function on a VM of its own and the evaluator on an environment of its own,
+// both share the globals, the IO and the limits of the program.
+type Spawner interface {
+	// Spawn applies fn with args on a goroutine of its own and returns a Channel that receives
+	// the result of fn (which can be an Error) and is closed afterwards. fn is checked before the
+	// goroutine starts, an Error is returned instead of the Channel if it cannot be spawned.
+	Spawn(fn Object, args []Object) Object
+}
+
+// builtinSpawn applies a function with the following arguments on a goroutine of its own and returns
+// the channel receiving its result (spawn(fn, args...))
+func builtinSpawn(rt Runtime, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=1 or more")
+	}
+
+	spawner, ok := rt.(Spawner)
+	if !ok {
+		return newError("`spawn` is not supported by this runtime")
+	}
+
+	rest := make([]Object, len(args)-1)
+	copy(rest, args[1:])
+	return spawner.Spawn(args[0], rest)
+}
@@ -0,0 +1,738 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The builtins in this file work on strings. Strings are immutable, so a new string is returned.
+// Positions and lengths are counted in bytes like the `len` builtin does, except for the padding
+// builtins which count unicode characters so the padded strings line up when printed.
+
+// maxStringSize is the length in bytes of the longest string a builtin builds as its result, a
+// builtin whose result would be longer returns an error. It bounds what a single call can allocate
+// when the runtime has no memory limit, the strings built by concatenating them are not bounded.
+const maxStringSize = 1 << 32
+
+// errStringTooLarge is returned by the writes to a stringBuilder whose string may not grow any further
+var errStringTooLarge = errors.New("string too large")
+
+// checkStringSize returns an error if the builtin name may not build a string of size bytes:
+// the string is longer than maxStringSize or does not fit in the memory limit of the runtime
+func checkStringSize(rt Runtime, name string, size int64) *Error {
+	if size > maxStringSize {
+		return newError("result of `%s` is too large", name)
+	}
+	return canAllocate(rt, size)
+}
+
+// stringBuilder builds the string result of the builtin name. Every write checks that the string may grow
+// (see checkStringSize), once it may not the write fails and the string stops growing. The builtins whose
+// result can be much larger than their arguments write it piece by piece, and stop when Err is not nil.
+type stringBuilder struct {
+	out  strings.Builder
+	rt   Runtime
+	name string
+	err  *Error
+}
+
+// newStringBuilder creates an empty stringBuilder for the result of the builtin name called by rt
+func newStringBuilder(rt Runtime, name string) *stringBuilder {
+	return &stringBuilder{rt: rt, name: name}
+}
+
+// grow checks that the string may grow by n bytes. The buffer of the string is doubled when it is full,
+// appending to it would grow it by a quarter at a time and allocate many more buffers along the way.
+func (b *stringBuilder) grow(n int) error {
+	if b.err == nil {
+		b.err = checkStringSize(b.rt, b.name, int64(b.out.Len())+int64(n))
+	}
+	if b.err != nil {
+		return errStringTooLarge
+	}
+	if b.out.Len()+n > b.out.Cap() {
+		b.out.Grow(n)
+	}
+	return nil
+}
+
+// Write appends p to the string, it implements io.Writer
+func (b *stringBuilder) Write(p []byte) (int, error) {
+	if err := b.grow(len(p)); err != nil {
+		return 0, err
+	}
+	return b.out.Write(p)
+}
+
+// WriteString appends s to the string
+func (b *stringBuilder) WriteString(s string) (int, error) {
+	if err := b.grow(len(s)); err != nil {
+		return 0, err
+	}
+	return b.out.WriteString(s)
+}
+
+// WriteByte appends c to the string
+func (b *stringBuilder) WriteByte(c byte) error {
+	if err := b.grow(1); err != nil {
+		return err
+	}
+	return b.out.WriteByte(c)
+}
+
+// WriteRune appends the UTF-8 encoding of r to the string
+func (b *stringBuilder) WriteRune(r rune) (int, error) {
+	if err := b.grow(utf8.RuneLen(r)); err != nil {
+		return 0, err
+	}
+	return b.out.WriteRune(r)
+}
+
+// Err returns the Error telling why the string could not grow, nil if every write succeeded
+func (b *stringBuilder) Err() *Error {
+	return b.err
+}
+
+// String returns the string built so far
+func (b *stringBuilder) String() string {
+	return b.out.String()
+}
+
+// writeInspect writes the text of obj.Inspect() to out. The arrays, hashes, sets and structs are written
+// element by element: an object referencing the same array many times can have a text far larger than
+// the memory it takes, writeInspect stops at the first element that does not fit and returns out.Err().
+func writeInspect(out *stringBuilder, obj Object) *Error {
+	if err := out.Err(); err != nil {
+		return err
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		out.WriteString("[")
+		if err := writeInspectElements(out, obj.Elements()); err != nil {
+			return err
+		}
+		out.WriteString("]")
+	case *Set:
+		out.WriteString("{")
+		if err := writeInspectElements(out, obj.elements); err != nil {
+			return err
+		}
+		out.WriteString("}")
+	case *Hash:
+		out.WriteString("{")
+		for i, pair := range obj.Pairs() {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			if err := writeInspect(out, pair.Key); err != nil {
+				return err
+			}
+			out.WriteString(": ")
+			if err := writeInspect(out, pair.Value); err != nil {
+				return err
+			}
+		}
+		out.WriteString("}")
+	case *Struct:
+		out.WriteString(obj.StructType.Name)
+		out.WriteString("{")
+		for i, name := range obj.StructType.Fields {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(name)
+			out.WriteString(": ")
+			if err := writeInspect(out, obj.Fields[i]); err != nil {
+				return err
+			}
+		}
+		out.WriteString("}")
+	default:
+		out.WriteString(obj.Inspect())
+	}
+
+	return out.Err()
+}
+
+// writeInspectElements writes the elements of an array or a set to out, separated by commas
+func writeInspectElements(out *stringBuilder, elements []Object) *Error {
+	for i, el := range elements {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		if err := writeInspect(out, el); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// builtinSplit returns an array of the substrings between each separator (split(str, sep)).
+// Without a separator the string is split around runs of whitespace.
+func builtinSplit(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	strs, err := stringArgs("split", args)
+	if err != nil {
+		return err
+	}
+
+	// the substrings share the memory of the string, only the array of them is allocated
+	var parts []string
+	if len(strs) == 1 {
+		parts = strings.Fields(strs[0])
+	} else {
+		count := strings.Count(strs[0], strs[1]) + 1
+		if err := canAllocate(rt, int64(count)*elementSize); err != nil {
+			return err
+		}
+		parts = strings.Split(strs[0], strs[1])
+	}
+
+	elements := make([]Object, len(parts))
+	for i, part := range parts {
+		elements[i] = &String{Value: part}
+	}
+
+	return NewArray(elements)
+}
+
+// builtinJoin returns the elements of an array joined into a single string, with the separator
+// placed between them (join(arr, sep)). Elements that are not strings are joined as they are printed.
+func builtinJoin(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("first argument to `join` must be ARRAY, got %s", args[0].Type())
+	}
+
+	sep := ""
+	if len(args) == 2 {
+		s, ok := args[1].(*String)
+		if !ok {
+			return newError("second argument to `join` must be STRING, got %s", args[1].Type())
+		}
+		sep = s.Value
+	}
+
+	out := newStringBuilder(rt, "join")
+	for i, el := range arr.Elements() {
+		if i > 0 {
+			out.WriteString(sep)
+		}
+		if err := writeInspect(out, el); err != nil {
+			return err
+		}
+	}
+
+	return &String{Value: out.String()}
+}
+
+// builtinTrim returns the string without leading and trailing whitespace (trim(str)).
+// When a second string is given, its characters are removed instead (trim(str, chars)).
+func builtinTrim(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	strs, err := stringArgs("trim", args)
+	if err != nil {
+		return err
+	}
+
+	if len(strs) == 1 {
+		return &String{Value: strings.TrimSpace(strs[0])}
+	}
+
+	return &String{Value: strings.Trim(strs[0], strs[1])}
+}
+
+// builtinUpper returns the string with all characters mapped to upper case (upper(str))
+func builtinUpper(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	strs, err := stringArgs("upper", args)
+	if err != nil {
+		return err
+	}
+
+	return &String{Value: strings.ToUpper(strs[0])}
+}
+
+// builtinLower returns the string with all characters mapped to lower case (lower(str))
+func builtinLower(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	strs, err := stringArgs("lower", args)
+	if err != nil {
+		return err
+	}
+
+	return &String{Value: strings.ToLower(strs[0])}
+}
+
+// builtinReplace returns the string with every occurrence of old replaced by new (replace(str, old, new)).
+// An optional count limits the number of replacements (replace(str, old, new, n)).
+func builtinReplace(rt Runtime, args ...Object) Object {
+	if len(args) != 3 && len(args) != 4 {
+		return newError("wrong number of arguments. got=%d, want=3 or 4", len(args))
+	}
+
+	strs, err := stringArgs("replace", args[:3])
+	if err != nil {
+		return err
+	}
+
+	n := int64(-1)
+	if len(args) == 4 {
+		count, ok := args[3].(*Integer)
+		if !ok {
+			return newError("fourth argument to `replace` must be INTEGER, got %s", args[3].Type())
+		}
+		n = count.Value
+	}
+
+	// strings.Count counts the replacements of an empty old string the way strings.Replace makes them
+	count := int64(strings.Count(strs[0], strs[1]))
+	if n >= 0 && n < count {
+		count = n
+	}
+	if growth := int64(len(strs[2]) - len(strs[1])); growth > 0 {
+		size := addSize(int64(len(strs[0])), mulSize(count, growth))
+		if err := checkStringSize(rt, "replace", size); err != nil {
+			return err
+		}
+	}
+
+	return &String{Value: strings.Replace(strs[0], strs[1], strs[2], int(n))}
+}
+
+// builtinStartsWith reports whether the string begins with prefix (starts_with(str, prefix))
+func builtinStartsWith(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	strs, err := stringArgs("starts_with", args)
+	if err != nil {
+		return err
+	}
+
+	return nativeBoolToBoolean(strings.HasPrefix(strs[0], strs[1]))
+}
+
+// builtinEndsWith reports whether the string ends with suffix (ends_with(str, suffix))
+func builtinEndsWith(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	strs, err := stringArgs("ends_with", args)
+	if err != nil {
+		return err
+	}
+
+	return nativeBoolToBoolean(strings.HasSuffix(strs[0], strs[1]))
+}
+
+// builtinRepeat returns the string repeated n times (repeat(str, n))
+func builtinRepeat(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `repeat` must be STRING, got %s", args[0].Type())
+	}
+
+	n, ok := args[1].(*Integer)
+	if !ok {
+		return newError("second argument to `repeat` must be INTEGER, got %s", args[1].Type())
+	}
+
+	if n.Value < 0 {
+		return newError("count of `repeat` must not be negative, got %d", n.Value)
+	}
+
+	if err := checkStringSize(rt, "repeat", mulSize(int64(len(str.Value)), n.Value)); err != nil {
+		return err
+	}
+
+	return &String{Value: strings.Repeat(str.Value, int(n.Value))}
+}
+
+// builtinPadLeft returns the string padded at the start until it is width characters long (pad_left(str, width, pad))
+func builtinPadLeft(rt Runtime, args ...Object) Object {
+	return pad(rt, "pad_left", args, true)
+}
+
+// builtinPadRight returns the string padded at the end until it is width characters long (pad_right(str, width, pad))
+func builtinPadRight(rt Runtime, args ...Object) Object {
+	return pad(rt, "pad_right", args, false)
+}
+
+// pad implements the padding builtins. The padding defaults to spaces, a longer padding is repeated
+// and cut off at width. Strings that are already width characters long are returned as they are.
+func pad(rt Runtime, name string, args []Object, left bool) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+
+	width, ok := args[1].(*Integer)
+	if !ok {
+		return newError("second argument to `%s` must be INTEGER, got %s", name, args[1].Type())
+	}
+
+	padding := " "
+	if len(args) == 3 {
+		p, ok := args[2].(*String)
+		if !ok {
+			return newError("third argument to `%s` must be STRING, got %s", name, args[2].Type())
+		}
+		if p.Value == "" {
+			return newError("padding of `%s` must not be empty", name)
+		}
+		padding = p.Value
+	}
+
+	missing := int(width.Value) - utf8.RuneCountInString(str.Value)
+	if missing <= 0 {
+		return str
+	}
+
+	// the padding is repeated as a whole, then the characters still missing are taken from its start
+	runes := []rune(padding)
+	repeats := int64(missing / len(runes))
+	rest := string(runes[:missing%len(runes)])
+	size := addSize(mulSize(repeats, int64(len(padding))), int64(len(rest)+len(str.Value)))
+	if err := checkStringSize(rt, name, size); err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	out.Grow(int(size))
+	if !left {
+		out.WriteString(str.Value)
+	}
+	for i := int64(0); i < repeats; i++ {
+		out.WriteString(padding)
+	}
+	out.WriteString(rest)
+	if left {
+		out.WriteString(str.Value)
+	}
+	return &String{Value: out.String()}
+}
+
+// builtinFormat returns the format string with its verbs replaced by the remaining arguments
+// (format("%s is %d", name, age)). It supports the verbs of Go's fmt package, integers, strings
+// and booleans are passed as their values and any other object as it is printed. An Error is
+// returned for a verb that does not suit its argument, and if the verbs and the arguments do
+// not pair up.
+func builtinFormat(rt Runtime, args ...Object) Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+
+	format, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `format` must be STRING, got %s", args[0].Type())
+	}
+
+	values := make([]interface{}, len(args)-1)
+	for i, arg := range args[1:] {
+		switch arg := arg.(type) {
+		case *Integer:
+			values[i] = arg.Value
+		case *String:
+			values[i] = arg.Value
+		case *Boolean:
+			values[i] = arg.Value
+		default:
+			text := newStringBuilder(rt, "format")
+			if err := writeInspect(text, arg); err != nil {
+				return err
+			}
+			values[i] = text.String()
+		}
+	}
+
+	// the verbs are written one by one, the text stops growing as soon as it is too large
+	out := newStringBuilder(rt, "format")
+	f := &formatter{format: format.Value, args: args[1:], values: values, used: make([]bool, len(values))}
+	for f.pos < len(f.format) {
+		text, verb, err := f.next()
+		if err != nil {
+			return err
+		}
+		out.WriteString(text)
+		if verb != nil {
+			verb.write(out)
+		}
+		if err := out.Err(); err != nil {
+			return err
+		}
+	}
+
+	used := 0
+	for _, u := range f.used {
+		if u {
+			used++
+		}
+	}
+	if used < len(values) {
+		return newError("format: too many arguments. got=%d, used=%d", len(values), used)
+	}
+
+	return &String{Value: out.String()}
+}
+
+// maxFormatWidth is the largest width or precision of a verb of Go's fmt package, larger ones are ignored
+const maxFormatWidth = 1e6
+
+// formatVerbs lists the verbs of Go's fmt package that suit the values of each type
+var formatVerbs = map[ObjectType]string{
+	INTEGER_OBJ: "bcdoOqxXUv",
+	BOOLEAN_OBJ: "tv",
+}
+
+// formatStringVerbs are the verbs that suit the strings, and the other objects passed as they are printed
+const formatStringVerbs = "sqxXv"
+
+// formatter splits a format string of Go's fmt package into its text and its verbs, pos is the position of
+// the next one. The verbs take the values of the arguments in turn starting at arg, an argument index ([n])
+// selects another one. used records the arguments a verb took.
+type formatter struct {
+	format string
+	pos    int
+	args   []Object
+	values []interface{}
+	used   []bool
+	arg    int
+}
+
+// formatVerb is a verb of a format string along with the values it takes. The width is left out of
+// the verb, fmt would build the padding in a buffer of its own (see write).
+type formatVerb struct {
+	flags    string // "%" and the flags
+	rest     string // the precision and the verb character
+	operands []interface{}
+	width    int
+}
+
+// next returns the text or the verb at the current position, the text of "%%" is "%".
+// An Error is returned if the verb is malformed or does not suit its argument.
+func (f *formatter) next() (string, *formatVerb, *Error) {
+	if f.format[f.pos] != '%' {
+		end := strings.IndexByte(f.format[f.pos:], '%')
+		if end < 0 {
+			end = len(f.format) - f.pos
+		}
+		f.pos += end
+		return f.format[f.pos-end : f.pos], nil, nil
+	}
+
+	start := f.pos
+	f.pos++
+	for f.pos < len(f.format) && strings.IndexByte("+-# 0", f.format[f.pos]) >= 0 {
+		f.pos++
+	}
+	verb := &formatVerb{flags: f.format[start:f.pos], operands: []interface{}{}}
+
+	f.argIndex()
+	if f.pos < len(f.format) && f.format[f.pos] == '*' {
+		f.pos++
+		if width, err := f.takeInt("width"); err != nil {
+			return "", nil, err
+		} else if width < 0 {
+			verb.flags += "-"
+			verb.width = -width
+		} else {
+			verb.width = width
+		}
+	} else {
+		verb.width = f.number()
+	}
+
+	var rest strings.Builder
+	if f.pos < len(f.format) && f.format[f.pos] == '.' {
+		f.pos++
+		rest.WriteByte('.')
+		f.argIndex()
+		if f.pos < len(f.format) && f.format[f.pos] == '*' {
+			f.pos++
+			precision, err := f.takeInt("precision")
+			if err != nil {
+				return "", nil, err
+			}
+			if precision < 0 {
+				return "", nil, newError("format: precision must not be negative, got %d", precision)
+			}
+			rest.WriteString(strconv.Itoa(precision))
+		} else {
+			rest.WriteString(strconv.Itoa(f.number()))
+		}
+	}
+
+	f.argIndex()
+	if f.pos >= len(f.format) {
+		return "", nil, newError("format: missing verb at the end of the format string")
+	}
+	c, size := utf8.DecodeRuneInString(f.format[f.pos:])
+	f.pos += size
+	if c == '%' {
+		return "%", nil, nil
+	}
+
+	arg, value, ok := f.take()
+	if !ok {
+		return "", nil, newError("format: missing argument for %%%c", c)
+	}
+	verbs, ok := formatVerbs[arg.Type()]
+	if !ok {
+		verbs = formatStringVerbs
+	}
+	if !strings.ContainsRune(verbs, c) {
+		return "", nil, newError("format: %%%c cannot format %s", c, arg.Type())
+	}
+
+	rest.WriteRune(c)
+	verb.rest = rest.String()
+	verb.operands = append(verb.operands, value)
+	return "", verb, nil
+}
+
+// number reads the width or precision at the current position, 0 if there is none or if it is too large
+func (f *formatter) number() int {
+	start := f.pos
+	for f.pos < len(f.format) && isDigit(f.format[f.pos]) {
+		f.pos++
+	}
+	n, err := strconv.Atoi(f.format[start:f.pos])
+	if err != nil || n > maxFormatWidth {
+		return 0
+	}
+	return n
+}
+
+// argIndex reads an argument index ([n]) at the current position, the next value taken is then the nth one
+func (f *formatter) argIndex() {
+	if f.pos >= len(f.format) || f.format[f.pos] != '[' {
+		return
+	}
+	end := strings.IndexByte(f.format[f.pos:], ']')
+	if end < 0 {
+		return
+	}
+	n, err := strconv.Atoi(f.format[f.pos+1 : f.pos+end])
+	if err != nil {
+		return
+	}
+	f.pos += end + 1
+	f.arg = n - 1
+}
+
+// take returns the next argument and its value, it reports false if there is none left
+func (f *formatter) take() (Object, interface{}, bool) {
+	if f.arg < 0 || f.arg >= len(f.values) {
+		return nil, nil, false
+	}
+	arg, value := f.args[f.arg], f.values[f.arg]
+	f.used[f.arg] = true
+	f.arg++
+	return arg, value, true
+}
+
+// takeInt takes the next argument as the width or the precision given with a `*`
+func (f *formatter) takeInt(name string) (int, *Error) {
+	arg, value, ok := f.take()
+	if !ok {
+		return 0, newError("format: missing argument for the %s", name)
+	}
+	n, ok := value.(int64)
+	if !ok {
+		return 0, newError("format: %s must be INTEGER, got %s", name, arg.Type())
+	}
+	if n > maxFormatWidth || n < -maxFormatWidth {
+		return 0, newError("format: %s is too large, got %d", name, n)
+	}
+	return int(n), nil
+}
+
+// write formats the value of the verb to out, padded to its width. fmt pads a value with a single
+// character, placed according to the verb and its flags: formatting the value one character wider
+// tells which one and where, the rest of the padding is written there in pieces.
+func (v *formatVerb) write(out *stringBuilder) {
+	if v.width == 0 {
+		// a string printed as it is needs no formatting
+		if v.flags == "%" && (v.rest == "s" || v.rest == "v") && len(v.operands) == 1 {
+			if str, ok := v.operands[0].(string); ok {
+				out.WriteString(str)
+				return
+			}
+		}
+		fmt.Fprintf(out, v.flags+v.rest, v.operands...)
+		return
+	}
+
+	text := fmt.Sprintf(v.flags+v.rest, v.operands...)
+	missing := v.width - utf8.RuneCountInString(text)
+	if missing <= 0 {
+		out.WriteString(text)
+		return
+	}
+
+	padded := fmt.Sprintf(v.flags+strconv.Itoa(v.width-missing+1)+v.rest, v.operands...)
+	at := 0
+	for at < len(text) && text[at] == padded[at] {
+		at++
+	}
+
+	out.WriteString(text[:at])
+	padding := strings.Repeat(padded[at:at+1], 1024)
+	for ; missing > 0 && out.Err() == nil; missing -= len(padding) {
+		if missing < len(padding) {
+			padding = padding[:missing]
+		}
+		out.WriteString(padding)
+	}
+	out.WriteString(text[at:])
+}
+
+// stringArgs validates that all arguments of the builtin name are strings and returns their values
+func stringArgs(name string, args []Object) ([]string, *Error) {
+	positions := []string{"first", "second", "third"}
+
+	values := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*String)
+		if !ok {
+			if len(args) == 1 {
+				return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+			}
+			return nil, newError("%s argument to `%s` must be STRING, got %s", positions[i], name, arg.Type())
+		}
+		values[i] = s.Value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,145 @@
+package object
+
+import (
+	"errors"
+	"strconv"
+)
+
+// The builtins in this file let scripts inspect and convert the type of a value.
+// The type names are the ones used in type annotations (see the checker package),
+// so `type(x) == "int"` holds exactly for the values accepted by `let x: int`.
+
+// TypeName returns the name of the type of obj as used in type annotations. Every kind of
+// function is a "fn" and structs are named after their struct declaration.
+func TypeName(obj Object) string {
+	switch obj := obj.(type) {
+	case *Integer:
+		return "int"
+	case *String:
+		return "string"
+	case *Boolean:
+		return "bool"
+	case *Null:
+		return "null"
+	case *Array:
+		return "array"
+	case *Hash:
+		return "hash"
+	case *Set:
+		return "set"
+	case *Channel:
+		return "channel"
+	case *Generator:
+		return "generator"
+	case *Range:
+		return "range"
+	case *Error:
+		return "error"
+	case *Struct:
+		return obj.StructType.Name
+	case Iterator:
+		return "iterator"
+	default:
+		if isCallable(obj) {
+			return "fn"
+		}
+		return string(obj.Type())
+	}
+}
+
+// builtinType returns the name of the type of the value as a string (type(x))
+func builtinType(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	return &String{Value: TypeName(args[0])}
+}
+
+// typePredicate returns a builtin reporting whether the type of its argument is named name (is_int(x))
+func typePredicate(name string) *Builtin {
+	return &Builtin{
+		Fn: func(rt Runtime, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			return nativeBoolToBoolean(TypeName(args[0]) == name)
+		},
+	}
+}
+
+// builtinInt converts the value into an integer (int(x)). Strings holding a decimal integer are
+// parsed, booleans become 1 or 0. An Error is returned for any other value.
+func builtinInt(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *Boolean:
+		if arg.Value {
+			return &Integer{Value: 1}
+		}
+		return &Integer{Value: 0}
+	case *String:
+		n, err := strconv.ParseInt(arg.Value, 10, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			return newError("cannot convert %q to int: out of range", arg.Value)
+		}
+		if err != nil {
+			return newError("cannot convert %q to int", arg.Value)
+		}
+		return &Integer{Value: n}
+	default:
+		return newError("cannot convert %s to int", TypeName(arg))
+	}
+}
+
+// builtinStr converts the value into a string, as it is printed by `puts` (str(x))
+func builtinStr(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if str, ok := args[0].(*String); ok {
+		return str
+	}
+
+	out := newStringBuilder(rt, "str")
+	if err := writeInspect(out, args[0]); err != nil {
+		return err
+	}
+
+	return &String{Value: out.String()}
+}
+
+// builtinBool converts the value into a boolean (bool(x)). The strings "true" and "false" are parsed,
+// integers are true unless they are 0 and null is false. An Error is returned for any other value.
+func builtinBool(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Boolean:
+		return arg
+	case *Null:
+		return FALSE
+	case *Integer:
+		return nativeBoolToBoolean(arg.Value != 0)
+	case *String:
+		switch arg.Value {
+		case "true":
+			return TRUE
+		case "false":
+			return FALSE
+		default:
+			return newError("cannot convert %q to bool", arg.Value)
+		}
+	default:
+		return newError("cannot convert %s to bool", TypeName(arg))
+	}
+}
@@ -1,12 +1,42 @@
 package object
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 // Environment employ a hashmap to keep track of evaluated values for expressions.
 // Each value (Object) is associated with a name, typically the same name of the Identifier
 // it was original bound too.
 type Environment struct {
+	// mu guards the store, functions started with spawn can access an environment concurrently.
+	mu    sync.RWMutex
 	store map[string]Object
 	// The environment that encloses this one. Outer will be set to "nil" if no enclosing environment.
 	outer *Environment
+	// yield receives the values of the yield statements evaluated in this environment.
+	// It is only set for the environment of a generator function call.
+	yield func(Object) *Error
+	// builtins are the built-in functions available in this environment and the ones it encloses.
+	// It is only set on a root environment.
+	builtins *BuiltinSet
+	// io is the input and output of the evaluations using this environment (see SetIO).
+	// It is only set on a root environment.
+	io *IO
+	// random is the source of the random builtins of the evaluations using this environment (see SetRandom).
+	// It is only set on a root environment.
+	random *Random
+	// callDepth is the number of function calls the evaluation using this environment is nested in
+	callDepth int
+	// limits holds the *Limits bounding the evaluations using this environment (see SetLimits).
+	// The environments of an evaluation share the cell of the environment it started in, the functions
+	// started with spawn and the generators get one of their own (see DetachLimits).
+	limits *limitsCell
+}
+
+// limitsCell holds the *Limits of the environments sharing it, which can be read concurrently
+type limitsCell struct {
+	value atomic.Value
 }
 
 // Get uses the given name to find an associated Object in the Environment store.
@@ -15,7 +45,9 @@ type Environment struct {
 // This repeats and surfaces up the Environment tree until an associated Object is found
 // or when there are no enclosing Environments left (reached the root environment).
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[name]
+	e.mu.RUnlock()
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
@@ -25,14 +57,126 @@ func (e *Environment) Get(name string) (Object, bool) {
 // Set will use the given name to update the associated entry in the
 // Environment store with the new value
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
 	e.store[name] = val
+	e.mu.Unlock()
 	return val
 }
 
+// Builtins returns the set of built-in functions the root environment was created with,
+// it is nil if the root environment was created without one (see NewEnvironmentWithBuiltins).
+func (e *Environment) Builtins() *BuiltinSet {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e.builtins
+}
+
+// SetIO sets the input and output of the evaluations using the root environment of e and the
+// environments it encloses, nil restores StandardIO. It must not be called during an evaluation.
+func (e *Environment) SetIO(io *IO) {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.io = io
+}
+
+// SetRandom sets the source of the random builtins of the evaluations using the root environment of e
+// and the environments it encloses, nil restores the shared source. It must not be called during an evaluation.
+func (e *Environment) SetRandom(random *Random) {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.random = random
+}
+
+// Random returns the source of the random builtins of the evaluations using e, nil if they use the shared one
+func (e *Environment) Random() *Random {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e.random
+}
+
+// IO returns the input and output of the evaluations using e, it is StandardIO if none was set
+func (e *Environment) IO() *IO {
+	for e.outer != nil {
+		e = e.outer
+	}
+	if e.io == nil {
+		return StandardIO()
+	}
+	return e.io
+}
+
+// SetLimits sets the limits bounding the evaluations using e and the environments sharing its limits,
+// which are the environments it encloses and the ones of the functions they call. Nil removes them.
+func (e *Environment) SetLimits(limits *Limits) {
+	e.limits.value.Store(limits)
+}
+
+// Limits returns the limits bounding the evaluations using e, it is nil if there are none
+func (e *Environment) Limits() *Limits {
+	limits, _ := e.limits.value.Load().(*Limits)
+	return limits
+}
+
+// ShareLimits makes e share the limits of caller: the environment of a function call is enclosed
+// by the environment the function was defined in, but it is bound by the limits of its caller.
+func (e *Environment) ShareLimits(caller *Environment) {
+	e.limits = caller.limits
+}
+
+// DetachLimits gives e limits of its own, set to its current ones. The limits that are set afterwards on
+// the environments e shared them with do not apply to e: a function started with spawn keeps the limits of
+// the evaluation that started it once this evaluation returned and its limits are removed.
+func (e *Environment) DetachLimits() {
+	limits := e.Limits()
+	e.limits = &limitsCell{}
+	e.limits.value.Store(limits)
+}
+
+// CallDepth returns the number of function calls the evaluations using e are nested in
+func (e *Environment) CallDepth() int {
+	return e.callDepth
+}
+
+// SetCallDepth sets the number of function calls the evaluations using e are nested in,
+// the environments e encloses afterwards are nested as deep
+func (e *Environment) SetCallDepth(depth int) {
+	e.callDepth = depth
+}
+
+// SetYielder sets the function that receives the values of yield statements
+// evaluated in the Environment, making it the environment of a generator function call.
+// The function returns once the generator is resumed, or with an error if it was stopped instead.
+func (e *Environment) SetYielder(yield func(Object) *Error) {
+	e.yield = yield
+}
+
+// Yield hands val to the generator this Environment belongs to, suspending
+// the evaluation until the generator is resumed. It returns an error when the
+// Environment does not belong to a generator function call, or when the generator
+// was stopped instead of resumed, which ends the evaluation of its function body.
+func (e *Environment) Yield(val Object) *Error {
+	if e.yield == nil {
+		return newError("yield outside of generator")
+	}
+	return e.yield(val)
+}
+
 // NewEnvironment creates a new instance of an Environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, limits: &limitsCell{}}
+}
+
+// NewEnvironmentWithBuiltins creates a new root Environment whose programs can use the
+// built-in functions of the given set instead of the default ones
+func NewEnvironmentWithBuiltins(builtins *BuiltinSet) *Environment {
+	env := NewEnvironment()
+	env.builtins = builtins
+	return env
 }
 
 // NewEnclosedEnvironment extends the given Environment (outer).
@@ -54,7 +198,6 @@ func NewEnvironment() *Environment {
 */
 // The inner environment can always Get and reference the store of its outer environment
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: outer, callDepth: outer.callDepth, limits: outer.limits}
 }
@@ -0,0 +1,108 @@
+package object
+
+// Equaler is the interface implemented by objects that are compared by their value.
+// Equals reports whether other holds the same value as the object.
+type Equaler interface {
+	Equals(other Object) bool
+}
+
+// Equal reports whether a and b are equal. Objects implementing Equaler are compared by their value,
+// any other objects (functions, channels, ...) are only equal to themselves.
+// Both engines use Equal for the == and != operators, so they always agree on what is equal.
+func Equal(a, b Object) bool {
+	if eq, ok := a.(Equaler); ok {
+		return eq.Equals(b)
+	}
+	return a == b
+}
+
+// Equals reports whether other is an Integer with the same value
+func (i *Integer) Equals(other Object) bool {
+	o, ok := other.(*Integer)
+	return ok && i.Value == o.Value
+}
+
+// Equals reports whether other is a Boolean with the same value
+func (b *Boolean) Equals(other Object) bool {
+	o, ok := other.(*Boolean)
+	return ok && b.Value == o.Value
+}
+
+// Equals reports whether other is null as well
+func (n *Null) Equals(other Object) bool {
+	_, ok := other.(*Null)
+	return ok
+}
+
+// Equals reports whether other is a String with the same characters
+func (s *String) Equals(other Object) bool {
+	o, ok := other.(*String)
+	return ok && s.Value == o.Value
+}
+
+// Equals reports whether other is an Array of the same length whose elements are equal
+// to the elements of ao at the same positions
+func (ao *Array) Equals(other Object) bool {
+	o, ok := other.(*Array)
+	if !ok || ao.Len() != o.Len() {
+		return false
+	}
+
+	for i, el := range ao.Elements() {
+		if !Equal(el, o.At(i)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equals reports whether other is a Hash holding the same keys, bound to equal values.
+// The order of the keys does not matter.
+func (h *Hash) Equals(other Object) bool {
+	o, ok := other.(*Hash)
+	if !ok || h.Len() != o.Len() {
+		return false
+	}
+
+	for _, pair := range h.Pairs() {
+		value, ok := o.Get(pair.Key)
+		if !ok || !Equal(pair.Value, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equals reports whether other is a Set holding the same elements, in any order
+func (s *Set) Equals(other Object) bool {
+	o, ok := other.(*Set)
+	if !ok || s.Len() != o.Len() {
+		return false
+	}
+
+	for _, el := range s.Elements() {
+		if !o.Contains(el) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equals reports whether other is a Struct of the same struct type whose fields are equal
+func (s *Struct) Equals(other Object) bool {
+	o, ok := other.(*Struct)
+	if !ok || s.StructType != o.StructType {
+		return false
+	}
+
+	for i, field := range s.Fields {
+		if !Equal(field, o.Fields[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	point := NewStructType("Point", []string{"x", "y"})
+	other := NewStructType("Point", []string{"x", "y"})
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	fn := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&Integer{Value: 1}, &Integer{Value: 2}, false},
+		{&Boolean{Value: true}, TRUE, true},
+		{NULL, &Null{}, true},
+		{NULL, FALSE, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{&String{Value: "a"}, &String{Value: "b"}, false},
+		{&String{Value: "1"}, one, false},
+		{NewArray([]Object{one, &String{Value: "a"}}), NewArray([]Object{&Integer{Value: 1}, &String{Value: "a"}}), true},
+		{NewArray([]Object{one}), NewArray([]Object{one, two}), false},
+		{NewArray([]Object{one, two}), NewArray([]Object{two, one}), false},
+		{NewArray([]Object{NewArray([]Object{one})}), NewArray([]Object{NewArray([]Object{one})}), true},
+		{NewArray([]Object{}), NewHash(), false},
+		{hashOf(one, NewArray([]Object{two})), hashOf(one, NewArray([]Object{two})), true},
+		{hashOf(one, one, two, two), hashOf(two, two, one, one), true},
+		{hashOf(one, one), hashOf(one, two), false},
+		{hashOf(one, one), hashOf(two, one), false},
+		{hashOf(one, one), hashOf(one, one, two, two), false},
+		{NewSet([]Object{one, two}), NewSet([]Object{two, one}), true},
+		{NewSet([]Object{one}), NewSet([]Object{two}), false},
+		{point.Instantiate([]Object{one, two}), point.Instantiate([]Object{one, two}), true},
+		{point.Instantiate([]Object{one, two}), point.Instantiate([]Object{two, one}), false},
+		{point.Instantiate([]Object{one, two}), other.Instantiate([]Object{one, two}), false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d]: Equal(%s, %s) wrong. want=%t, got=%t", i, tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+		if got := Equal(tt.b, tt.a); got != tt.expected {
+			t.Errorf("tests[%d]: Equal(%s, %s) wrong. want=%t, got=%t", i, tt.b.Inspect(), tt.a.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+// hashOf constructs a new Hash binding every other object in keysAndValues to the object that follows it
+func hashOf(keysAndValues ...Object) *Hash {
+	hash := NewHash()
+	for i := 0; i < len(keysAndValues); i += 2 {
+		hash.Set(keysAndValues[i], keysAndValues[i+1])
+	}
+	return hash
+}
@@ -0,0 +1,166 @@
+package object
+
+import "math/bits"
+
+// hamtNode is a node of a persistent hash array mapped trie (HAMT), it indexes the pairs of a Hash
+// by the HashKey of their key. Nodes are never modified, the operations updating a trie return
+// a new root which shares all the nodes off the updated path with the old one.
+//
+// Every level of the trie consumes 5 bits of the HashKey's Value. The bitmap of a node tells which
+// of the 32 possible branches are present, the entries only hold the present ones. Keys whose
+// HashKeys have the same Value end up in a node below the last level, which is searched linearly.
+type hamtNode struct {
+	bitmap  uint32
+	entries []hamtEntry
+}
+
+// hamtEntry is a branch of a hamtNode, either a child node or a leaf holding the pairs
+// whose keys have the same HashKey. These keys are told apart with Equal.
+type hamtEntry struct {
+	node    *hamtNode
+	hashKey HashKey
+	slots   []hashSlot
+}
+
+// hashSlot is a pair of a Hash, pos is the position of the key in the order of the Hash
+type hashSlot struct {
+	key   Object
+	value Object
+	pos   int
+}
+
+const (
+	hamtBits     = 5
+	hamtMask     = 1<<hamtBits - 1
+	hamtMaxShift = 64 // the shift of the nodes below the last level
+)
+
+// emptyHamt is the trie without pairs
+var emptyHamt = &hamtNode{}
+
+// branch returns the bit of the branch for hashKey in a node at shift and the position of its entry
+func (n *hamtNode) branch(shift uint, hashKey HashKey) (uint32, int) {
+	bit := uint32(1) << ((hashKey.Value >> shift) & hamtMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// find returns the pairs whose keys have the HashKey hashKey
+func (n *hamtNode) find(hashKey HashKey) []hashSlot {
+	for shift := uint(0); ; shift += hamtBits {
+		if shift >= hamtMaxShift {
+			for _, e := range n.entries {
+				if e.hashKey == hashKey {
+					return e.slots
+				}
+			}
+			return nil
+		}
+
+		bit, i := n.branch(shift, hashKey)
+		if n.bitmap&bit == 0 {
+			return nil
+		}
+
+		e := n.entries[i]
+		if e.node == nil {
+			if e.hashKey == hashKey {
+				return e.slots
+			}
+			return nil
+		}
+		n = e.node
+	}
+}
+
+// put returns a copy of the node at shift where the pairs for hashKey are replaced by slots
+func (n *hamtNode) put(shift uint, hashKey HashKey, slots []hashSlot) *hamtNode {
+	leaf := hamtEntry{hashKey: hashKey, slots: slots}
+
+	if shift >= hamtMaxShift {
+		for i, e := range n.entries {
+			if e.hashKey == hashKey {
+				return &hamtNode{entries: replaceEntry(n.entries, i, leaf)}
+			}
+		}
+		return &hamtNode{entries: insertEntry(n.entries, len(n.entries), leaf)}
+	}
+
+	bit, i := n.branch(shift, hashKey)
+	if n.bitmap&bit == 0 {
+		return &hamtNode{bitmap: n.bitmap | bit, entries: insertEntry(n.entries, i, leaf)}
+	}
+
+	e := n.entries[i]
+	switch {
+	case e.node != nil:
+		leaf = hamtEntry{node: e.node.put(shift+hamtBits, hashKey, slots)}
+	case e.hashKey != hashKey:
+		// two HashKeys share the branch, they move down into a new node
+		child := emptyHamt.put(shift+hamtBits, e.hashKey, e.slots).put(shift+hamtBits, hashKey, slots)
+		leaf = hamtEntry{node: child}
+	}
+
+	return &hamtNode{bitmap: n.bitmap, entries: replaceEntry(n.entries, i, leaf)}
+}
+
+// remove returns a copy of the node at shift without the pairs for hashKey
+func (n *hamtNode) remove(shift uint, hashKey HashKey) *hamtNode {
+	if shift >= hamtMaxShift {
+		for i, e := range n.entries {
+			if e.hashKey == hashKey {
+				return &hamtNode{entries: removeEntry(n.entries, i)}
+			}
+		}
+		return n
+	}
+
+	bit, i := n.branch(shift, hashKey)
+	if n.bitmap&bit == 0 {
+		return n
+	}
+
+	e := n.entries[i]
+	if e.node == nil {
+		if e.hashKey != hashKey {
+			return n
+		}
+		return &hamtNode{bitmap: n.bitmap &^ bit, entries: removeEntry(n.entries, i)}
+	}
+
+	child := e.node.remove(shift+hamtBits, hashKey)
+	switch {
+	case child == e.node:
+		return n
+	case len(child.entries) == 0:
+		return &hamtNode{bitmap: n.bitmap &^ bit, entries: removeEntry(n.entries, i)}
+	case len(child.entries) == 1 && child.entries[0].node == nil:
+		// a single leaf moves back up
+		return &hamtNode{bitmap: n.bitmap, entries: replaceEntry(n.entries, i, child.entries[0])}
+	default:
+		return &hamtNode{bitmap: n.bitmap, entries: replaceEntry(n.entries, i, hamtEntry{node: child})}
+	}
+}
+
+// insertEntry returns a copy of entries with e inserted at position i
+func insertEntry(entries []hamtEntry, i int, e hamtEntry) []hamtEntry {
+	result := make([]hamtEntry, len(entries)+1)
+	copy(result, entries[:i])
+	result[i] = e
+	copy(result[i+1:], entries[i:])
+	return result
+}
+
+// replaceEntry returns a copy of entries with the entry at position i replaced by e
+func replaceEntry(entries []hamtEntry, i int, e hamtEntry) []hamtEntry {
+	result := make([]hamtEntry, len(entries))
+	copy(result, entries)
+	result[i] = e
+	return result
+}
+
+// removeEntry returns a copy of entries without the entry at position i
+func removeEntry(entries []hamtEntry, i int) []hamtEntry {
+	result := make([]hamtEntry, 0, len(entries)-1)
+	result = append(result, entries[:i]...)
+	return append(result, entries[i+1:]...)
+}
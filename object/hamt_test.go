@@ -0,0 +1,86 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestHashWithManyKeys(t *testing.T) {
+	hash := NewHash()
+	for i := 0; i < 5000; i++ {
+		hash.Set(&Integer{Value: int64(i)}, &Integer{Value: int64(i * 2)})
+	}
+
+	if hash.Len() != 5000 {
+		t.Fatalf("wrong length. want=5000, got=%d", hash.Len())
+	}
+
+	for i := 0; i < 5000; i += 2 {
+		hash.Delete(&Integer{Value: int64(i)})
+	}
+
+	if hash.Len() != 2500 {
+		t.Fatalf("wrong length after delete. want=2500, got=%d", hash.Len())
+	}
+
+	for i := 0; i < 5000; i++ {
+		value, ok := hash.Get(&Integer{Value: int64(i)})
+		if ok != (i%2 == 1) {
+			t.Fatalf("wrong presence of key %d. got=%t", i, ok)
+		}
+		if ok && value.(*Integer).Value != int64(i*2) {
+			t.Fatalf("wrong value of key %d. got=%s", i, value.Inspect())
+		}
+	}
+
+	for i, pair := range hash.Pairs() {
+		if pair.Key.(*Integer).Value != int64(2*i+1) {
+			t.Fatalf("wrong order of pairs at %d. got=%s", i, pair.Key.Inspect())
+		}
+	}
+}
+
+func TestHashIsPersistent(t *testing.T) {
+	hash := NewHash()
+	for i := 0; i < 100; i++ {
+		hash.Set(&Integer{Value: int64(i)}, TRUE)
+	}
+
+	updated := hash.Copy()
+	updated.Set(&Integer{Value: 5}, FALSE)
+	updated.Set(&Integer{Value: 100}, FALSE)
+	updated.Delete(&Integer{Value: 0})
+
+	if value, _ := hash.Get(&Integer{Value: 5}); value != TRUE {
+		t.Errorf("updating a copy changed the original")
+	}
+	if _, ok := hash.Get(&Integer{Value: 0}); !ok || hash.Len() != 100 {
+		t.Errorf("deleting from a copy changed the original")
+	}
+	if _, ok := hash.Get(&Integer{Value: 100}); ok {
+		t.Errorf("adding to a copy changed the original")
+	}
+
+	if value, _ := updated.Get(&Integer{Value: 5}); value != FALSE || updated.Len() != 100 {
+		t.Errorf("wrong copy after updates. got=%s", updated.Inspect())
+	}
+}
+
+func TestHashKeysWithSameValue(t *testing.T) {
+	// the HashKeys of 1 and true only differ by their type, they end up below the last level of the trie
+	hash := NewHash()
+	hash.Set(&Integer{Value: 1}, &String{Value: "one"})
+	hash.Set(TRUE, &String{Value: "true"})
+	hash.Set(&Integer{Value: 0}, &String{Value: "zero"})
+
+	if hash.Inspect() != "{1: one, true: true, 0: zero}" {
+		t.Fatalf("wrong hash. got=%s", hash.Inspect())
+	}
+
+	hash.Delete(&Integer{Value: 1})
+	if value, ok := hash.Get(TRUE); !ok || value.Inspect() != "true" {
+		t.Errorf("wrong value after delete. got=%v", value)
+	}
+	if _, ok := hash.Get(&Integer{Value: 1}); ok {
+		t.Errorf("deleted key is still part of the hash")
+	}
+}
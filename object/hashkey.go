@@ -0,0 +1,74 @@
+package object
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Arrays and hashes are usable as hash keys and set elements when all the values they hold are,
+// so scripts can use tuples like [x, y] as keys. Their HashKey is computed from their content:
+// equal arrays and equal hashes always have the same HashKey. Different values can still end up
+// with the same 64-bit HashKey, so Hash and Set only use it to find candidate keys and compare
+// the candidates with Equal.
+
+// IsHashable reports whether obj is usable as a hash key or set element. Arrays are hashable when
+// all their elements are, hashes when all their values are.
+func IsHashable(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		for _, el := range obj.Elements() {
+			if !IsHashable(el) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		for _, pair := range obj.Pairs() {
+			if !IsHashable(pair.Value) {
+				return false
+			}
+		}
+		return true
+	case Hashable:
+		return true
+	default:
+		return false
+	}
+}
+
+// HashKey constructs an array hash-key for a Hash from the hash-keys of the elements,
+// in their order. It must only be used for arrays that are hashable (see IsHashable).
+func (ao *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	for _, el := range ao.Elements() {
+		writeHashKey(h, el)
+	}
+
+	return HashKey{Type: ao.Type(), Value: h.Sum64()}
+}
+
+// HashKey constructs a hash hash-key for a Hash from the hash-keys of its keys and values.
+// The order of the pairs does not change the hash-key, like it does not change the equality of two hashes.
+// It must only be used for hashes that are hashable (see IsHashable).
+func (h *Hash) HashKey() HashKey {
+	var value uint64
+	for _, pair := range h.Pairs() {
+		ph := fnv.New64a()
+		writeHashKey(ph, pair.Key)
+		writeHashKey(ph, pair.Value)
+		value += ph.Sum64()
+	}
+
+	return HashKey{Type: h.Type(), Value: value}
+}
+
+// writeHashKey writes the hash-key of obj to the hash h
+func writeHashKey(h interface{ Write([]byte) (int, error) }, obj Object) {
+	key := obj.(Hashable).HashKey()
+
+	var value [8]byte
+	binary.LittleEndian.PutUint64(value[:], key.Value)
+
+	h.Write([]byte(key.Type))
+	h.Write(value[:])
+}
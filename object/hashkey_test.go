@@ -0,0 +1,104 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestCompositeHashKey(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+
+	tests := []struct {
+		a, b     Hashable
+		expected bool
+	}{
+		{NewArray([]Object{one, two}), NewArray([]Object{&Integer{Value: 1}, &Integer{Value: 2}}), true},
+		{NewArray([]Object{one, two}), NewArray([]Object{two, one}), false},
+		{NewArray([]Object{NewArray([]Object{one})}), NewArray([]Object{NewArray([]Object{one})}), true},
+		{NewArray([]Object{one}), NewArray([]Object{&String{Value: "1"}}), false},
+		{hashOf(one, two, two, one), hashOf(two, one, one, two), true},
+		{hashOf(one, two), hashOf(two, one), false},
+		{&Array{}, NewHash(), false},
+	}
+
+	for _, tt := range tests {
+		if (tt.a.HashKey() == tt.b.HashKey()) != tt.expected {
+			t.Errorf("HashKey(%s) == HashKey(%s) is not %t", tt.a.(Object).Inspect(), tt.b.(Object).Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestIsHashable(t *testing.T) {
+	fn := &Builtin{}
+
+	tests := []struct {
+		obj      Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, true},
+		{&String{Value: "a"}, true},
+		{TRUE, true},
+		{NULL, false},
+		{fn, false},
+		{NewArray([]Object{&Integer{Value: 1}, &String{Value: "a"}}), true},
+		{NewArray([]Object{&Integer{Value: 1}, fn}), false},
+		{NewArray([]Object{NewArray([]Object{fn})}), false},
+		{hashOf(&String{Value: "a"}, &Array{}), true},
+		{hashOf(&String{Value: "a"}, fn), false},
+		{NewSet(nil), false},
+	}
+
+	for _, tt := range tests {
+		if IsHashable(tt.obj) != tt.expected {
+			t.Errorf("IsHashable(%s) is not %t", tt.obj.Inspect(), tt.expected)
+		}
+	}
+}
+
+// collider is a hashable object whose HashKey is the same for every value,
+// it lets the tests check that keys with the same HashKey are kept apart
+type collider struct {
+	name string
+}
+
+func (c *collider) Type() ObjectType { return "COLLIDER" }
+func (c *collider) Inspect() string  { return c.name }
+func (c *collider) HashKey() HashKey { return HashKey{Type: c.Type(), Value: 42} }
+func (c *collider) Equals(other Object) bool {
+	o, ok := other.(*collider)
+	return ok && c.name == o.name
+}
+
+func TestHashKeyCollisions(t *testing.T) {
+	a, b, c := &collider{name: "a"}, &collider{name: "b"}, &collider{name: "c"}
+
+	hash := NewHash()
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(&collider{name: "a"}, &Integer{Value: 3})
+
+	if hash.Inspect() != "{a: 3, b: 2}" {
+		t.Fatalf("colliding keys are not kept apart. got=%q", hash.Inspect())
+	}
+	if _, ok := hash.Get(c); ok {
+		t.Errorf("hash holds a key it was never given: %s", c.Inspect())
+	}
+
+	hash.Delete(a)
+	if value, ok := hash.Get(b); !ok || value.Inspect() != "2" {
+		t.Errorf("wrong value after deleting a colliding key. got=%v", value)
+	}
+	if hash.Len() != 1 {
+		t.Errorf("wrong length after delete. got=%d", hash.Len())
+	}
+
+	set := NewSet([]Object{a, b, &collider{name: "b"}}).(*Set)
+	if set.Inspect() != "{a, b}" {
+		t.Fatalf("colliding elements are not kept apart. got=%q", set.Inspect())
+	}
+	if set.Contains(c) {
+		t.Errorf("set contains an element it was never given: %s", c.Inspect())
+	}
+	if diff := set.Difference(NewSet([]Object{b}).(*Set)); diff.Inspect() != "{a}" {
+		t.Errorf("wrong difference of colliding elements. got=%q", diff.Inspect())
+	}
+}
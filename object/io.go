@@ -0,0 +1,89 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// IO is the input and output of a program: `puts` writes to it, `read_line` and `input` read from it.
+// Every VM and evaluator environment can be given an IO of its own, so the programs running in the
+// same Go program can be fed and captured separately. The runtimes without one use StandardIO.
+//
+// The functions started with spawn share the IO of their program. The writes and the reads are
+// serialized, the lines written by a call of `puts` are never interleaved with other output.
+type IO struct {
+	inMu sync.Mutex
+	in   *bufio.Reader
+
+	outMu sync.Mutex
+	out   io.Writer
+}
+
+// NewIO creates an IO reading from in and writing to out. A nil in is empty and a nil out discards
+// what is written. The IO buffers in, the program may read ahead of the lines it asked for.
+func NewIO(in io.Reader, out io.Writer) *IO {
+	if in == nil {
+		in = strings.NewReader("")
+	}
+	if out == nil {
+		out = io.Discard
+	}
+	return &IO{in: bufio.NewReader(in), out: out}
+}
+
+// stdio is the IO of the process, it is shared so the input it buffered is not lost between programs
+var stdio = NewIO(os.Stdin, os.Stdout)
+
+// StandardIO returns the IO reading from os.Stdin and writing to os.Stdout
+func StandardIO() *IO {
+	return stdio
+}
+
+// Write writes text to the output
+func (s *IO) Write(text string) error {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	_, err := io.WriteString(s.out, text)
+	return err
+}
+
+// ReadLine reads the next line of the input, without its line ending. It reports false once
+// the input is exhausted, the last line is returned even if it does not end with a newline.
+func (s *IO) ReadLine() (string, bool, error) {
+	s.inMu.Lock()
+	defer s.inMu.Unlock()
+
+	line, err := s.in.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", false, nil
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, true, nil
+}
+
+// IOProvider is implemented by the runtimes that were given an IO of their own
+type IOProvider interface {
+	// IO returns the input and output of the program
+	IO() *IO
+}
+
+// runtimeIO returns the IO of the runtime, or StandardIO if it does not provide one
+func runtimeIO(rt Runtime) *IO {
+	if provider, ok := rt.(IOProvider); ok {
+		if s := provider.IO(); s != nil {
+			return s
+		}
+	}
+	return stdio
+}
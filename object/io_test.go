@@ -0,0 +1,71 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIOReadLine(t *testing.T) {
+	stdio := NewIO(strings.NewReader("first\r\nsecond\n\nlast"), nil)
+
+	for _, expected := range []string{"first", "second", "", "last"} {
+		line, ok, err := stdio.ReadLine()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !ok || line != expected {
+			t.Fatalf("wrong line. want=%q, got=%q (%t)", expected, line, ok)
+		}
+	}
+
+	if _, ok, err := stdio.ReadLine(); ok || err != nil {
+		t.Errorf("the input should be exhausted. got=%t, %v", ok, err)
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	rt := testIORuntime{NewIO(strings.NewReader("Monkey\n"), &out)}
+
+	tests := []struct {
+		name     string
+		args     []Object
+		expected string
+	}{
+		{"puts", []Object{&String{Value: "hello"}, &Integer{Value: 1}}, "null"},
+		{"input", []Object{&String{Value: "name? "}}, "Monkey"},
+		{"read_line", nil, "null"},
+		{"input", []Object{&Integer{Value: 1}}, "ERROR: argument to `input` must be STRING, got INTEGER"},
+		{"read_line", []Object{NULL}, "ERROR: wrong number of arguments. got=1, want=0"},
+	}
+
+	builtins := DefaultBuiltins()
+	for _, tt := range tests {
+		builtin, _ := builtins.Lookup(tt.name)
+		result := builtin.Fn(rt, tt.args...)
+		if result == nil {
+			result = NULL
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.name, tt.expected, result.Inspect())
+		}
+	}
+
+	if out.String() != "hello\n1\nname? " {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+// testIORuntime is a Runtime providing an IO, it cannot apply functions
+type testIORuntime struct {
+	stdio *IO
+}
+
+func (rt testIORuntime) Apply(fn Object, args ...Object) Object {
+	return newError("not supported")
+}
+
+func (rt testIORuntime) IO() *IO {
+	return rt.stdio
+}
@@ -0,0 +1,190 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Iterable is the interface implemented by every object that can be walked by a for-in loop.
+// Iterate returns a new Iterator positioned before the first element of the object.
+type Iterable interface {
+	Iterate() Iterator
+}
+
+// Iterator is the interface that walks the elements of an Iterable. Every call to Next
+// produces the key and the value of the next element. For arrays, strings, ranges and generators
+// the key is the position of the element. Next reports false once there are no elements left.
+// rt is the runtime of the loop, the iterator of a generator runs the function body with it.
+// An Iterator is an Object so the VM can keep it on the stack while executing a loop.
+type Iterator interface {
+	Object
+	Next(rt Runtime) (key Object, value Object, ok bool)
+}
+
+// ArrayIterator is the Iterator for an Array, it produces the index and the element.
+type ArrayIterator struct {
+	array *Array
+	index int
+}
+
+// Iterate returns a new ArrayIterator for the Array
+func (ao *Array) Iterate() Iterator { return &ArrayIterator{array: ao} }
+
+// Type returns the ObjectType (ITERATOR_OBJ) associated with the referenced ArrayIterator struct
+func (ai *ArrayIterator) Type() ObjectType { return ITERATOR_OBJ }
+
+// Inspect will simply return a preformatted string for the ArrayIterator with its memory-address.
+func (ai *ArrayIterator) Inspect() string { return fmt.Sprintf("Iterator[%p]", ai) }
+
+// Next produces the index and the element at the current position of the iterator.
+func (ai *ArrayIterator) Next(rt Runtime) (Object, Object, bool) {
+	if ai.index >= ai.array.Len() {
+		return nil, nil, false
+	}
+
+	key := &Integer{Value: int64(ai.index)}
+	value := ai.array.At(ai.index)
+	ai.index++
+
+	return key, value, true
+}
+
+// HashIterator is the Iterator for a Hash, it produces the key and the value of each pair
+// in insertion order. The pairs are collected when the iterator is created, so updating
+// the hash while iterating does not affect the iteration.
+type HashIterator struct {
+	pairs []HashPair
+	index int
+}
+
+// Iterate returns a new HashIterator for the Hash
+func (h *Hash) Iterate() Iterator {
+	return &HashIterator{pairs: h.Pairs()}
+}
+
+// Type returns the ObjectType (ITERATOR_OBJ) associated with the referenced HashIterator struct
+func (hi *HashIterator) Type() ObjectType { return ITERATOR_OBJ }
+
+// Inspect will simply return a preformatted string for the HashIterator with its memory-address.
+func (hi *HashIterator) Inspect() string { return fmt.Sprintf("Iterator[%p]", hi) }
+
+// Next produces the key and the value of the pair at the current position of the iterator.
+func (hi *HashIterator) Next(rt Runtime) (Object, Object, bool) {
+	if hi.index >= len(hi.pairs) {
+		return nil, nil, false
+	}
+
+	pair := hi.pairs[hi.index]
+	hi.index++
+
+	return pair.Key, pair.Value, true
+}
+
+// StringIterator is the Iterator for a String, it produces the index and the character (as a String)
+// of each unicode character in the string.
+type StringIterator struct {
+	value string
+	pos   int // the byte position of the next character
+	index int // the index of the next character
+}
+
+// Iterate returns a new StringIterator for the String
+func (s *String) Iterate() Iterator { return &StringIterator{value: s.Value} }
+
+// Type returns the ObjectType (ITERATOR_OBJ) associated with the referenced StringIterator struct
+func (si *StringIterator) Type() ObjectType { return ITERATOR_OBJ }
+
+// Inspect will simply return a preformatted string for the StringIterator with its memory-address.
+func (si *StringIterator) Inspect() string { return fmt.Sprintf("Iterator[%p]", si) }
+
+// Next produces the index and the character at the current position of the iterator.
+func (si *StringIterator) Next(rt Runtime) (Object, Object, bool) {
+	if si.pos >= len(si.value) {
+		return nil, nil, false
+	}
+
+	_, size := utf8.DecodeRuneInString(si.value[si.pos:])
+	key := &Integer{Value: int64(si.index)}
+	value := &String{Value: si.value[si.pos : si.pos+size]}
+	si.pos += size
+	si.index++
+
+	return key, value, true
+}
+
+// Range is the referenced struct for ranges of integers in our object system (see the range builtin).
+// It holds the integers from Start up to, but not including, End, counting by Step.
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+// Type returns the ObjectType (RANGE_OBJ) associated with the referenced Range struct
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+
+// Inspect returns the Range as the call to the builtin that creates it
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+// Iterate returns a new RangeIterator for the Range
+func (r *Range) Iterate() Iterator { return &RangeIterator{r: r, current: r.Start} }
+
+// RangeIterator is the Iterator for a Range, it produces the position and the integer.
+type RangeIterator struct {
+	r       *Range
+	current int64
+	index   int64
+}
+
+// Type returns the ObjectType (ITERATOR_OBJ) associated with the referenced RangeIterator struct
+func (ri *RangeIterator) Type() ObjectType { return ITERATOR_OBJ }
+
+// Inspect will simply return a preformatted string for the RangeIterator with its memory-address.
+func (ri *RangeIterator) Inspect() string { return fmt.Sprintf("Iterator[%p]", ri) }
+
+// Next produces the position and the integer at the current position of the iterator.
+func (ri *RangeIterator) Next(rt Runtime) (Object, Object, bool) {
+	if (ri.r.Step > 0 && ri.current >= ri.r.End) || (ri.r.Step < 0 && ri.current <= ri.r.End) {
+		return nil, nil, false
+	}
+
+	key := &Integer{Value: ri.index}
+	value := &Integer{Value: ri.current}
+	ri.current += ri.r.Step
+	ri.index++
+
+	return key, value, true
+}
+
+// GeneratorIterator is the Iterator for a Generator, it produces the position and the yielded value.
+// Generators are how user-defined iterables are written: any function containing a yield statement
+// returns a Generator when called, and its yielded values can be walked by a for-in loop.
+type GeneratorIterator struct {
+	g     *Generator
+	index int64
+}
+
+// Iterate returns a new GeneratorIterator for the Generator. Generators can only be walked once,
+// so the iterator continues from the values that have not been produced yet.
+func (g *Generator) Iterate() Iterator { return &GeneratorIterator{g: g} }
+
+// Type returns the ObjectType (ITERATOR_OBJ) associated with the referenced GeneratorIterator struct
+func (gi *GeneratorIterator) Type() ObjectType { return ITERATOR_OBJ }
+
+// Inspect will simply return a preformatted string for the GeneratorIterator with its memory-address.
+func (gi *GeneratorIterator) Inspect() string { return fmt.Sprintf("Iterator[%p]", gi) }
+
+// Next resumes the generator and produces the position and the yielded value.
+func (gi *GeneratorIterator) Next(rt Runtime) (Object, Object, bool) {
+	value, ok := gi.g.Next(rt)
+	if !ok {
+		return nil, nil, false
+	}
+
+	key := &Integer{Value: gi.index}
+	gi.index++
+
+	return key, value, true
+}
@@ -0,0 +1,60 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestRangeIterator(t *testing.T) {
+	tests := []struct {
+		r        *Range
+		expected []int64
+	}{
+		{&Range{Start: 0, End: 3, Step: 1}, []int64{0, 1, 2}},
+		{&Range{Start: 3, End: 0, Step: -1}, []int64{3, 2, 1}},
+		{&Range{Start: 0, End: 5, Step: 2}, []int64{0, 2, 4}},
+		{&Range{Start: 2, End: 2, Step: 1}, []int64{}},
+		{&Range{Start: 0, End: 3, Step: -1}, []int64{}},
+	}
+
+	for _, tt := range tests {
+		it := tt.r.Iterate()
+		for i, want := range tt.expected {
+			key, value, ok := it.Next(nil)
+			if !ok {
+				t.Fatalf("%s: iterator exhausted after %d elements", tt.r.Inspect(), i)
+			}
+			if key.(*Integer).Value != int64(i) {
+				t.Errorf("%s: wrong key. want=%d, got=%s", tt.r.Inspect(), i, key.Inspect())
+			}
+			if value.(*Integer).Value != want {
+				t.Errorf("%s: wrong value. want=%d, got=%s", tt.r.Inspect(), want, value.Inspect())
+			}
+		}
+
+		if _, _, ok := it.Next(nil); ok {
+			t.Errorf("%s: iterator not exhausted after %d elements", tt.r.Inspect(), len(tt.expected))
+		}
+	}
+}
+
+func TestStringIterator(t *testing.T) {
+	it := (&String{Value: "aé😀"}).Iterate()
+	expected := []string{"a", "é", "😀"}
+
+	for i, want := range expected {
+		key, value, ok := it.Next(nil)
+		if !ok {
+			t.Fatalf("iterator exhausted after %d elements", i)
+		}
+		if key.(*Integer).Value != int64(i) {
+			t.Errorf("wrong key. want=%d, got=%s", i, key.Inspect())
+		}
+		if value.(*String).Value != want {
+			t.Errorf("wrong value. want=%q, got=%q", want, value.Inspect())
+		}
+	}
+
+	if _, _, ok := it.Next(nil); ok {
+		t.Errorf("iterator not exhausted")
+	}
+}
@@ -0,0 +1,528 @@
+package object
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// builtinJSONParse converts JSON text into objects (json_parse(str)). Objects become hashes, arrays
+// become arrays and JSON's strings, integers, booleans and null their counterparts in our object system.
+// Malformed input produces an Error telling the line and column of the offending character.
+func builtinJSONParse(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `json_parse` must be STRING, got %s", args[0].Type())
+	}
+
+	return ParseJSON(str.Value)
+}
+
+// builtinJSONStringify converts an object into JSON text (json_stringify(value, pretty)).
+// When pretty is true, the nested values are placed on their own lines and indented by two spaces.
+func builtinJSONStringify(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		pretty, ok := args[1].(*Boolean)
+		if !ok {
+			return newError("second argument to `json_stringify` must be BOOLEAN, got %s", args[1].Type())
+		}
+		if pretty.Value {
+			indent = "  "
+		}
+	}
+
+	return stringifyJSON(rt, args[0], indent)
+}
+
+// ParseJSON parses the JSON text input into an object. An Error is returned if input is not
+// valid JSON, or if it holds numbers that are not integers (our object system has no floats).
+func ParseJSON(input string) Object {
+	p := &jsonParser{input: input}
+
+	p.skipWhitespace()
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	p.skipWhitespace()
+	if p.pos < len(p.input) {
+		return p.unexpected()
+	}
+
+	return value
+}
+
+// maxJSONDepth is the number of arrays and objects a JSON value may be nested in. The parser
+// descends recursively, deeper input would exhaust the stack of the goroutine running it.
+const maxJSONDepth = 1000
+
+// jsonParser is a recursive descent parser for JSON text, pos is the byte position of the next character
+// and depth the number of arrays and objects enclosing it
+type jsonParser struct {
+	input string
+	pos   int
+	depth int
+}
+
+// enter descends into an array or an object, it returns an Error once they are nested too deep.
+// The caller leaves it again by decrementing depth.
+func (p *jsonParser) enter() *Error {
+	if p.depth >= maxJSONDepth {
+		return p.errorf("nesting deeper than %d levels", maxJSONDepth)
+	}
+	p.depth++
+	return nil
+}
+
+// parseValue parses the JSON value starting at the current position
+func (p *jsonParser) parseValue() (Object, *Error) {
+	if p.pos >= len(p.input) {
+		return nil, p.unexpected()
+	}
+
+	switch ch := p.input[p.pos]; {
+	case ch == '{':
+		return p.parseObject()
+	case ch == '[':
+		return p.parseArray()
+	case ch == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &String{Value: s}, nil
+	case ch == '-' || isDigit(ch):
+		return p.parseNumber()
+	case strings.HasPrefix(p.input[p.pos:], "true"):
+		p.pos += len("true")
+		return TRUE, nil
+	case strings.HasPrefix(p.input[p.pos:], "false"):
+		p.pos += len("false")
+		return FALSE, nil
+	case strings.HasPrefix(p.input[p.pos:], "null"):
+		p.pos += len("null")
+		return NULL, nil
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+// parseObject parses a JSON object into a Hash with string keys in the order they appear,
+// later duplicate keys win
+func (p *jsonParser) parseObject() (Object, *Error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	hash := NewHash()
+
+	// skip the opening brace
+	p.pos++
+	p.skipWhitespace()
+	if p.consume('}') {
+		return hash, nil
+	}
+
+	for {
+		p.skipWhitespace()
+		if p.pos >= len(p.input) || p.input[p.pos] != '"' {
+			return nil, p.unexpected()
+		}
+
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipWhitespace()
+		if !p.consume(':') {
+			return nil, p.unexpected()
+		}
+
+		p.skipWhitespace()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(&String{Value: s}, value)
+
+		p.skipWhitespace()
+		if p.consume('}') {
+			return hash, nil
+		}
+		if !p.consume(',') {
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// parseArray parses a JSON array into an Array
+func (p *jsonParser) parseArray() (Object, *Error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	elements := []Object{}
+
+	// skip the opening bracket
+	p.pos++
+	p.skipWhitespace()
+	if p.consume(']') {
+		return NewArray(elements), nil
+	}
+
+	for {
+		p.skipWhitespace()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+
+		p.skipWhitespace()
+		if p.consume(']') {
+			return NewArray(elements), nil
+		}
+		if !p.consume(',') {
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// parseString parses a JSON string and resolves its escape sequences
+func (p *jsonParser) parseString() (string, *Error) {
+	var out strings.Builder
+
+	// skip the opening quote
+	p.pos++
+	for {
+		if p.pos >= len(p.input) {
+			return "", p.errorf("unterminated string")
+		}
+
+		ch := p.input[p.pos]
+		switch {
+		case ch == '"':
+			p.pos++
+			return out.String(), nil
+		case ch < 0x20:
+			return "", p.errorf("invalid control character in string")
+		case ch == '\\':
+			r, err := p.parseEscape()
+			if err != nil {
+				return "", err
+			}
+			out.WriteRune(r)
+		default:
+			out.WriteByte(ch)
+			p.pos++
+		}
+	}
+}
+
+// parseEscape parses the escape sequence starting at the backslash at the current position, including surrogate pairs (\ud83d\ude00)
+func (p *jsonParser) parseEscape() (rune, *Error) {
+	if p.pos+1 >= len(p.input) {
+		p.pos = len(p.input)
+		return 0, p.errorf("unterminated string")
+	}
+
+	escapes := map[byte]rune{'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}
+	if r, ok := escapes[p.input[p.pos+1]]; ok {
+		p.pos += 2
+		return r, nil
+	}
+
+	if p.input[p.pos+1] != 'u' {
+		return 0, p.errorf("invalid escape sequence")
+	}
+
+	r, err := p.parseHex()
+	if err != nil {
+		return 0, err
+	}
+
+	if utf16.IsSurrogate(r) && strings.HasPrefix(p.input[p.pos:], `\u`) {
+		start := p.pos
+		low, err := p.parseHex()
+		if err != nil {
+			return 0, err
+		}
+		if pair := utf16.DecodeRune(r, low); pair != utf8.RuneError {
+			return pair, nil
+		}
+		p.pos = start
+	}
+
+	return r, nil
+}
+
+// parseHex parses the four hexadecimal digits of a \u escape sequence
+func (p *jsonParser) parseHex() (rune, *Error) {
+	if p.pos+6 > len(p.input) {
+		return 0, p.errorf("invalid unicode escape sequence")
+	}
+
+	n, err := strconv.ParseUint(p.input[p.pos+2:p.pos+6], 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid unicode escape sequence")
+	}
+
+	p.pos += 6
+	return rune(n), nil
+}
+
+// parseNumber parses a JSON number, only integers are supported
+func (p *jsonParser) parseNumber() (Object, *Error) {
+	start := p.pos
+
+	p.consume('-')
+	if p.pos >= len(p.input) || !isDigit(p.input[p.pos]) {
+		return nil, p.unexpected()
+	}
+	// a leading zero can not be followed by more digits
+	if p.consume('0') {
+		if p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+			return nil, p.unexpected()
+		}
+	}
+	for p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+		p.pos++
+	}
+
+	if p.pos < len(p.input) && strings.IndexByte(".eE", p.input[p.pos]) != -1 {
+		text := numberText(p.input[start:], p.pos-start)
+		p.pos = start
+		return nil, p.errorf("number %s is not an integer", text)
+	}
+
+	n, err := strconv.ParseInt(p.input[start:p.pos], 10, 64)
+	if err != nil {
+		text := p.input[start:p.pos]
+		p.pos = start
+		return nil, p.errorf("number %s is out of range", text)
+	}
+
+	return &Integer{Value: n}, nil
+}
+
+// numberText returns the complete JSON number at the start of s, the integer part is n bytes long
+func numberText(s string, n int) string {
+	end := n
+	for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) != -1 {
+		end++
+	}
+	return s[:end]
+}
+
+// consume skips the character at the current position if it is ch and reports whether it did
+func (p *jsonParser) consume(ch byte) bool {
+	if p.pos < len(p.input) && p.input[p.pos] == ch {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// skipWhitespace skips the whitespace characters allowed between JSON tokens
+func (p *jsonParser) skipWhitespace() {
+	for p.pos < len(p.input) && strings.IndexByte(" \t\n\r", p.input[p.pos]) != -1 {
+		p.pos++
+	}
+}
+
+// unexpected returns an Error for the character at the current position, or for the end of the input
+func (p *jsonParser) unexpected() *Error {
+	if p.pos >= len(p.input) {
+		return p.errorf("unexpected end of input")
+	}
+
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return p.errorf("unexpected character %q", r)
+}
+
+// errorf returns an Error with the message, followed by the line and column of the current position
+func (p *jsonParser) errorf(format string, a ...interface{}) *Error {
+	line, column := 1, 1
+	for _, ch := range p.input[:p.pos] {
+		if ch == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return newError("invalid JSON: %s at line %d, column %d", fmt.Sprintf(format, a...), line, column)
+}
+
+// isDigit reports whether ch is a decimal digit
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// StringifyJSON converts obj into JSON text. Hashes become JSON objects with their keys in insertion order,
+// integer and boolean keys are converted into strings. Structs become JSON objects holding their
+// fields in the order they were declared. When indent is not empty, nested values are placed on
+// their own lines and indented with it. An Error is returned for objects that have no JSON counterpart.
+func StringifyJSON(obj Object, indent string) Object {
+	return stringifyJSON(nil, obj, indent)
+}
+
+// stringifyJSON converts obj into JSON text for the `json_stringify` builtin called by rt,
+// an Error is returned once the text grows larger than rt allows (see stringBuilder)
+func stringifyJSON(rt Runtime, obj Object, indent string) Object {
+	out := newStringBuilder(rt, "json_stringify")
+
+	err := writeJSON(out, obj, indent, 0)
+	if err != nil {
+		return err
+	}
+
+	return &String{Value: out.String()}
+}
+
+// writeJSON writes obj as JSON text to out, depth is the nesting level of obj. It stops
+// with the error of out once out is full.
+func writeJSON(out *stringBuilder, obj Object, indent string, depth int) *Error {
+	if err := out.Err(); err != nil {
+		return err
+	}
+
+	switch obj := obj.(type) {
+	case *Null:
+		out.WriteString("null")
+	case *Boolean:
+		out.WriteString(strconv.FormatBool(obj.Value))
+	case *Integer:
+		out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *String:
+		writeJSONString(out, obj.Value)
+	case *Array:
+		return writeJSONArray(out, obj.Elements(), indent, depth)
+	case *Hash:
+		pairs := obj.Pairs()
+		keys := make([]string, len(pairs))
+		values := make([]Object, len(pairs))
+		for i, pair := range pairs {
+			switch key := pair.Key.(type) {
+			case *String:
+				keys[i] = key.Value
+			default:
+				keys[i] = key.Inspect()
+			}
+			values[i] = pair.Value
+		}
+		return writeJSONObject(out, keys, values, indent, depth)
+	case *Struct:
+		return writeJSONObject(out, obj.StructType.Fields, obj.Fields, indent, depth)
+	default:
+		return newError("unsupported type for JSON: %s", obj.Type())
+	}
+
+	return out.Err()
+}
+
+// writeJSONArray writes the elements as a JSON array to out
+func writeJSONArray(out *stringBuilder, elements []Object, indent string, depth int) *Error {
+	if len(elements) == 0 {
+		out.WriteString("[]")
+		return nil
+	}
+
+	out.WriteString("[")
+	for i, el := range elements {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		writeJSONNewline(out, indent, depth+1)
+		err := writeJSON(out, el, indent, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	writeJSONNewline(out, indent, depth)
+	out.WriteString("]")
+
+	return out.Err()
+}
+
+// writeJSONObject writes the keys and their values as a JSON object to out
+func writeJSONObject(out *stringBuilder, keys []string, values []Object, indent string, depth int) *Error {
+	if len(keys) == 0 {
+		out.WriteString("{}")
+		return nil
+	}
+
+	out.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		writeJSONNewline(out, indent, depth+1)
+		writeJSONString(out, key)
+		out.WriteString(":")
+		if indent != "" {
+			out.WriteString(" ")
+		}
+		err := writeJSON(out, values[i], indent, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+	writeJSONNewline(out, indent, depth)
+	out.WriteString("}")
+
+	return out.Err()
+}
+
+// writeJSONNewline starts a new line indented for depth when pretty-printing
+func writeJSONNewline(out *stringBuilder, indent string, depth int) {
+	if indent == "" {
+		return
+	}
+	out.WriteString("\n")
+	for i := 0; i < depth; i++ {
+		out.WriteString(indent)
+	}
+}
+
+// writeJSONString writes s as a quoted JSON string to out
+func writeJSONString(out *stringBuilder, s string) {
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(out, `\u%04x`, r)
+			} else {
+				out.WriteRune(r)
+			}
+		}
+	}
+	out.WriteByte('"')
+}
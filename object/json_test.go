@@ -0,0 +1,136 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the parsed object written back as compact JSON
+	}{
+		{`null`, `null`},
+		{` true `, `true`},
+		{`false`, `false`},
+		{`0`, `0`},
+		{`-42`, `-42`},
+		{`9223372036854775807`, `9223372036854775807`},
+		{`"hello"`, `"hello"`},
+		{`"a\"b\\c\/d\n\t"`, `"a\"b\\c/d\n\t"`},
+		{`"é😀"`, `"é😀"`},
+		{`"é"`, `"é"`},
+		{`[]`, `[]`},
+		{`[1, "two", [3], {}]`, `[1,"two",[3],{}]`},
+		{`{"b": 1, "a": {"c": [true, null]}}`, `{"b":1,"a":{"c":[true,null]}}`},
+		{`{"a": 1, "a": 2}`, `{"a":2}`},
+		{"{\n  \"a\" :\t1\r\n}", `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		parsed := ParseJSON(tt.input)
+		if err, ok := parsed.(*Error); ok {
+			t.Errorf("%q: unexpected error: %s", tt.input, err.Message)
+			continue
+		}
+
+		result := StringifyJSON(parsed, "")
+		str, ok := result.(*String)
+		if !ok {
+			t.Errorf("%q: result is not String. got=%T (%+v)", tt.input, result, result)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: wrong result. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{``, "invalid JSON: unexpected end of input at line 1, column 1"},
+		{`[1, 2`, "invalid JSON: unexpected end of input at line 1, column 6"},
+		{`[1 2]`, "invalid JSON: unexpected character '2' at line 1, column 4"},
+		{`[1, 2,]`, "invalid JSON: unexpected character ']' at line 1, column 7"},
+		{"{\n  \"a\": 1,\n  b: 2\n}", "invalid JSON: unexpected character 'b' at line 3, column 3"},
+		{`{"a" 1}`, "invalid JSON: unexpected character '1' at line 1, column 6"},
+		{`{1: 2}`, "invalid JSON: unexpected character '1' at line 1, column 2"},
+		{`tru`, "invalid JSON: unexpected character 't' at line 1, column 1"},
+		{`true false`, "invalid JSON: unexpected character 'f' at line 1, column 6"},
+		{`"abc`, "invalid JSON: unterminated string at line 1, column 5"},
+		{`"a\qb"`, "invalid JSON: invalid escape sequence at line 1, column 3"},
+		{`"\u12"`, "invalid JSON: invalid unicode escape sequence at line 1, column 2"},
+		{"\"a\tb\"", "invalid JSON: invalid control character in string at line 1, column 3"},
+		{`[1.5]`, "invalid JSON: number 1.5 is not an integer at line 1, column 2"},
+		{`-2e10`, "invalid JSON: number -2e10 is not an integer at line 1, column 1"},
+		{`01`, "invalid JSON: unexpected character '1' at line 1, column 2"},
+		{`-`, "invalid JSON: unexpected end of input at line 1, column 2"},
+		{`99999999999999999999`, "invalid JSON: number 99999999999999999999 is out of range at line 1, column 1"},
+		{`"é" x`, "invalid JSON: unexpected character 'x' at line 1, column 5"},
+		{strings.Repeat("[", 5000000), "invalid JSON: nesting deeper than 1000 levels at line 1, column 1001"},
+		{strings.Repeat(`{"a":`, 1001), "invalid JSON: nesting deeper than 1000 levels at line 1, column 5001"},
+	}
+
+	for _, tt := range tests {
+		parsed := ParseJSON(tt.input)
+		err, ok := parsed.(*Error)
+		if !ok {
+			t.Errorf("%q: expected Error. got=%T (%+v)", tt.input, parsed, parsed)
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestStringifyJSON(t *testing.T) {
+	point := NewStructType("Point", []string{"y", "x"})
+
+	tests := []struct {
+		obj      Object
+		indent   string
+		expected string
+	}{
+		{&String{Value: "tab\there \"quoted\" \x01"}, "", `"tab\there \"quoted\" \u0001"`},
+		{
+			hashOf(&Integer{Value: 2}, TRUE, &Integer{Value: 1}, NULL),
+			"",
+			`{"2":true,"1":null}`,
+		},
+		{point.Instantiate([]Object{&Integer{Value: 1}, &Integer{Value: 2}}), "", `{"y":1,"x":2}`},
+		{
+			NewArray([]Object{
+				&Integer{Value: 1},
+				NewArray([]Object{}),
+				hashOf(&String{Value: "a"}, NewArray([]Object{&Integer{Value: 2}})),
+			}),
+			"  ",
+			"[\n  1,\n  [],\n  {\n    \"a\": [\n      2\n    ]\n  }\n]",
+		},
+	}
+
+	for _, tt := range tests {
+		result := StringifyJSON(tt.obj, tt.indent)
+		str, ok := result.(*String)
+		if !ok {
+			t.Errorf("result is not String. got=%T (%+v)", result, result)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong result. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+
+	result := StringifyJSON(NewArray([]Object{&Builtin{}}), "")
+	err, ok := result.(*Error)
+	if !ok {
+		t.Fatalf("result is not Error. got=%T (%+v)", result, result)
+	}
+	if err.Message != "unsupported type for JSON: BUILTIN" {
+		t.Errorf("wrong error message. got=%q", err.Message)
+	}
+}
@@ -0,0 +1,259 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrStepLimit is the error of a program that took more steps than its Limits allow
+	ErrStepLimit = errors.New("step limit exceeded")
+	// ErrMemoryLimit is the error of a program that allocated more memory than its Limits allow
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+	// ErrStackOverflow is the error of a program whose calls are nested deeper than the VM or
+	// the evaluator allow, or whose values do not fit on the stack of the VM
+	ErrStackOverflow = errors.New("stack overflow")
+)
+
+// limitsCheckInterval is the number of steps between two checks of the context of a Limits,
+// checking it at every step would slow the programs down. It must be a power of two.
+const limitsCheckInterval = 1 << 10
+
+// The sizes in bytes the objects are accounted with, rough estimates of the memory they take.
+// A string takes the bytes of its value.
+const (
+	elementSize = 16 // an element of an array or a set
+	pairSize    = 64 // a pair of a hash, along with its share of the trie
+)
+
+// Limits bounds the execution of a program: it is stopped once its context is done, once it took
+// more than a maximum number of steps, or once it allocated more than a maximum amount of memory.
+// A step is an instruction for the VM and the evaluation of a node for the evaluator. The functions
+// started with spawn share the Limits of the program.
+//
+// The memory is the total size of the strings, arrays, hashes and sets the program built (see Size),
+// the memory they free once they are unused is not given back. It bounds the memory a program can take
+// rather than measuring it.
+//
+// The limits a program runs into stick, every later step fails as well: the program stops even if
+// it handles the Monkey error value the limit was reported as. Err returns the first of them.
+type Limits struct {
+	steps     int64 // accessed atomically, like allocated, they come first to be 64-bit aligned
+	allocated int64
+	stopped   int32 // accessed atomically, set once the program ran into a limit
+
+	ctx       context.Context
+	maxSteps  int64
+	maxMemory int64
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewLimits creates Limits stopping the program when ctx is done or once it took more than maxSteps steps.
+// A maxSteps of 0 or less does not limit the number of steps, a nil ctx is never done.
+func NewLimits(ctx context.Context, maxSteps int64) *Limits {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &Limits{ctx: ctx, maxSteps: maxSteps}
+}
+
+// SetMemoryLimit sets the number of bytes the program may allocate, it must be called before the program runs.
+// A limit of 0 or less does not limit the memory.
+func (l *Limits) SetMemoryLimit(maxMemory int64) {
+	l.maxMemory = maxMemory
+}
+
+// Step counts a step of the program, it returns an error once the program must stop. The error is
+// ErrStepLimit, ErrMemoryLimit or the error of the context (context.Canceled or context.DeadlineExceeded).
+func (l *Limits) Step() error {
+	steps := atomic.AddInt64(&l.steps, 1)
+
+	if atomic.LoadInt32(&l.stopped) != 0 {
+		return l.Err()
+	}
+
+	if l.maxSteps > 0 && steps > l.maxSteps {
+		return l.fail(ErrStepLimit)
+	}
+
+	if steps&(limitsCheckInterval-1) == 0 {
+		if err := l.ctx.Err(); err != nil {
+			return l.fail(err)
+		}
+	}
+
+	return nil
+}
+
+// Steps returns the number of steps the program took so far
+func (l *Limits) Steps() int64 {
+	return atomic.LoadInt64(&l.steps)
+}
+
+// Allocate accounts for size bytes the program is about to allocate, it returns ErrMemoryLimit
+// if the program may not allocate them (or the error of a limit it ran into before)
+func (l *Limits) Allocate(size int64) error {
+	if atomic.LoadInt32(&l.stopped) != 0 {
+		return l.Err()
+	}
+
+	allocated := atomic.AddInt64(&l.allocated, size)
+	if l.maxMemory > 0 && allocated > l.maxMemory {
+		return l.fail(ErrMemoryLimit)
+	}
+
+	return nil
+}
+
+// AllocateResult accounts for the memory a builtin allocated for its result. Only what the result
+// takes beyond the largest of the arguments is accounted: the result is often built from an argument
+// (as the array returned by `push` shares the elements of the one it is given), and a result no larger
+// than an argument cannot make the memory grow more than the program already did when building it.
+// It returns the error of a limit the program ran into before, as when the builtin failed CanAllocate.
+func (l *Limits) AllocateResult(result Object, args []Object) error {
+	if atomic.LoadInt32(&l.stopped) != 0 {
+		return l.Err()
+	}
+
+	largest := int64(0)
+	for _, arg := range args {
+		if size := Size(arg); size > largest {
+			largest = size
+		}
+	}
+
+	growth := Size(result) - largest
+	if growth <= 0 {
+		return nil
+	}
+	return l.Allocate(growth)
+}
+
+// CanAllocate returns ErrMemoryLimit if the program may not allocate size more bytes, without accounting
+// for them. It lets a builtin fail before building a result that AllocateResult would refuse.
+func (l *Limits) CanAllocate(size int64) error {
+	if atomic.LoadInt32(&l.stopped) != 0 {
+		return l.Err()
+	}
+
+	if l.maxMemory > 0 && size > l.maxMemory-atomic.LoadInt64(&l.allocated) {
+		return l.fail(ErrMemoryLimit)
+	}
+
+	return nil
+}
+
+// Allocated returns the number of bytes the program allocated so far
+func (l *Limits) Allocated() int64 {
+	return atomic.LoadInt64(&l.allocated)
+}
+
+// Err returns the error of the first limit the program ran into, or nil if it did not run into any
+func (l *Limits) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Done returns a channel closed once the context of the Limits is done, the builtins waiting on a
+// channel wait on it as well. Nil Limits are never done, their channel is nil.
+func (l *Limits) Done() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.ctx.Done()
+}
+
+// Interrupt records the error of the context as the limit the program ran into, once Done is closed,
+// and returns the recorded error. A builtin that stopped waiting because of Done reports it.
+func (l *Limits) Interrupt() error {
+	return l.fail(l.ctx.Err())
+}
+
+// fail records err as the error of the limit the program ran into, unless it already ran into one,
+// and returns the recorded error
+func (l *Limits) fail(err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		l.err = err
+		atomic.StoreInt32(&l.stopped, 1)
+	}
+	return l.err
+}
+
+// Size returns the number of bytes the object is accounted with by Limits. Only the object itself
+// is accounted, not the objects it holds: a string takes the bytes of its value, an array or a set
+// takes a few bytes per element and a hash a few more per pair. The other objects take no memory.
+func Size(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return int64(len(obj.Value))
+	case *Array:
+		return int64(obj.Len()) * elementSize
+	case *Set:
+		return int64(obj.Len()) * elementSize
+	case *Hash:
+		return int64(obj.Len()) * pairSize
+	default:
+		return 0
+	}
+}
+
+// addSize adds two sizes, a sum too large for an int64 saturates at math.MaxInt64
+func addSize(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// mulSize multiplies two non-negative sizes, a product too large for an int64 saturates at math.MaxInt64
+func mulSize(a, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
+
+// Allocator is implemented by the runtimes accounting for the memory the programs allocate (see Limits).
+// The runtimes account for the results of the builtins once they return, the builtins whose result
+// can be much larger than their arguments check that the memory is available before building it.
+type Allocator interface {
+	// CanAllocate returns an error if the program may not allocate size more bytes
+	CanAllocate(size int64) error
+}
+
+// LimitsProvider is implemented by the runtimes bounding the execution of the programs with Limits.
+// The builtins that may block, as `recv`, stop waiting once the program must stop.
+type LimitsProvider interface {
+	// Limits returns the Limits of the running program, nil if it has none
+	Limits() *Limits
+}
+
+// runtimeLimits returns the Limits of the program rt runs, nil if it has none
+func runtimeLimits(rt Runtime) *Limits {
+	if provider, ok := rt.(LimitsProvider); ok {
+		return provider.Limits()
+	}
+	return nil
+}
+
+// canAllocate checks that the program may allocate size more bytes if the runtime accounts for
+// its memory, the error is returned as an Error
+func canAllocate(rt Runtime, size int64) *Error {
+	allocator, ok := rt.(Allocator)
+	if !ok {
+		return nil
+	}
+
+	if err := allocator.CanAllocate(size); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
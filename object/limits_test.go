@@ -0,0 +1,263 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLimitsSteps(t *testing.T) {
+	limits := NewLimits(nil, 3)
+
+	for i := 0; i < 3; i++ {
+		if err := limits.Step(); err != nil {
+			t.Fatalf("step %d: unexpected error: %s", i+1, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := limits.Step(); !errors.Is(err, ErrStepLimit) {
+			t.Fatalf("expected ErrStepLimit. got=%v", err)
+		}
+	}
+	if !errors.Is(limits.Err(), ErrStepLimit) {
+		t.Errorf("Err should return ErrStepLimit. got=%v", limits.Err())
+	}
+	if limits.Steps() != 5 {
+		t.Errorf("wrong number of steps. want=5, got=%d", limits.Steps())
+	}
+}
+
+func TestLimitsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	limits := NewLimits(ctx, 0)
+
+	for i := 0; i < 2*limitsCheckInterval; i++ {
+		if err := limits.Step(); err != nil {
+			t.Fatalf("step %d: unexpected error: %s", i+1, err)
+		}
+	}
+	if limits.Err() != nil {
+		t.Fatalf("unexpected error: %s", limits.Err())
+	}
+
+	cancel()
+
+	// the context is only checked every limitsCheckInterval steps
+	var err error
+	for i := 0; i < limitsCheckInterval && err == nil; i++ {
+		err = limits.Step()
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled. got=%v", err)
+	}
+	if !errors.Is(limits.Err(), context.Canceled) {
+		t.Errorf("Err should return context.Canceled. got=%v", limits.Err())
+	}
+}
+
+func TestLimitsMemory(t *testing.T) {
+	limits := NewLimits(nil, 0)
+	limits.SetMemoryLimit(100)
+
+	if err := limits.Allocate(60); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := limits.CanAllocate(40); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if limits.Allocated() != 60 {
+		t.Fatalf("CanAllocate should not account for the memory. want=60, got=%d", limits.Allocated())
+	}
+
+	// only the growth of the result beyond its largest argument is accounted
+	args := []Object{&String{Value: "0123456789"}, &String{Value: "01234"}}
+	if err := limits.AllocateResult(&String{Value: "0123456789" + "0123456789"}, args); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if limits.Allocated() != 70 {
+		t.Fatalf("wrong allocated memory. want=70, got=%d", limits.Allocated())
+	}
+	if err := limits.AllocateResult(&String{Value: "01"}, args); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := limits.Allocate(31); !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("expected ErrMemoryLimit. got=%v", err)
+	}
+	// the limit sticks
+	if err := limits.Step(); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("Step should return ErrMemoryLimit. got=%v", err)
+	}
+	if err := limits.AllocateResult(NULL, nil); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("AllocateResult should return ErrMemoryLimit. got=%v", err)
+	}
+
+	refused := NewLimits(nil, 0)
+	refused.SetMemoryLimit(100)
+	if err := refused.CanAllocate(101); !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("expected ErrMemoryLimit. got=%v", err)
+	}
+	if !errors.Is(refused.Err(), ErrMemoryLimit) {
+		t.Errorf("Err should return ErrMemoryLimit. got=%v", refused.Err())
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expected int64
+	}{
+		{&String{Value: "hello"}, 5},
+		{NewArray([]Object{TRUE, FALSE, NULL}), 3 * elementSize},
+		{NewSet([]Object{&Integer{Value: 1}, &Integer{Value: 2}}), 2 * elementSize},
+		{&Integer{Value: 1000}, 0},
+		{NULL, 0},
+	}
+
+	for _, tt := range tests {
+		if size := Size(tt.obj); size != tt.expected {
+			t.Errorf("%s: wrong size. want=%d, got=%d", tt.obj.Inspect(), tt.expected, size)
+		}
+	}
+}
+
+// testLimitsRuntime is a Runtime accounting for the memory with limits, it cannot apply functions
+type testLimitsRuntime struct {
+	limits *Limits
+}
+
+func (rt testLimitsRuntime) Apply(fn Object, args ...Object) Object {
+	return newError("not supported")
+}
+
+func (rt testLimitsRuntime) CanAllocate(size int64) error {
+	return rt.limits.CanAllocate(size)
+}
+
+func TestBuiltinsStopAtMemoryLimit(t *testing.T) {
+	big := &String{Value: strings.Repeat("x", 100000)}
+	refs := make([]Object, 20000)
+	for i := range refs {
+		refs[i] = big
+	}
+	manyRefs := NewArray(refs)
+	long := NewArray(make([]Object, 100000))
+	for i := range refs {
+		refs[i] = long
+	}
+	nested := NewArray(refs)
+	as := &String{Value: strings.Repeat("a", 10000)}
+
+	tests := []struct {
+		name string
+		args []Object
+	}{
+		{"join", []Object{manyRefs}},
+		{"join", []Object{NewArray([]Object{as, as, as}), &String{Value: strings.Repeat(big.Value, 60)}}},
+		{"replace", []Object{as, &String{Value: "a"}, big}},
+		{"pad_right", []Object{&String{Value: ""}, &Integer{Value: 100000000}}},
+		{"format", []Object{&String{Value: strings.Repeat("%[1]s", 1000)}, big}},
+		{"format", []Object{&String{Value: strings.Repeat("%[1]1000000d", 1000)}, &Integer{Value: 1}}},
+		{"format", []Object{&String{Value: "%v"}, manyRefs}},
+		{"str", []Object{manyRefs}},
+		{"puts", []Object{manyRefs}},
+		{"json_stringify", []Object{manyRefs}},
+		{"flatten", []Object{nested}},
+		{"split", []Object{&String{Value: strings.Repeat("a", 10000000)}, &String{Value: ""}}},
+		{"repeat", []Object{big, &Integer{Value: 10000}}},
+	}
+
+	builtins := DefaultBuiltins()
+	for _, tt := range tests {
+		limits := NewLimits(nil, 0)
+		limits.SetMemoryLimit(10 << 20)
+		builtin, _ := builtins.Lookup(tt.name)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		result := builtin.Fn(testLimitsRuntime{limits}, tt.args...)
+		runtime.ReadMemStats(&after)
+
+		if err, ok := result.(*Error); !ok || err.Message != "memory limit exceeded" {
+			t.Errorf("%s: expected the memory limit error. got=%T", tt.name, result)
+			continue
+		}
+		// the results are built until they no longer fit, in buffers doubled as they grow
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4*(10<<20) {
+			t.Errorf("%s: allocated %d bytes before failing", tt.name, allocated)
+		}
+	}
+
+	// only the missing characters of the padding are built
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	result := builtinPadLeft(nil, &String{Value: ""}, &Integer{Value: 100000}, &String{Value: big.Value[:10000]})
+	runtime.ReadMemStats(&after)
+	if str, ok := result.(*String); !ok || len(str.Value) != 100000 {
+		t.Fatalf("pad_left: wrong result. got=%T", result)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("pad_left: allocated %d bytes for a padding of 100000 bytes", allocated)
+	}
+}
+
+func TestStringBuilder(t *testing.T) {
+	s := &String{Value: "a \"b\"\n\x01é"}
+	arr := NewArray([]Object{s, &Integer{Value: -12}, TRUE, NULL, NewArray([]Object{}), NewArray([]Object{s, s})})
+	hash := NewHash()
+	hash.Set(&String{Value: "key"}, arr)
+	hash.Set(&Integer{Value: 7}, NewSet([]Object{s, &Integer{Value: 1}}))
+	point := NewStructType("Point", []string{"x", "y"}).Instantiate([]Object{arr, s})
+	objects := []Object{s, arr, hash, point, NewArray([]Object{hash, hash, point})}
+
+	for _, obj := range objects {
+		out := newStringBuilder(nil, "str")
+		if err := writeInspect(out, obj); err != nil || out.String() != obj.Inspect() {
+			t.Errorf("wrong text. want=%q, got=%q (%v)", obj.Inspect(), out.String(), err)
+		}
+	}
+
+	formats := []struct {
+		format string
+		args   []interface{}
+	}{
+		{"%s is %d", []interface{}{s.Value, int64(5)}},
+		{"%q|%x|% #X|%#v|%t", []interface{}{s.Value, s.Value, s.Value, s.Value, true}},
+		{"%*d|%-8.3v|%[1]d|%%|%.*d|%-*d|%08.3d|%+06d|%#8x", []interface{}{int64(20), int64(5), int64(7), int64(-6), int64(-3), int64(42), int64(255), int64(4095)}},
+		{"%v %5v", []interface{}{arr.Inspect(), point.Inspect()}},
+		{"%[2]s %[1]s %s", []interface{}{"a", "b"}},
+	}
+
+	for _, tt := range formats {
+		args := []Object{&String{Value: tt.format}}
+		for _, arg := range tt.args {
+			switch arg := arg.(type) {
+			case int64:
+				args = append(args, &Integer{Value: arg})
+			case bool:
+				args = append(args, nativeBoolToBoolean(arg))
+			case string:
+				args = append(args, &String{Value: arg})
+			}
+		}
+		text := builtinFormat(nil, args...).Inspect()
+		if expected := fmt.Sprintf(tt.format, tt.args...); text != expected {
+			t.Errorf("%q: wrong text. want=%q, got=%q", tt.format, expected, text)
+		}
+	}
+
+	// the string stops growing at the write that does not fit in the memory limit
+	limits := NewLimits(nil, 0)
+	limits.SetMemoryLimit(10)
+	out := newStringBuilder(testLimitsRuntime{limits}, "str")
+	for _, part := range []string{"abcd", "efgh", "ijkl", "mn"} {
+		out.WriteString(part)
+	}
+	if err := out.Err(); err == nil || err.Message != "memory limit exceeded" || out.String() != "abcdefgh" {
+		t.Errorf("expected the string to stop growing at the memory limit. got=%q (%v)", out.String(), err)
+	}
+}
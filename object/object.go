@@ -23,6 +23,21 @@ const (
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	GENERATOR_OBJ         = "GENERATOR"
+	CHANNEL_OBJ           = "CHANNEL"
+	STRUCT_TYPE_OBJ       = "STRUCT_TYPE"
+	STRUCT_OBJ            = "STRUCT"
+	ITERATOR_OBJ          = "ITERATOR"
+	RANGE_OBJ             = "RANGE"
+	SET_OBJ               = "SET"
+)
+
+var (
+	// NULL, TRUE and FALSE are shared by the engines and the builtins. There only ever needs
+	// to be one of each, which lets the engines compare them by their pointer-addresses.
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
 )
 
 // ObjectType is the type that represents an evaluated value as a string
@@ -124,9 +139,10 @@ func (e *Error) Inspect() string { return "ERROR: " + e.Message }
 // The struct holds the function's parameters and body to be later evaluated
 // when referenced in its respective environment in a function call
 type Function struct {
-	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment
+	Parameters  []*ast.Identifier
+	Body        *ast.BlockStatement
+	Env         *Environment
+	IsGenerator bool
 }
 
 // Type returns the ObjectType (FUNCTION_OBJ) associated with the referenced Function struct
@@ -182,10 +198,20 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// Runtime is the interface the engine running a program hands to the built-in functions it calls.
+// It lets a built-in function call back into the engine, to apply the functions written by the user
+// that it received as arguments (the callback of map, filter, ...).
+type Runtime interface {
+	// Apply calls fn, which can be any callable object (a user function, a builtin or a struct type),
+	// with the given arguments and returns its result. Errors are returned as an Error.
+	Apply(fn Object, args ...Object) Object
+}
+
 // BuiltinFunction is used to create built-in functions that can be called in the interpretor.
 // The functions are defined by us and can be called by the user. A built-in function can be
 // constructed with any number of arguments of the type Object, but it must return an Object.
-type BuiltinFunction func(args ...Object) Object
+// The Runtime of the engine calling the built-in function is passed along with the arguments.
+type BuiltinFunction func(rt Runtime, args ...Object) Object
 
 // Builtin is the referenced struct for built-in functions in our object system.
 // The struct holds the defined built-in function.
@@ -200,9 +226,24 @@ func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string { return "builtin function" }
 
 // Array is the referenced struct for Array Literals in our object system.
-// The struct holds the evaluated elements of the array literal
+// The struct holds the evaluated elements of the array literal in a persistent vector,
+// so `push` and `rest` return a new Array sharing the elements of the old one in O(log n).
+// Use NewArray to construct an Array, the zero value is an empty Array.
 type Array struct {
-	Elements []Object
+	elements *vector
+}
+
+// NewArray constructs a new Array holding the elements, it does not keep a reference to the slice
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
+}
+
+// vector returns the vector holding the elements of the Array
+func (ao *Array) vector() *vector {
+	if ao.elements == nil {
+		return emptyVector
+	}
+	return ao.elements
 }
 
 // Type returns the ObjectType (ARRAY_OBJ) associated with the referenced Array struct
@@ -215,7 +256,7 @@ func (ao *Array) Inspect() string {
 
 	elements := []string{}
 
-	for _, e := range ao.Elements {
+	for _, e := range ao.Elements() {
 		elements = append(elements, e.Inspect())
 	}
 
@@ -226,6 +267,26 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// Len returns the number of elements in the Array
+func (ao *Array) Len() int { return ao.vector().len() }
+
+// At returns the element at index i, which must be within the bounds of the Array
+func (ao *Array) At(i int) Object { return ao.vector().get(i) }
+
+// Elements returns the elements of the Array in a new slice
+func (ao *Array) Elements() []Object { return ao.vector().slice() }
+
+// Push returns a new Array holding the elements of the Array followed by el
+func (ao *Array) Push(el Object) *Array {
+	return &Array{elements: ao.vector().push(el)}
+}
+
+// Rest returns a new Array holding the elements of the Array except the first one.
+// The Array must not be empty.
+func (ao *Array) Rest() *Array {
+	return &Array{elements: ao.vector().rest()}
+}
+
 // HashPair is the referenced struct used as the designated value to HashKeys.
 // It helps us print the values of the map in a more practial manner by
 // containing both the objects that generated the keys and values of the map.
@@ -235,18 +296,32 @@ type HashPair struct {
 }
 
 // HashKey is the referenced struct for a hash-key used in a Hash.
-// It helps us effectively look up keys in the Hash.Pairs. Type refers to the different
-// object types a hash-key can have (string, integer, boolean) before being converted to a uint64.
+// It helps us effectively look up keys in the Hash. Type refers to the different
+// object types a hash-key can have (string, integer, boolean, array, hash) before being converted to a uint64.
 // Value refers to the actual literal value of the key, the key in the key-value pair.
+// Different keys can have the same HashKey, so keys with the same HashKey are still compared with Equal.
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
 }
 
-// Hash is the referenced strsuct for Hash Literals in our object system
-// The Pairs field holds the evaluated map of the hash literal.
+// Hash is the referenced strsuct for Hash Literals in our object system.
+// It maps keys to values and remembers the order in which the keys were added, so printing and
+// iterating a hash always produce its pairs in the same order. Keys must be hashable (see IsHashable),
+// pairs are looked up by the HashKey of their key. Use NewHash to construct a Hash.
+//
+// The pairs are kept in persistent structures, a HAMT indexing them by HashKey and a vector holding
+// the keys in order. Copying a Hash is O(1) and the copy shares them with the original,
+// updating either of them afterwards takes O(log n) and leaves the other one untouched.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	index *hamtNode // the pairs indexed by the HashKey of their key
+	keys  *vector   // the keys in insertion order, deleted keys are left as nil
+	size  int       // the number of pairs
+}
+
+// NewHash constructs a new empty Hash
+func NewHash() *Hash {
+	return &Hash{index: emptyHamt, keys: emptyVector}
 }
 
 // Type returns the ObjectType (HASH_OBJ) associated with the referenced Hash struct
@@ -258,7 +333,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Pairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -269,8 +344,121 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
-// Hashable is the interface used in our evaluator to check if the given object is
-// usable as a hash key when we evaluate hash literals or index expressions for hashes.
+// Len returns the number of pairs in the Hash
+func (h *Hash) Len() int { return h.size }
+
+// find returns the HashKey of key, the pairs whose keys have this HashKey and the position of
+// the pair for key among them, or -1 if the Hash holds no pair for key. key must be hashable.
+func (h *Hash) find(key Object) (HashKey, []hashSlot, int) {
+	hashKey := key.(Hashable).HashKey()
+	slots := h.index.find(hashKey)
+	for i, slot := range slots {
+		if Equal(slot.key, key) {
+			return hashKey, slots, i
+		}
+	}
+	return hashKey, slots, -1
+}
+
+// Get returns the value bound to key and reports whether the Hash holds a pair for key.
+// Objects that are not hashable are never keys of a Hash.
+func (h *Hash) Get(key Object) (Object, bool) {
+	if !IsHashable(key) {
+		return nil, false
+	}
+
+	_, slots, i := h.find(key)
+	if i < 0 {
+		return nil, false
+	}
+	return slots[i].value, true
+}
+
+// Set binds key to value. Binding a key that is already part of the Hash replaces its value,
+// the key keeps its position. An Error is returned if key is not hashable.
+func (h *Hash) Set(key, value Object) *Error {
+	if !IsHashable(key) {
+		return newError("unusable as hash key: %s", key.Type())
+	}
+
+	hashKey, slots, i := h.find(key)
+	if i >= 0 {
+		updated := make([]hashSlot, len(slots))
+		copy(updated, slots)
+		updated[i].value = value
+		h.index = h.index.put(0, hashKey, updated)
+		return nil
+	}
+
+	updated := make([]hashSlot, len(slots), len(slots)+1)
+	copy(updated, slots)
+	updated = append(updated, hashSlot{key: key, value: value, pos: h.keys.len()})
+	h.index = h.index.put(0, hashKey, updated)
+	h.keys = h.keys.push(key)
+	h.size++
+
+	return nil
+}
+
+// Delete removes the pair for key from the Hash, if there is one
+func (h *Hash) Delete(key Object) {
+	if !IsHashable(key) {
+		return
+	}
+
+	hashKey, slots, i := h.find(key)
+	if i < 0 {
+		return
+	}
+
+	if len(slots) == 1 {
+		h.index = h.index.remove(0, hashKey)
+	} else {
+		updated := make([]hashSlot, 0, len(slots)-1)
+		updated = append(updated, slots[:i]...)
+		h.index = h.index.put(0, hashKey, append(updated, slots[i+1:]...))
+	}
+	h.keys = h.keys.set(slots[i].pos, nil)
+	h.size--
+
+	// once most of the keys are deleted ones, the Hash is built again without them
+	if h.keys.len() > 2*h.size+vectorWidth {
+		*h = *hashOfPairs(h.Pairs())
+	}
+}
+
+// Pairs returns the pairs of the Hash in the order their keys were added
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.size)
+	for _, key := range h.keys.slice() {
+		if key == nil {
+			continue
+		}
+		_, slots, i := h.find(key)
+		pairs = append(pairs, HashPair{Key: key, Value: slots[i].value})
+	}
+	return pairs
+}
+
+// Copy returns a new Hash holding the same pairs in the same order. It shares its
+// structures with h, so copying is O(1).
+func (h *Hash) Copy() *Hash {
+	result := *h
+	return &result
+}
+
+// hashOfPairs returns a new Hash holding the pairs, whose keys must be hashable and distinct
+func hashOfPairs(pairs []HashPair) *Hash {
+	hash := NewHash()
+	for _, pair := range pairs {
+		hash.Set(pair.Key, pair.Value)
+	}
+	return hash
+}
+
+// Hashable is the interface implemented by the objects that can compute a HashKey.
+// Use IsHashable to check if an object is usable as a hash key when we evaluate hash literals
+// or index expressions for hashes, arrays are only usable when their elements are.
 type Hashable interface {
 	HashKey() HashKey
 }
@@ -284,6 +472,8 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	IsGenerator   bool
+	Positions     code.Positions // the positions in the source of the instructions
 }
 
 // Type returns the ObjectType (COMPILED_FUNCTION_OBJ) associated with the referenced CompiledFunction struct
@@ -313,3 +503,232 @@ func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Generator is the referenced struct for the lazy sequence produced by calling a generator function,
+// a function whose body contains a yield statement. The engine that called the function provides Resume,
+// which runs the suspended function body until its next yield statement and returns the yielded value.
+// The body runs with the runtime resuming it, bound by the limits of the current run rather than
+// those of the run that called the function. Resume reports false once the body has finished.
+// Stop, if the engine provides it, releases what the suspended body holds (see Close).
+// peeked holds a value that Done had to resume for, so it can be handed out by the following call to Next.
+type Generator struct {
+	Resume    func(rt Runtime) (Object, bool)
+	Stop      func()
+	peeked    Object
+	hasPeeked bool
+	finished  bool
+}
+
+// Type returns the ObjectType (GENERATOR_OBJ) associated with the referenced Generator struct
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+
+// Inspect will simply return a preformatted string for the Generator with its memory-address.
+func (g *Generator) Inspect() string {
+	return fmt.Sprintf("Generator[%p]", g)
+}
+
+// Next returns the next value of the generator, resuming its function body with rt if needed.
+// It reports false once the function body has finished.
+func (g *Generator) Next(rt Runtime) (Object, bool) {
+	if g.hasPeeked {
+		g.hasPeeked = false
+		return g.peeked, true
+	}
+
+	if g.finished {
+		return nil, false
+	}
+
+	value, ok := g.Resume(rt)
+	if !ok {
+		g.finished = true
+	}
+
+	return value, ok
+}
+
+// Done reports whether the generator has no values left. Since the function body has
+// to run to find out (with rt), the value it produced is kept for the following call to Next.
+func (g *Generator) Done(rt Runtime) bool {
+	if g.hasPeeked {
+		return false
+	}
+
+	value, ok := g.Next(rt)
+	if !ok {
+		return true
+	}
+
+	g.peeked = value
+	g.hasPeeked = true
+	return false
+}
+
+// Close finishes the generator without running the rest of its function body, Next reports false
+// from then on. It lets the engine release the suspended body of a generator that is abandoned.
+func (g *Generator) Close() {
+	g.finished = true
+	g.hasPeeked = false
+	g.peeked = nil
+	if g.Stop != nil {
+		g.Stop()
+	}
+}
+
+// Channel is the referenced struct for channels in our object system. A channel
+// lets functions running on different goroutines (see spawn) hand values to each other.
+// It wraps a Go channel and turns the panics of sending on or closing a closed channel
+// into results the builtins can report.
+type Channel struct {
+	Ch chan Object
+}
+
+// NewChannel creates a new Channel that can buffer up to size values
+func NewChannel(size int) *Channel {
+	return &Channel{Ch: make(chan Object, size)}
+}
+
+// Type returns the ObjectType (CHANNEL_OBJ) associated with the referenced Channel struct
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+
+// Inspect will simply return a preformatted string for the Channel with its memory-address.
+func (c *Channel) Inspect() string {
+	return fmt.Sprintf("Channel[%p]", c)
+}
+
+// Send blocks until val is handed to the channel. It reports false if the channel is closed.
+func (c *Channel) Send(val Object) (ok bool) {
+	ok, _ = c.SendUntil(val, nil)
+	return ok
+}
+
+// SendUntil blocks until val is handed to the channel or until done is closed, in which case it
+// reports interrupted. It reports false if the channel is closed. A nil done never interrupts it.
+func (c *Channel) SendUntil(val Object, done <-chan struct{}) (ok bool, interrupted bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	select {
+	case c.Ch <- val:
+		return true, false
+	case <-done:
+		return false, true
+	}
+}
+
+// Recv blocks until a value is available on the channel. It reports false
+// if the channel is closed and all of its values have been received.
+func (c *Channel) Recv() (Object, bool) {
+	val, ok, _ := c.RecvUntil(nil)
+	return val, ok
+}
+
+// RecvUntil blocks until a value is available on the channel or until done is closed, in which case
+// it reports interrupted. It reports false like Recv. A nil done never interrupts it.
+func (c *Channel) RecvUntil(done <-chan struct{}) (val Object, ok bool, interrupted bool) {
+	select {
+	case val, ok = <-c.Ch:
+		return val, ok, false
+	case <-done:
+		return nil, false, true
+	}
+}
+
+// Close closes the channel, it reports false if the channel was already closed.
+func (c *Channel) Close() (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	close(c.Ch)
+	return true
+}
+
+// StructType is the referenced struct for struct declarations (struct Point { x, y }).
+// It describes the fixed layout shared by all of its instances, Fields holds the field names
+// in declaration order and the position of a name is the slot of the field in a Struct.
+// Calling a StructType constructs a new Struct, with one argument per field.
+type StructType struct {
+	Name   string
+	Fields []string
+	index  map[string]int
+}
+
+// NewStructType creates a new StructType with the given name and fields in declaration order
+func NewStructType(name string, fields []string) *StructType {
+	index := make(map[string]int, len(fields))
+	for i, f := range fields {
+		index[f] = i
+	}
+	return &StructType{Name: name, Fields: fields, index: index}
+}
+
+// Type returns the ObjectType (STRUCT_TYPE_OBJ) associated with the referenced StructType struct
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+
+// Inspect returns the declaration of the StructType as a string
+func (st *StructType) Inspect() string {
+	return fmt.Sprintf("struct %s { %s }", st.Name, strings.Join(st.Fields, ", "))
+}
+
+// FieldIndex returns the slot of the named field, it reports false if the StructType does not declare the field.
+func (st *StructType) FieldIndex(name string) (int, bool) {
+	i, ok := st.index[name]
+	return i, ok
+}
+
+// Instantiate constructs a new Struct of the StructType from the values of its fields,
+// given in declaration order. An Error is returned if the number of values does not match the layout.
+func (st *StructType) Instantiate(values []Object) Object {
+	if len(values) != len(st.Fields) {
+		return &Error{Message: fmt.Sprintf("wrong number of fields for struct %s: want=%d, got=%d",
+			st.Name, len(st.Fields), len(values))}
+	}
+
+	fields := make([]Object, len(values))
+	copy(fields, values)
+
+	return &Struct{StructType: st, Fields: fields}
+}
+
+// Struct is the referenced struct for instances of a StructType in our object system.
+// Fields holds the value of each field in the slot given by its StructType.
+type Struct struct {
+	StructType *StructType
+	Fields     []Object
+}
+
+// Type returns the ObjectType (STRUCT_OBJ) associated with the referenced Struct struct
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+
+// Inspect returns the Struct as a string, listing its fields in declaration order (Point{x: 1, y: 2})
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for i, name := range s.StructType.Fields {
+		fields = append(fields, name+": "+s.Fields[i].Inspect())
+	}
+
+	out.WriteString(s.StructType.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// GetField returns the value of the named field, an Error is returned
+// if the field is not declared by the StructType of the Struct.
+func (s *Struct) GetField(name string) Object {
+	i, ok := s.StructType.FieldIndex(name)
+	if !ok {
+		return &Error{Message: fmt.Sprintf("unknown field %s for struct %s", name, s.StructType.Name)}
+	}
+	return s.Fields[i]
+}
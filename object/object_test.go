@@ -60,3 +60,32 @@ func TestBooleanHashKey(t *testing.T) {
 		t.Errorf("boolean with different content but have same hash keys")
 	}
 }
+
+func TestHashOrder(t *testing.T) {
+	hash := NewHash()
+	for _, key := range []string{"c", "a", "b"} {
+		hash.Set(&String{Value: key}, &Integer{Value: int64(len(key))})
+	}
+	hash.Set(&String{Value: "a"}, TRUE)
+	hash.Delete(&String{Value: "c"})
+	hash.Set(&String{Value: "c"}, FALSE)
+	hash.Delete(&String{Value: "missing"})
+
+	if hash.Len() != 3 {
+		t.Fatalf("hash has wrong number of pairs. want=3, got=%d", hash.Len())
+	}
+
+	if hash.Inspect() != "{a: true, b: 1, c: false}" {
+		t.Errorf("wrong Inspect. got=%q", hash.Inspect())
+	}
+
+	copied := hash.Copy()
+	copied.Delete(&String{Value: "a"})
+	if hash.Inspect() != "{a: true, b: 1, c: false}" || copied.Inspect() != "{b: 1, c: false}" {
+		t.Errorf("Copy is not independent. original=%q, copy=%q", hash.Inspect(), copied.Inspect())
+	}
+
+	if err := hash.Set(NewArray([]Object{&Builtin{}}), NULL); err == nil || err.Message != "unusable as hash key: ARRAY" {
+		t.Errorf("expected error for unusable key. got=%v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Set is the referenced struct for sets in our object system ({1, 2, 3}).
+// Like the keys of a Hash, the elements of a Set must be hashable (see IsHashable). Adding an element twice keeps
+// a single copy. The Set remembers the order in which the elements were added, so printing and
+// iterating a set always produce its elements in the same order.
+type Set struct {
+	elements []Object          // the elements in insertion order
+	index    map[HashKey][]int // the positions in elements of the elements with the same HashKey
+}
+
+// NewSet constructs a new Set holding the given elements. An Error is returned
+// if one of the elements cannot be used as a set element.
+func NewSet(elements []Object) Object {
+	set := newSet(len(elements))
+
+	for _, el := range elements {
+		if !IsHashable(el) {
+			return newError("unusable as set element: %s", el.Type())
+		}
+		set.add(el)
+	}
+
+	return set
+}
+
+// newSet constructs a new empty Set with room for size elements
+func newSet(size int) *Set {
+	return &Set{elements: make([]Object, 0, size), index: make(map[HashKey][]int, size)}
+}
+
+// find returns the HashKey of el and reports whether the Set holds it. el must be hashable.
+func (s *Set) find(el Object) (HashKey, bool) {
+	hashKey := el.(Hashable).HashKey()
+	for _, i := range s.index[hashKey] {
+		if Equal(s.elements[i], el) {
+			return hashKey, true
+		}
+	}
+	return hashKey, false
+}
+
+// add adds the hashable el to the Set, unless the set already holds it
+func (s *Set) add(el Object) {
+	hashKey, ok := s.find(el)
+	if ok {
+		return
+	}
+	s.index[hashKey] = append(s.index[hashKey], len(s.elements))
+	s.elements = append(s.elements, el)
+}
+
+// Type returns the ObjectType (SET_OBJ) associated with the referenced Set struct
+func (s *Set) Type() ObjectType { return SET_OBJ }
+
+// Inspect returns the Set as a string, listing its elements between braces
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range s.elements {
+		elements = append(elements, el.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// Len returns the number of elements in the Set
+func (s *Set) Len() int { return len(s.elements) }
+
+// Elements returns the elements of the Set in the order they were added
+func (s *Set) Elements() []Object {
+	elements := make([]Object, len(s.elements))
+	copy(elements, s.elements)
+	return elements
+}
+
+// Contains reports whether el is an element of the Set. Objects that are not
+// hashable can never be part of a Set.
+func (s *Set) Contains(el Object) bool {
+	if !IsHashable(el) {
+		return false
+	}
+
+	_, ok := s.find(el)
+	return ok
+}
+
+// Union returns a new Set holding the elements of s followed by the elements of other
+func (s *Set) Union(other *Set) *Set {
+	result := newSet(len(s.elements) + len(other.elements))
+	for _, el := range s.elements {
+		result.add(el)
+	}
+	for _, el := range other.elements {
+		result.add(el)
+	}
+	return result
+}
+
+// Intersection returns a new Set holding the elements of s that are also elements of other
+func (s *Set) Intersection(other *Set) *Set {
+	result := newSet(0)
+	for _, el := range s.elements {
+		if _, ok := other.find(el); ok {
+			result.add(el)
+		}
+	}
+	return result
+}
+
+// Difference returns a new Set holding the elements of s that are not elements of other
+func (s *Set) Difference(other *Set) *Set {
+	result := newSet(0)
+	for _, el := range s.elements {
+		if _, ok := other.find(el); !ok {
+			result.add(el)
+		}
+	}
+	return result
+}
+
+// Iterate returns a new Iterator for the Set, it produces the position and the element.
+// The elements are collected when the iterator is created.
+func (s *Set) Iterate() Iterator {
+	return &ArrayIterator{array: NewArray(s.Elements())}
+}
+
+// Member evaluates the `in` operator (element in collection). It reports whether element is
+// an element of a Set or an Array, a key of a Hash or a substring of a String.
+// Objects that are not hashable are never part of a Set or keys of a Hash.
+// An Error is returned for any other collection.
+func Member(element, collection Object) Object {
+	switch collection := collection.(type) {
+	case *Set:
+		return nativeBoolToBoolean(collection.Contains(element))
+	case *Hash:
+		_, ok := collection.Get(element)
+		return nativeBoolToBoolean(ok)
+	case *Array:
+		for _, el := range collection.Elements() {
+			if Equal(el, element) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *String:
+		sub, ok := element.(*String)
+		if !ok {
+			return newError("operator `in` on STRING requires STRING, got %s", element.Type())
+		}
+		return nativeBoolToBoolean(strings.Contains(collection.Value, sub.Value))
+	default:
+		return newError("operator `in` not supported: %s", collection.Type())
+	}
+}
+
+// nativeBoolToBoolean returns the shared TRUE or FALSE object for the given bool
+func nativeBoolToBoolean(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
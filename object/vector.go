@@ -0,0 +1,191 @@
+package object
+
+// vector is a persistent vector of objects, it backs the Array. It is never modified,
+// the operations updating a vector return a new one which shares most of its nodes with the old one.
+//
+// The elements live in a trie whose nodes hold up to 32 children (a bit-partitioned vector trie),
+// the last up to 32 elements are kept apart in the tail so pushing is cheap. Looking up, pushing and
+// replacing an element touch a single path of the trie and take O(log32 n).
+// Dropping the first element only moves the start of the vector, the dropped elements are kept
+// in the trie, which makes `rest` O(1).
+type vector struct {
+	count int         // the number of elements in the trie and the tail, including the dropped ones
+	start int         // the number of elements dropped from the front
+	shift uint        // the number of index bits consumed by the levels above the leaves
+	root  *vectorNode // the trie holding all the elements before the tail
+	tail  []Object    // the last elements, not yet part of the trie
+}
+
+// vectorNode is a node of the trie of a vector. Leaves hold elements, the other nodes hold children.
+type vectorNode struct {
+	children []*vectorNode
+	elements []Object
+}
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// emptyVector is the vector without elements, all vectors are built from it
+var emptyVector = &vector{shift: vectorBits, root: &vectorNode{}}
+
+// newVector returns a vector holding the elements, it does not keep a reference to the slice
+func newVector(elements []Object) *vector {
+	v := emptyVector
+	// whole leaves are added at once, the rest becomes the tail
+	for len(elements) > vectorWidth {
+		leaf := make([]Object, vectorWidth)
+		copy(leaf, elements)
+		v = v.pushLeaf(leaf)
+		elements = elements[vectorWidth:]
+	}
+
+	tail := make([]Object, len(elements))
+	copy(tail, elements)
+
+	return &vector{count: v.count + len(tail), shift: v.shift, root: v.root, tail: tail}
+}
+
+// len returns the number of elements of the vector
+func (v *vector) len() int { return v.count - v.start }
+
+// tailOffset returns the index of the first element of the tail, counting the dropped elements
+func (v *vector) tailOffset() int {
+	if v.count < vectorWidth {
+		return 0
+	}
+	return (v.count - 1) >> vectorBits << vectorBits
+}
+
+// leafFor returns the leaf (or the tail) holding the element at index j, counting the dropped elements
+func (v *vector) leafFor(j int) []Object {
+	if j >= v.tailOffset() {
+		return v.tail
+	}
+
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(j>>level)&vectorMask]
+	}
+	return node.elements
+}
+
+// get returns the element at index i, which must be within the bounds of the vector
+func (v *vector) get(i int) Object {
+	j := v.start + i
+	return v.leafFor(j)[j&vectorMask]
+}
+
+// push returns a new vector holding the elements of v followed by el
+func (v *vector) push(el Object) *vector {
+	if len(v.tail) < vectorWidth {
+		tail := make([]Object, len(v.tail)+1)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = el
+
+		return &vector{count: v.count + 1, start: v.start, shift: v.shift, root: v.root, tail: tail}
+	}
+
+	// the tail is full, it moves into the trie and el starts a new tail
+	result := v.pushLeaf(v.tail)
+	result.count++
+	result.tail = []Object{el}
+	return result
+}
+
+// pushLeaf returns a new vector whose trie holds the elements of v followed by the full leaf.
+// It must only be called on vectors whose tail is empty or full, the tail is left out of the result.
+func (v *vector) pushLeaf(leaf []Object) *vector {
+	leafNode := &vectorNode{elements: leaf}
+	// the index of the first element of the leaf
+	offset := v.count - len(v.tail)
+
+	// the root is full, the trie grows a level
+	if offset>>vectorBits >= 1<<v.shift {
+		root := &vectorNode{children: []*vectorNode{v.root, newVectorPath(v.shift, leafNode)}}
+		return &vector{count: offset + vectorWidth, start: v.start, shift: v.shift + vectorBits, root: root}
+	}
+
+	root := v.root.pushLeaf(v.shift, offset, leafNode)
+	return &vector{count: offset + vectorWidth, start: v.start, shift: v.shift, root: root}
+}
+
+// pushLeaf returns a copy of the node at level with leaf added at index offset
+func (n *vectorNode) pushLeaf(level uint, offset int, leaf *vectorNode) *vectorNode {
+	i := (offset >> level) & vectorMask
+	children := make([]*vectorNode, i+1)
+	copy(children, n.children)
+
+	switch {
+	case level == vectorBits:
+		children[i] = leaf
+	case i < len(n.children):
+		children[i] = n.children[i].pushLeaf(level-vectorBits, offset, leaf)
+	default:
+		children[i] = newVectorPath(level-vectorBits, leaf)
+	}
+
+	return &vectorNode{children: children}
+}
+
+// newVectorPath returns the nodes leading from a node at level down to leaf
+func newVectorPath(level uint, leaf *vectorNode) *vectorNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode{children: []*vectorNode{newVectorPath(level-vectorBits, leaf)}}
+}
+
+// set returns a new vector holding the elements of v with the element at index i replaced by el.
+// i must be within the bounds of the vector.
+func (v *vector) set(i int, el Object) *vector {
+	j := v.start + i
+	result := *v
+
+	if j >= v.tailOffset() {
+		result.tail = make([]Object, len(v.tail))
+		copy(result.tail, v.tail)
+		result.tail[j&vectorMask] = el
+		return &result
+	}
+
+	result.root = v.root.set(v.shift, j, el)
+	return &result
+}
+
+// set returns a copy of the node at level with the element at index j replaced by el
+func (n *vectorNode) set(level uint, j int, el Object) *vectorNode {
+	if level == 0 {
+		elements := make([]Object, len(n.elements))
+		copy(elements, n.elements)
+		elements[j&vectorMask] = el
+		return &vectorNode{elements: elements}
+	}
+
+	children := make([]*vectorNode, len(n.children))
+	copy(children, n.children)
+	i := (j >> level) & vectorMask
+	children[i] = children[i].set(level-vectorBits, j, el)
+	return &vectorNode{children: children}
+}
+
+// rest returns a new vector holding the elements of v except the first one. v must not be empty.
+// The first element stays in the trie, so the new vector shares all the nodes of v.
+func (v *vector) rest() *vector {
+	result := *v
+	result.start++
+	return &result
+}
+
+// slice returns the elements of the vector in a new slice
+func (v *vector) slice() []Object {
+	elements := make([]Object, v.len())
+	for i, j := 0, v.start; j < v.count; {
+		n := copy(elements[i:], v.leafFor(j)[j&vectorMask:])
+		i += n
+		j += n
+	}
+	return elements
+}
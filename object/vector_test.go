@@ -0,0 +1,103 @@
+package object
+
+import (
+	"testing"
+)
+
+func integers(from, to int) []Object {
+	elements := make([]Object, 0, to-from)
+	for i := from; i < to; i++ {
+		elements = append(elements, &Integer{Value: int64(i)})
+	}
+	return elements
+}
+
+func testVectorElements(t *testing.T, v *vector, expected []Object) {
+	t.Helper()
+
+	if v.len() != len(expected) {
+		t.Fatalf("vector has wrong length. want=%d, got=%d", len(expected), v.len())
+	}
+
+	for i, el := range v.slice() {
+		if el != expected[i] {
+			t.Fatalf("wrong element of slice at %d. want=%s, got=%s", i, expected[i].Inspect(), el.Inspect())
+		}
+	}
+
+	for i, el := range expected {
+		if v.get(i) != el {
+			t.Fatalf("wrong element at %d. want=%s, got=%s", i, el.Inspect(), v.get(i).Inspect())
+		}
+	}
+}
+
+func TestVector(t *testing.T) {
+	// the sizes cover an empty vector, a vector with only a tail and tries of one, two and three levels
+	for _, size := range []int{0, 1, 31, 32, 33, 64, 1024, 1056, 33000} {
+		elements := integers(0, size)
+
+		testVectorElements(t, newVector(elements), elements)
+
+		pushed := emptyVector
+		for _, el := range elements {
+			pushed = pushed.push(el)
+		}
+		testVectorElements(t, pushed, elements)
+	}
+}
+
+func TestVectorIsPersistent(t *testing.T) {
+	elements := integers(0, 2000)
+	v := newVector(elements)
+
+	last := &Integer{Value: 2000}
+	pushed := v.push(last)
+	replaced := v.set(1500, NULL).set(1999, NULL)
+	rest := v.rest()
+
+	testVectorElements(t, v, elements)
+	testVectorElements(t, pushed, append(append([]Object{}, elements...), last))
+	testVectorElements(t, rest, elements[1:])
+
+	if replaced.get(1500) != NULL || replaced.get(1999) != NULL || replaced.get(1499) != elements[1499] {
+		t.Errorf("set did not replace the elements")
+	}
+
+	// pushing onto two versions sharing a tail keeps them apart
+	a := rest.push(TRUE)
+	b := rest.push(FALSE)
+	if a.get(1999) != TRUE || b.get(1999) != FALSE {
+		t.Errorf("versions sharing a tail are not independent")
+	}
+}
+
+func TestVectorRest(t *testing.T) {
+	elements := integers(0, 100)
+	v := newVector(elements)
+
+	for i := range elements {
+		testVectorElements(t, v, elements[i:])
+		v = v.rest()
+	}
+	testVectorElements(t, v, []Object{})
+
+	// an emptied vector grows again after the dropped elements
+	v = v.push(TRUE).push(FALSE)
+	testVectorElements(t, v, []Object{TRUE, FALSE})
+}
+
+func TestArray(t *testing.T) {
+	arr := NewArray(integers(0, 3))
+	pushed := arr.Push(&Integer{Value: 3})
+	rest := pushed.Rest()
+
+	if arr.Inspect() != "[0, 1, 2]" || pushed.Inspect() != "[0, 1, 2, 3]" || rest.Inspect() != "[1, 2, 3]" {
+		t.Errorf("wrong arrays. got=%s, %s, %s", arr.Inspect(), pushed.Inspect(), rest.Inspect())
+	}
+
+	var empty Array
+	if empty.Len() != 0 || empty.Inspect() != "[]" || empty.Push(TRUE).Inspect() != "[true]" {
+		t.Errorf("the zero value is not an empty Array")
+	}
+}
@@ -14,6 +14,7 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	PIPELINE    // x |> f
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
@@ -25,16 +26,19 @@ const (
 
 // a map of the token infix operators and their precedences
 var precedences = map[token.TokenType]int{
+	token.PIPE:     PIPELINE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.IN:       LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 // Parser constructs the abstract syntax-tree for a program by analyzing the tokens
@@ -46,7 +50,13 @@ type Parser struct {
 	l         *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []*Error
+	// yieldSeen points to the flag recording whether the function literal currently
+	// being parsed contains a yield statement. It is nil outside of function literals.
+	yieldSeen *bool
+	// grouped records the call expressions that were wrapped in parentheses as a whole,
+	// a pipe calls those with its left operand instead of adding it to their arguments
+	grouped map[*ast.CallExpression]bool
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -63,8 +73,9 @@ type (
 // New creates a new instance of a Parser with the first two tokens read
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:       l,
+		errors:  []*Error{},
+		grouped: map[*ast.CallExpression]bool{},
 	}
 
 	// Read two tokens, so curToken and peekToken are both set
@@ -90,6 +101,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parsePipeExpression)
 	// register boolean parsing functions
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
@@ -97,6 +110,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	// register ifExpression parsing function
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	// register for-in loop parsing function
+	p.registerPrefix(token.FOR, p.parseForExpression)
 	// register function-literal parsing function
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	// register infixParseFn to parse call-expressions
@@ -109,6 +124,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	// register hash literal parsing function
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	// register field access parsing function
+	p.registerInfix(token.DOT, p.parseFieldExpression)
 
 	return p
 }
@@ -133,6 +150,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -150,6 +171,15 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// construct the Identifier node with the attributes of the initial token.LET
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	// the name can be followed by a type annotation `let x: int = 5`
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		stmt.Name.Type = p.parseTypeAnnotation()
+		if stmt.Name.Type == nil {
+			return nil
+		}
+	}
+
 	// should expect LetStatement to use an assignment `=`
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -197,6 +227,31 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// parseYieldStatement constructs a Statement with the attributes of a YieldStatement
+// and marks the enclosing function literal as a generator function
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	stmt := &ast.YieldStatement{Token: p.curToken}
+
+	// yield only makes sense while suspending a function call
+	if p.yieldSeen == nil {
+		p.errorf(stmt.Token, "yield outside of function")
+		return nil
+	}
+	*p.yieldSeen = true
+
+	// advance the parser to start examining the proceeding expression
+	p.nextToken()
+
+	// construct expression for yield statement
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // curTokenIs verifies whether t and the parser's current token type are the same
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
@@ -222,6 +277,53 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// parseStructStatement constructs a Statement with the attributes of a StructStatement.
+// The declaration lists its fields between braces, separated by commas (struct Point { x, y }).
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+
+	// should expect next token type to be token.IDENT, the name of the struct
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if seen[field.Value] {
+			p.errorf(field.Token, "duplicate field %s in struct %s", field.Value, stmt.Name.Value)
+			return nil
+		}
+		seen[field.Value] = true
+		stmt.Fields = append(stmt.Fields, field)
+
+		// fields are separated by commas, the last one may be followed by the closing brace
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // parseExpressionStatement constructs a Statement with the attributes of an ExpressionStatement
 // Depending on the current token type, it will use a designated parsing function to construct the Expression
 // The Expression is then set on the ExpressionStatement
@@ -245,8 +347,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // when the parser encounters a token in the expresson
 // that does not have a prefix parse function
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.curToken, "no prefix parse function for %s found", t)
 }
 
 // parseExpression checks whether a parsing function is
@@ -286,16 +387,45 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
-// Errors returns the errors in the parser
+// Errors returns the messages of the errors in the parser
 func (p *Parser) Errors() []string {
+	messages := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		messages[i] = err.Message
+	}
+	return messages
+}
+
+// PositionedErrors returns the errors in the parser along with their positions in the input
+func (p *Parser) PositionedErrors() []*Error {
 	return p.errors
 }
 
+// Error is a syntax error found by the Parser, along with the position in the input where it was found
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error returns the message of the Error prefixed with its position (line:column: message)
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// errorf records a new error at the position of the given token
+func (p *Parser) errorf(tok token.Token, format string, args ...interface{}) {
+	p.errors = append(p.errors, &Error{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
 // peekError adds an error message (string) to the parser's errors ([]string)
 // when the peekToken does not match the expected token.
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.peekToken, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 // ParseProgram constructs the root node of a AST an *ast.Program.
@@ -333,8 +463,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q a integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorf(p.curToken, "could not parse %q a integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -424,6 +553,10 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 		return nil
 	}
 
+	if call, ok := exp.(*ast.CallExpression); ok {
+		p.grouped[call] = true
+	}
+
 	return exp
 }
 
@@ -496,6 +629,51 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	return block
 }
 
+// parseForExpression constructs a for-in loop, the loop variables are listed before
+// the "in" keyword (for (x in coll) { ... } or for (k, v in hash) { ... })
+func (p *Parser) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// a second identifier means the first one is bound to the key of each element
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.Key = expression.Value
+		expression.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	// advance past "in" to construct the iterable expression
+	p.nextToken()
+	expression.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
 // parseFunctionLiteral constructs a FunctionLiteral expression
 // by verifying that all components of the function-literal are in their
 // expected position
@@ -511,18 +689,63 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	// parse function parameters, should leave current token as ")"
 	lit.Parameters = p.parseFunctionParameters()
 
+	// the parameters can be followed by the annotation of the return type `fn(x): int`
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		lit.ReturnType = p.parseTypeAnnotation()
+		if lit.ReturnType == nil {
+			return nil
+		}
+	}
+
 	// current token should be ")", verify next token is "{"
 	// then advane to that token
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	// construct Block Statement of function-literal
+	// construct Block Statement of function-literal, yield statements belong to
+	// this function and not to the one enclosing it
+	outerYieldSeen := p.yieldSeen
+	yieldSeen := false
+	p.yieldSeen = &yieldSeen
+
 	lit.Body = p.parseBlockStatement()
+	lit.IsGenerator = yieldSeen
+
+	p.yieldSeen = outerYieldSeen
 
 	return lit
 }
 
+// parseParameter constructs the Identifier of a function parameter from the current token,
+// along with its optional type annotation `x: int`
+func (p *Parser) parseParameter() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		ident.Type = p.parseTypeAnnotation()
+		if ident.Type == nil {
+			return nil
+		}
+	}
+
+	return ident
+}
+
+// parseTypeAnnotation constructs the TypeAnnotation following the current token ":".
+// A type is named by an identifier (int, string, Point) or by the "fn" keyword.
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	if !p.peekTokenIs(token.IDENT) && !p.peekTokenIs(token.FUNCTION) {
+		p.errorf(p.peekToken, "expected type after ':', got %s instead", p.peekToken.Type)
+		return nil
+	}
+	p.nextToken()
+
+	return &ast.TypeAnnotation{Token: p.curToken, Name: p.curToken.Literal}
+}
+
 // parseFunctionParameters constructs the function-literal's
 // parameters as identifiers
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
@@ -540,7 +763,10 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	p.nextToken()
 
 	// construct first parameter as identifier
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.parseParameter()
+	if ident == nil {
+		return nil
+	}
 	identifiers = append(identifiers, ident)
 
 	// keep building identifiers if the next token is a ","
@@ -549,7 +775,10 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		p.nextToken()
 		// advance current token to next parameter
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident := p.parseParameter()
+		if ident == nil {
+			return nil
+		}
 		identifiers = append(identifiers, ident)
 	}
 
@@ -562,6 +791,33 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return identifiers
 }
 
+// parsePipeExpression desugars the pipeline operator into a call expression, the value on the left
+// becomes the first argument of the call on the right (xs |> map(f) is parsed as map(xs, f)).
+// When the right side is not a call, it is called with the value on the left as its only argument
+// (xs |> len is parsed as len(xs)). No InfixExpression is built, so the engines never see the operator.
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+
+	// the operator is left-associative, xs |> f |> g is parsed as g(f(xs)).
+	// A parenthesised call is evaluated first, x |> (f(y)) is parsed as f(y)(x)
+	precedence := p.curPrecedence()
+	p.nextToken()
+	right := p.parseExpression(precedence)
+
+	switch right := right.(type) {
+	case *ast.CallExpression:
+		if p.grouped[right] {
+			return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+		}
+		args := append([]ast.Expression{left}, right.Arguments...)
+		return &ast.CallExpression{Token: right.Token, Function: right.Function, Arguments: args}
+	case nil:
+		return nil
+	default:
+		return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+	}
+}
+
 // parseCallExpression constructs a CallExpression, it expects
 // the current token to be "(" amd expects function to be passed as an argument
 // (can be Identifier or function-literal)
@@ -643,6 +899,21 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseFieldExpression will construct an ast.FieldExpression node using the current token.
+// The field being accessed must be a plain identifier (point.x).
+func (p *Parser) parseFieldExpression(left ast.Expression) ast.Expression {
+	exp := &ast.FieldExpression{Token: p.curToken, Left: left}
+
+	// the token after "." should be the name of the field
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Field = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
 // parseHashLiteral will construct an ast.HashLiteral node using the current token.
 // The ast.HashLiteral implements the Expression interface.
 func (p *Parser) parseHashLiteral() ast.Expression {
@@ -658,6 +929,11 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		// the key can be of any expression type
 		key := p.parseExpression(LOWEST)
 
+		// a first element that is not followed by a colon, ":" starts a set literal instead ({1, 2, 3})
+		if len(hash.Pairs) == 0 && !p.peekTokenIs(token.COLON) {
+			return p.parseSetLiteral(hash.Token, key)
+		}
+
 		// after parsing the key, the next token should be a colon, ":"
 		// advance to that next token, otherwise, we've encountered an error
 		if !p.expectPeek(token.COLON) {
@@ -669,8 +945,9 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		// parse the value of the key-value pair
 		value := p.parseExpression(LOWEST)
 
-		// set the key-value pair to the hash-map
+		// set the key-value pair to the hash-map, remembering the order of the keys
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		// after a key-value pair has been successfully parsed, we should expect
 		// that the next token is either a closing brace, "}" to signal the end of the map
@@ -690,3 +967,22 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	return hash
 }
+
+// parseSetLiteral will construct an ast.SetLiteral node. It is called by parseHashLiteral
+// once it has parsed the first element of the literal and found it is not followed by a colon.
+func (p *Parser) parseSetLiteral(tok token.Token, first ast.Expression) ast.Expression {
+	set := &ast.SetLiteral{Token: tok, Elements: []ast.Expression{first}}
+
+	// the remaining elements are separated by commas
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		set.Elements = append(set.Elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return set
+}
@@ -459,6 +459,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + 1 in b == true",
+			"(((a + 1) in b) == true)",
+		},
+		{
+			"!a in b",
+			"((!a) in b)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -901,6 +909,17 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 
 		testIntegerLiteral(t, value, expectedValue)
 	}
+
+	// the keys are kept in the order they appear in the source
+	for i, want := range []string{"one", "two", "three"} {
+		if hash.Keys[i].String() != want {
+			t.Errorf("hash.Keys[%d] wrong. want=%q, got=%q", i, want, hash.Keys[i].String())
+		}
+	}
+
+	if hash.String() != "{one:1, two:2, three:3}" {
+		t.Errorf("hash.String() wrong. got=%q", hash.String())
+	}
 }
 
 func TestParsingEmptyHashLiteral(t *testing.T) {
@@ -1070,3 +1089,349 @@ func TestFunctionLiteralWithName(t *testing.T) {
 			function.Name)
 	}
 }
+
+func TestGeneratorFunctionParsing(t *testing.T) {
+	input := `fn(x) { yield x; fn() { 1 }; yield x + 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if !function.IsGenerator {
+		t.Fatalf("function literal is not a generator")
+	}
+
+	if len(function.Body.Statements) != 3 {
+		t.Fatalf("function.Body.Statements has not 3 statements. got=%d\n",
+			len(function.Body.Statements))
+	}
+
+	yieldStmt, ok := function.Body.Statements[0].(*ast.YieldStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.YieldStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	if !testIdentifier(t, yieldStmt.Value, "x") {
+		return
+	}
+
+	inner := function.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if inner.IsGenerator {
+		t.Fatalf("inner function literal should not be a generator")
+	}
+}
+
+func TestYieldOutsideOfFunction(t *testing.T) {
+	l := lexer.New(`yield 1;`)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("parser has %d errors, want 1", len(errors))
+	}
+
+	if errors[0] != "yield outside of function" {
+		t.Fatalf("wrong parser error. got=%q", errors[0])
+	}
+}
+
+func TestStructStatementParsing(t *testing.T) {
+	input := "struct Point { x, y }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.StructStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "Point" {
+		t.Errorf("stmt.Name.Value not %q. got=%q", "Point", stmt.Name.Value)
+	}
+
+	if len(stmt.Fields) != 2 {
+		t.Fatalf("wrong number of fields. want=2, got=%d", len(stmt.Fields))
+	}
+
+	testLiteralExpression(t, stmt.Fields[0], "x")
+	testLiteralExpression(t, stmt.Fields[1], "y")
+
+	if stmt.String() != input {
+		t.Errorf("stmt.String() wrong. want=%q, got=%q", input, stmt.String())
+	}
+}
+
+func TestStructStatementDuplicateField(t *testing.T) {
+	l := lexer.New("struct Point { x, x }")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	if errors[0] != "duplicate field x in struct Point" {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestFieldExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"p.x", "(p.x)"},
+		{"p.x.y", "((p.x).y)"},
+		{"-p.x", "(-(p.x))"},
+		{"p.x * q.y", "((p.x) * (q.y))"},
+		{"points[0].x", "((points[0]).x)"},
+		{"make().x", "(make().x)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestForExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+	}{
+		{"for (x in [1, 2]) { x }", "", "x"},
+		{"for (k, v in pairs) { v }", "k", "v"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.ForExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+		}
+
+		if tt.expectedKey == "" {
+			if exp.Key != nil {
+				t.Errorf("exp.Key was not nil. got=%+v", exp.Key)
+			}
+		} else if !testIdentifier(t, exp.Key, tt.expectedKey) {
+			return
+		}
+
+		if !testIdentifier(t, exp.Value, tt.expectedValue) {
+			return
+		}
+
+		if len(exp.Body.Statements) != 1 {
+			t.Errorf("body is not 1 statement. got=%d", len(exp.Body.Statements))
+		}
+	}
+}
+
+func TestForExpressionString(t *testing.T) {
+	l := lexer.New("for (k, v in range(3)) { puts(v) }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := "for (k, v in range(3)) puts(v)"
+	if program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestParsingSetLiterals(t *testing.T) {
+	input := `{1, 2 * 3, "a"}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	set, ok := stmt.Expression.(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.SetLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(set.Elements) != 3 {
+		t.Fatalf("len(set.Elements) not 3. got=%d", len(set.Elements))
+	}
+
+	testIntegerLiteral(t, set.Elements[0], 1)
+	testInfixExpression(t, set.Elements[1], 2, "*", 3)
+
+	if set.String() != `{1, (2 * 3), a}` {
+		t.Errorf("set.String() wrong. got=%q", set.String())
+	}
+}
+
+func TestParsingSingleElementSetLiteral(t *testing.T) {
+	l := lexer.New("{x}")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	set, ok := stmt.Expression.(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.SetLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(set.Elements) != 1 || !testIdentifier(t, set.Elements[0], "x") {
+		t.Fatalf("wrong set elements. got=%v", set.Elements)
+	}
+}
+
+func TestTypeAnnotationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let f = fn(a: int, b): string { a };", "let f = fnf(a: int, b): string a;"},
+		{"let g: fn = fn(): bool { true };", "let g: fn = fng(): bool true;"},
+		{"let p: Point = Point(1, 2);", "let p: Point = Point(1, 2);"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTypeAnnotationPositions(t *testing.T) {
+	input := "let f = fn(a: int): string { a };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	fn := stmt.Value.(*ast.FunctionLiteral)
+
+	paramType := fn.Parameters[0].Type
+	if paramType.Name != "int" || paramType.Token.Line != 1 || paramType.Token.Column != 15 {
+		t.Errorf("wrong parameter annotation. got=%s at %d:%d",
+			paramType.Name, paramType.Token.Line, paramType.Token.Column)
+	}
+
+	if fn.ReturnType.Name != "string" || fn.ReturnType.Token.Column != 21 {
+		t.Errorf("wrong return annotation. got=%s at %d:%d",
+			fn.ReturnType.Name, fn.ReturnType.Token.Line, fn.ReturnType.Token.Column)
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	l := lexer.New("let x: = 5;")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	if errors[0] != "expected type after ':', got = instead" {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestPipeExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs |> len", "len(xs)"},
+		{"xs |> map(f)", "map(xs, f)"},
+		{"xs |> map(f) |> filter(g) |> sum", "sum(filter(map(xs, f), g))"},
+		{"1 + 2 |> add(3)", "add((1 + 2), 3)"},
+		{"a == b |> not", "not((a == b))"},
+		{"x |> fn(y) { y * 2 }", "fn(y) (y * 2)(x)"},
+		{"5 |> (adder(1))", "adder(1)(5)"},
+		{"5 |> (adder)(1)", "adder(5, 1)"},
+		{"5 |> (adder(1)) |> (adder(2))", "adder(2)(adder(1)(5))"},
+		{"let total = xs |> sum;", "let total = sum(xs);"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\n  let = 2;", "2:7: expected next token to be IDENT, got = instead"},
+		{"let x = );", "1:9: no prefix parse function for ) found"},
+		{"yield 1;", "1:1: yield outside of function"},
+		{"struct P { x, x }", "1:15: duplicate field x in struct P"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.PositionedErrors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser errors, got none", tt.input)
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0].Error())
+		}
+		if p.Errors()[0] != errors[0].Message {
+			t.Errorf("%q: Errors and PositionedErrors disagree. got=%q", tt.input, p.Errors()[0])
+		}
+	}
+}
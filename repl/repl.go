@@ -1,10 +1,12 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
+	"github.com/yourfavoritedev/golang-interpreter/checker"
 	"github.com/yourfavoritedev/golang-interpreter/compiler"
 	"github.com/yourfavoritedev/golang-interpreter/lexer"
 	"github.com/yourfavoritedev/golang-interpreter/object"
@@ -16,31 +18,31 @@ const PROMPT = ">> "
 const MONKEY_FACE = "@(^_^)@\n"
 
 func Start(in io.Reader, out io.Writer) {
-	// scanner helps intake standard input (from user) as a data stream
-	scanner := bufio.NewScanner(in)
+	// stdio reads the lines the user types and is the input and output of the programs, so `puts`
+	// writes to out and `read_line` reads the lines following the one that called it. The REPL writes
+	// through it as well, so its output does not interleave with the output of spawned functions.
+	stdio := object.NewIO(in, out)
+	// the lines share the source of the random builtins, the session can seed it with random_seed
+	random := object.NewRandom(time.Now().UnixNano())
 
 	// helps us preserve the work when running multiple compilations
 	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	globals := vm.NewGlobalStore()
+	symbolTable := compiler.NewSymbolTableWithBuiltins(object.DefaultBuiltins())
+	typeChecker := checker.New()
 
 	// keep accepting standard input until the user forcefully stops the program
 	for {
 		// Display prompt to signal start of input after ">> "
-		fmt.Fprintf(out, PROMPT)
-		// Scan loops until it receives input (from user), then makes the input available to its other methods
-		scanned := scanner.Scan()
+		stdio.Write(PROMPT)
+		// ReadLine blocks until it receives a line of input (from user)
+		line, ok, err := stdio.ReadLine()
 
-		// Exit program when no active data-stream left to scan
-		if !scanned {
+		// Exit program when no active data-stream left to read
+		if !ok || err != nil {
 			return
 		}
 
-		// get the entire newly scanned input
-		line := scanner.Text()
 		// create mew lexer using input
 		l := lexer.New(line)
 		// create new parser using lexer
@@ -49,41 +51,66 @@ func Start(in io.Reader, out io.Writer) {
 		// initialize program
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(stdio, p.Errors())
+			continue
+		}
+
+		// the bindings of a line that fails to compile are forgotten
+		checkerCopy, symbolTableCopy := typeChecker.Copy(), symbolTable.Copy()
+
+		// check the annotated types of the program before compiling it
+		if typeErrors := typeChecker.Check(program); len(typeErrors) != 0 {
+			typeChecker, symbolTable = checkerCopy, symbolTableCopy
+			printTypeErrors(stdio, typeErrors)
 			continue
 		}
 
 		// compile the program
 		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
+		err = comp.Compile(program)
 		if err != nil {
-			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
+			typeChecker, symbolTable = checkerCopy, symbolTableCopy
+			stdio.Write(fmt.Sprintf("Woops! Compilation failed:\n %s\n", err))
 			continue
 		}
 
 		// execute the program
 		code := comp.Bytecode()
 		constants = code.Constants
-		machine := vm.NewWithGlobalStore(code, globals)
+		machine := vm.NewWithGlobals(code, globals)
+		machine.SetIO(stdio)
+		machine.SetRandom(random)
 		err = machine.Run()
 		if err != nil {
-			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
+			stdio.Write(fmt.Sprintf("Woops! Executing bytecode failed:\n %s\n", err))
 			continue
 		}
 
 		lastPopped := machine.LastPoppedStackElem()
 		// write program string to output
-		io.WriteString(out, lastPopped.Inspect())
-		io.WriteString(out, "\n")
+		stdio.Write(lastPopped.Inspect() + "\n")
 	}
 }
 
 // printParserErrors writes the parser errors to the output
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, MONKEY_FACE)
-	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, "parser errors:\n")
+func printParserErrors(stdio *object.IO, errors []string) {
+	var out strings.Builder
+	out.WriteString(MONKEY_FACE)
+	out.WriteString("Woops! We ran into some monkey business here!\n")
+	out.WriteString("parser errors:\n")
 	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+		out.WriteString("\t" + msg + "\n")
+	}
+	stdio.Write(out.String())
+}
+
+func printTypeErrors(stdio *object.IO, errors []*checker.Error) {
+	var out strings.Builder
+	out.WriteString(MONKEY_FACE)
+	out.WriteString("Woops! We ran into some monkey business here!\n")
+	out.WriteString("type errors:\n")
+	for _, err := range errors {
+		out.WriteString("\t" + err.Error() + "\n")
 	}
+	stdio.Write(out.String())
 }
@@ -2,9 +2,13 @@ package token
 
 type TokenType string
 
+// Token holds the type and the literal of a lexed token, along with the position
+// of its first character in the input. Line and Column both start at 1.
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int
+	Column  int
 }
 
 const (
@@ -26,10 +30,12 @@ const (
 	GT       = ">"
 	EQ       = "=="
 	NOT_EQ   = "!="
+	PIPE     = "|>"
 
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	DOT       = "."
 
 	LPAREN = "("
 	RPAREN = ")"
@@ -44,6 +50,10 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	YIELD    = "YIELD"
+	STRUCT   = "STRUCT"
+	FOR      = "FOR"
+	IN       = "IN"
 
 	// Data-types
 	STRING   = "STRING"
@@ -60,6 +70,10 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"yield":  YIELD,
+	"struct": STRUCT,
+	"for":    FOR,
+	"in":     IN,
 }
 
 // LookupIdent checks the keywords table to see whether
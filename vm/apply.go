@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"context"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+// Apply calls fn with the given arguments and returns its result, it lets builtins call back into the VM
+// (VM implements object.Runtime). The function and its arguments are pushed on to the stack as if
+// an OpCall instruction was executed, then the VM runs until the frame of the function returns.
+// Since the frames of the callers stay untouched, the VM can keep executing them afterwards.
+// If the function runs into an error, the error is returned as an object.Error and the builtin
+// that called Apply fails with it once it returns.
+func (vm *VM) Apply(fn object.Object, args ...object.Object) object.Object {
+	if vm.applyErr != nil {
+		return &object.Error{Message: vm.applyErr.Error()}
+	}
+
+	value, err := vm.apply(fn, args)
+	if err != nil {
+		vm.applyErr = err
+		return &object.Error{Message: err.Error()}
+	}
+
+	return value
+}
+
+// Call calls fn with the given arguments and returns its result, it lets the Go program embedding the VM
+// call the functions of a Monkey program once it has run. Unlike Apply, an error is returned as an Error,
+// the VM must not be used anymore after that.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return vm.CallContext(context.Background(), fn, args...)
+}
+
+// CallContext calls fn like Call, but stops the call once ctx is done or once it executed more instructions
+// than allowed by SetStepLimit (see RunContext)
+func (vm *VM) CallContext(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	vm.limit(ctx)
+	value, err := vm.apply(fn, args)
+	if err != nil {
+		return nil, vm.positionError(err)
+	}
+
+	return value, nil
+}
+
+// apply pushes fn and args on to the stack, calls fn and runs the VM until the call has returned
+func (vm *VM) apply(fn object.Object, args []object.Object) (object.Object, error) {
+	err := vm.push(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// closures push a frame, the other callables leave their result on the stack right away
+	framesIndex := vm.framesIndex
+	err = vm.executeCall(len(args))
+	if err != nil {
+		return nil, err
+	}
+
+	if vm.framesIndex > framesIndex {
+		err := vm.run(framesIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return vm.pop(), nil
+}
+
+// newWorkerVM creates a VM without any frames that shares the constants and globals of vm.
+// Its stack and frames are its own, so it can apply functions on another goroutine.
+func (vm *VM) newWorkerVM() *VM {
+	return &VM{
+		constants: vm.constants,
+		builtins:  vm.builtins,
+		limits:    vm.limits,
+		stdio:     vm.stdio,
+		random:    vm.random,
+		stack:     make([]object.Object, StackSize),
+		globals:   vm.globals,
+		globalsMu: vm.globalsMu,
+		frames:    make([]*Frame, MaxFrames),
+	}
+}
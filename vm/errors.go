@@ -0,0 +1,57 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+// Error is an error the VM ran into while executing an instruction. Line and Column are the
+// position in the source of the expression the instruction was compiled from, both are 0 when
+// the position is unknown. Error only returns the message, embedders wanting the position in
+// the message format it themselves. Err is the error the VM ran into, errors.Is and errors.As
+// find it through the Error.
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+	Err     error
+}
+
+// Error returns the message of the Error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error the VM ran into
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// errorValue returns the error a Monkey error value handed out by a function running on another VM
+// stands for. A limit that VM ran into is bound to stop this VM as well, so the error of the limits
+// is returned in that case, errors.Is can tell it apart.
+func (vm *VM) errorValue(err *object.Error) error {
+	if vm.limits != nil {
+		if limitErr := vm.limits.Err(); limitErr != nil {
+			return limitErr
+		}
+	}
+	return fmt.Errorf("%s", err.Message)
+}
+
+// positionError returns err as an Error, located at the instruction of the current frame.
+// Errors that already are an Error keep the position where they were first returned.
+func (vm *VM) positionError(err error) error {
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+
+	result := &Error{Message: err.Error(), Err: err}
+	if vm.framesIndex > 0 {
+		frame := vm.currentFrame()
+		result.Line, result.Column = frame.cl.Fn.Positions.Lookup(frame.ip)
+	}
+
+	return result
+}
@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+// newFunctionVM creates a VM that executes a single call of cl with the given arguments.
+// It shares the constants and globals of vm, but has a stack and frames of its own.
+// Instead of a main frame, its first frame belongs to cl, so Run returns once cl returns,
+// leaving the return value as the only element on the stack.
+func (vm *VM) newFunctionVM(cl *object.Closure, args []object.Object) *VM {
+	machine := vm.newWorkerVM()
+
+	// mirror the stack of a regular call, the closure sits right below its arguments
+	machine.stack[0] = cl
+	copy(machine.stack[1:], args)
+	machine.sp = 1 + cl.Fn.NumLocals
+
+	machine.frames[0] = NewFrame(cl, 1)
+	machine.framesIndex = 1
+
+	return machine
+}
+
+// newGenerator creates the generator produced by calling the generator function cl with args.
+// The function body runs on a VM of its own (see newFunctionVM), so that its frame and stack
+// stay intact while the body is suspended. Every resume runs the body until the next OpYield
+// instruction, the generator is finished when the body returns or runs into an error.
+// The body is bound by the limits of the run resuming it, not by those of the run that created it.
+func (vm *VM) newGenerator(cl *object.Closure, args []object.Object) *object.Generator {
+	machine := vm.newFunctionVM(cl, args)
+	finished := false
+
+	resume := func(rt object.Runtime) (object.Object, bool) {
+		if finished {
+			return nil, false
+		}
+
+		if provider, ok := rt.(object.LimitsProvider); ok {
+			machine.limits = provider.Limits()
+		}
+
+		machine.yielded = nil
+		err := machine.run(0)
+		if err != nil {
+			finished = true
+			return &object.Error{Message: err.Error()}, true
+		}
+
+		// the body returned without yielding another value
+		if machine.yielded == nil {
+			finished = true
+			return nil, false
+		}
+
+		return machine.yielded, true
+	}
+
+	return &object.Generator{Resume: resume}
+}
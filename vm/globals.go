@@ -0,0 +1,44 @@
+package vm
+
+import (
+	"sync"
+
+	"github.com/yourfavoritedev/golang-interpreter/compiler"
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+// GlobalStore holds the globals shared by the VMs running the programs of a session, like the lines of
+// the REPL, along with the lock guarding them. The functions a program spawned can still be running
+// when the next program starts, the VMs of both programs must use the same lock (see NewWithGlobals).
+type GlobalStore struct {
+	mu      sync.RWMutex
+	globals []object.Object
+}
+
+// NewGlobalStore creates a GlobalStore without any globals
+func NewGlobalStore() *GlobalStore {
+	return &GlobalStore{globals: make([]object.Object, GlobalsSize)}
+}
+
+// Get returns the global at index, nil if it was never set
+func (s *GlobalStore) Get(index int) object.Object {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.globals[index]
+}
+
+// Set sets the global at index to value
+func (s *GlobalStore) Set(index int, value object.Object) {
+	s.mu.Lock()
+	s.globals[index] = value
+	s.mu.Unlock()
+}
+
+// NewWithGlobals creates a VM executing bytecode with the globals of store, the globals defined
+// by the programs that used store before are available to it
+func NewWithGlobals(bytecode *compiler.Bytecode, store *GlobalStore) *VM {
+	vm := New(bytecode)
+	vm.globals = store.globals
+	vm.globalsMu = &store.mu
+	return vm
+}
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/yourfavoritedev/golang-interpreter/object"
+)
+
+// Spawn applies fn with args on a goroutine of its own, it is called by the spawn builtin (VM implements
+// object.Spawner). Closures get their own VM (see newFunctionVM) which shares the constants and globals.
+// It returns a channel that receives the return value of the function, or the error it ran into, and is
+// closed afterwards.
+func (vm *VM) Spawn(fn object.Object, args []object.Object) object.Object {
+	result := object.NewChannel(1)
+
+	switch fn := fn.(type) {
+	case *object.Closure:
+		if len(args) != fn.Fn.NumParameters {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments: want=%d, got=%d",
+				fn.Fn.NumParameters, len(args))}
+		}
+
+		if fn.Fn.IsGenerator {
+			return &object.Error{Message: "cannot spawn a generator function"}
+		}
+
+		machine := vm.newFunctionVM(fn, args)
+		go func() {
+			defer result.Close()
+
+			err := machine.run(0)
+			if err != nil {
+				result.Send(&object.Error{Message: err.Error()})
+				return
+			}
+			// the return value is the only element left on the stack of the function's VM
+			result.Send(machine.stack[machine.sp-1])
+		}()
+	case *object.Builtin:
+		// the builtin can call back into a VM of its own
+		machine := vm.newWorkerVM()
+		go func() {
+			defer result.Close()
+
+			result.Send(machine.Apply(fn, args...))
+		}()
+	default:
+		return &object.Error{Message: fmt.Sprintf("spawn requires a function, got %s", fn.Type())}
+	}
+
+	return result
+}
@@ -1,7 +1,9 @@
 package vm
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/yourfavoritedev/golang-interpreter/code"
 	"github.com/yourfavoritedev/golang-interpreter/compiler"
@@ -12,27 +14,49 @@ const StackSize = 2048    // arbitrary number
 const GlobalsSize = 65536 // upper limit on the number of global bindings since operands are 16 bits wide.
 const MaxFrames = 1024    // arbitrary number
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
+
+// defaultBuiltins are the builtin functions of the VMs running bytecode without a set of its own
+var defaultBuiltins = object.DefaultBuiltins()
 
 // VM is the struct for our virtual-machine. It holds the bytecode instructions and constants-pool generated by the compiler.
 // A VM implements a stack, as it executes the bytecode, it organizes (push, pop, etc) the evaluated constants on the stack.
 // The field sp helps keep track of the position of the next item in the stack (top to bottom).
 type VM struct {
 	constants []object.Object
-	stack     []object.Object
+	// builtins is the set of builtin functions the OpGetBuiltin instructions refer to
+	builtins *object.BuiltinSet
+	stack    []object.Object
 	// sp always points to the next free slot in the stack. If there's one element on the stack,
 	// located at index 0, the value of sp would be 1 and to access that element we'd use stack[sp-1].
 	sp int
 	// globals helps us store and retreive values observed by the VM as it executes the bytecode instructions.
 	// specifically for identifier values, in which an index for that identifier is associated and can be used to retrieve its value.
 	globals []object.Object
+	// globalsMu guards globals, which are shared with the VMs of spawned functions.
+	globalsMu *sync.RWMutex
 	// frames is the data-structure used to organize the unique frames for compiled functions as the VM executes their bytecode.
 	// the bytecode instructions will be held by a single "main frame" and will be added during the initializing of the VM.
 	frames []*Frame
 	// frameIndex refers to the position of the current frame the VM is working in
 	framesIndex int
+	// yielded holds the value of the last OpYield instruction when the VM runs the body of a generator
+	yielded object.Object
+	// applyErr holds the error a function applied by a builtin ran into (see Apply),
+	// it is returned once the builtin returns.
+	applyErr error
+	// maxSteps is the number of instructions the VM may execute (see SetStepLimit), 0 means no limit
+	maxSteps int64
+	// maxMemory is the number of bytes the VM may allocate (see SetMemoryLimit), 0 means no limit
+	maxMemory int64
+	// limits bounds the execution of the current run (see RunContext), it is nil when there is nothing to bound
+	limits *object.Limits
+	// stdio is the input and output of the builtins the VM calls (see SetIO), nil means object.StandardIO
+	stdio *object.IO
+	// random is the source of the random builtins the VM calls (see SetRandom), nil means the shared one
+	random *object.Random
 }
 
 // New initializes a new VM using the bytecode generated by the compiler.
@@ -40,18 +64,25 @@ type VM struct {
 // will have a preallocated number of elements (StackSize).
 func New(bytecode *compiler.Bytecode) *VM {
 	// constuct a "main frame" with the bytecode instructions
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
 
+	builtins := bytecode.Builtins
+	if builtins == nil {
+		builtins = defaultBuiltins
+	}
+
 	return &VM{
 		constants:   bytecode.Constants,
+		builtins:    builtins,
 		stack:       make([]object.Object, StackSize),
 		sp:          0,
 		globals:     make([]object.Object, GlobalsSize),
+		globalsMu:   &sync.RWMutex{},
 		frames:      frames,
 		framesIndex: 1,
 	}
@@ -64,9 +95,15 @@ func (vm *VM) currentFrame() *Frame {
 }
 
 // pushFrame adds a new frame to the VM's frames and preps the VM for a future frame to be added.
-func (vm *VM) pushFrame(f *Frame) {
+// The frames are limited to MaxFrames, a deeper call is a stack overflow.
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= len(vm.frames) {
+		return fmt.Errorf("%w: more than %d nested calls", object.ErrStackOverflow, len(vm.frames))
+	}
+
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+	return nil
 }
 
 // popFrame returns the current frame and makes its position available for a future frame to be added.
@@ -79,12 +116,113 @@ func (vm *VM) popFrame() *Frame {
 // the specific instructions (opcode + operands) that it was provided
 // from the compiler. It executes the fetch-decode-execute cycle.
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the VM like Run, but stops it once ctx is done or once it executed more instructions
+// than allowed by SetStepLimit. The error returned then wraps ctx.Err() or object.ErrStepLimit, which can
+// be told apart with errors.Is. The functions started with spawn are bound by the same limits.
+// A builtin blocking the VM, like recv on a channel nothing is sent on, is not interrupted.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.limit(ctx)
+	return vm.run(0)
+}
+
+// SetStepLimit sets the number of instructions the VM may execute, the runs after that stop with
+// an error wrapping object.ErrStepLimit once they executed more. A limit of 0 or less removes the limit.
+func (vm *VM) SetStepLimit(maxSteps int64) {
+	vm.maxSteps = maxSteps
+}
+
+// SetMemoryLimit sets the number of bytes the VM may allocate for strings, arrays, hashes and sets
+// (see object.Limits), the runs after that stop with an error wrapping object.ErrMemoryLimit once
+// they allocated more. A limit of 0 or less removes the limit.
+func (vm *VM) SetMemoryLimit(maxMemory int64) {
+	vm.maxMemory = maxMemory
+}
+
+// SetIO sets the input and output of the builtins the VM calls, like `puts` and `read_line`.
+// The functions started with spawn share it. nil restores object.StandardIO.
+func (vm *VM) SetIO(stdio *object.IO) {
+	vm.stdio = stdio
+}
+
+// SetRandom sets the source of the random builtins the VM calls, like `random` and `random_seed`.
+// The functions started with spawn share it. nil restores the source shared by the VMs without one.
+func (vm *VM) SetRandom(random *object.Random) {
+	vm.random = random
+}
+
+// Random returns the source of the random builtins the VM calls, nil if it shares the default one
+// (VM implements object.RandomProvider)
+func (vm *VM) Random() *object.Random {
+	return vm.random
+}
+
+// IO returns the input and output of the builtins the VM calls (VM implements object.IOProvider)
+func (vm *VM) IO() *object.IO {
+	if vm.stdio == nil {
+		return object.StandardIO()
+	}
+	return vm.stdio
+}
+
+// limit sets the limits of the run that is about to start
+func (vm *VM) limit(ctx context.Context) {
+	vm.limits = nil
+	if ctx.Done() != nil || vm.maxSteps > 0 || vm.maxMemory > 0 {
+		vm.limits = object.NewLimits(ctx, vm.maxSteps)
+		vm.limits.SetMemoryLimit(vm.maxMemory)
+	}
+}
+
+// allocate accounts for the size bytes the VM is about to allocate
+func (vm *VM) allocate(size int64) error {
+	if vm.limits == nil {
+		return nil
+	}
+	return vm.limits.Allocate(size)
+}
+
+// CanAllocate returns an error if the run may not allocate size more bytes,
+// it lets builtins check their results fit in the memory limit (VM implements object.Allocator)
+func (vm *VM) CanAllocate(size int64) error {
+	if vm.limits == nil {
+		return nil
+	}
+	return vm.limits.CanAllocate(size)
+}
+
+// Limits returns the limits of the current run, nil if nothing bounds it. The builtins waiting on
+// channels stop once the run must stop (VM implements object.LimitsProvider).
+func (vm *VM) Limits() *object.Limits {
+	return vm.limits
+}
+
+// run executes the fetch-decode-execute cycle until the frames above minFrames have returned.
+// Run executes every frame, while a builtin calling back into the VM (see Apply) only executes
+// the frame of the function it applies, leaving the frames of its callers untouched.
+func (vm *VM) run(minFrames int) (err error) {
+	// the error is located at the instruction that ran into it, before the frames are unwound
+	defer func() {
+		if err != nil {
+			err = vm.positionError(err)
+		}
+	}()
+
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	// iterate through all instructions in the current frame.
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	// iterate through all instructions in the current frame. A VM running a single function call
+	// (see newFunctionVM) has no main frame, it stops as soon as that call returns.
+	for vm.framesIndex > minFrames && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		if vm.limits != nil {
+			if err := vm.limits.Step(); err != nil {
+				return err
+			}
+		}
+
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
@@ -184,7 +322,9 @@ func (vm *VM) Run() error {
 			// pop the top element off the stack, which should be the value bound to an identifier
 			// and save that value in the vm's globals store under the specified index. Making it easy
 			// to retrieve when we need to push that value on to the stack again.
+			vm.globalsMu.Lock()
 			vm.globals[globalIndex] = vm.pop()
+			vm.globalsMu.Unlock()
 
 		// Execute OpGetGlobal instruction
 		case code.OpGetGlobal:
@@ -195,7 +335,11 @@ func (vm *VM) Run() error {
 			// with an OpGetGlobal instruction, we can assume that vm.globals has already
 			// recorded the value associated with this identifier in its store at the
 			// globalIndex. We simply need to push that value back onto the stack.
-			err := vm.push(vm.globals[globalIndex])
+			vm.globalsMu.RLock()
+			global := vm.globals[globalIndex]
+			vm.globalsMu.RUnlock()
+
+			err := vm.push(global)
 			if err != nil {
 				return err
 			}
@@ -226,13 +370,12 @@ func (vm *VM) Run() error {
 
 		// Execute OpGetBuiltin instruction
 		case code.OpGetBuiltin:
-			operand := ins[ip+1]
-			builtinIndex := int(operand)
-			vm.currentFrame().ip += 1
-			// use index to grab the built-in function from the object.Builtins slice
-			definition := object.Builtins[builtinIndex]
+			builtinIndex := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			// use index to grab the built-in function from the VM's set of builtins
+			builtin := vm.builtins.At(builtinIndex)
 			// push the built-in function to the stack
-			err := vm.push(definition.Builtin)
+			err := vm.push(builtin)
 			if err != nil {
 				return err
 			}
@@ -247,6 +390,9 @@ func (vm *VM) Run() error {
 
 			// construct a new array using elements on the stack, buildArray needs a starting index and non-inclusive ending index
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			if err := vm.allocate(object.Size(array)); err != nil {
+				return err
+			}
 			// sp (stack-pointer) needs to be updated after using the elements to build the new array
 			vm.sp = vm.sp - numElements
 			// push the new array onto the stack
@@ -269,6 +415,9 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			if err := vm.allocate(object.Size(hash)); err != nil {
+				return err
+			}
 			// sp (stack-pointer) needs to be updated after using the elements to build the new array
 			vm.sp = vm.sp - numElements
 
@@ -278,6 +427,42 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		// Execute OpSet instruction, build a set from the elements on the stack
+		// and push it on to the stack.
+		case code.OpSet:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			set := object.NewSet(vm.stack[vm.sp-numElements : vm.sp])
+			if err, ok := set.(*object.Error); ok {
+				return fmt.Errorf("%s", err.Message)
+			}
+			if err := vm.allocate(object.Size(set)); err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err := vm.push(set)
+			if err != nil {
+				return err
+			}
+
+		// Execute OpIn instruction, pop the collection and the element and
+		// push whether the element is part of the collection.
+		case code.OpIn:
+			collection := vm.pop()
+			element := vm.pop()
+
+			result := object.Member(element, collection)
+			if err, ok := result.(*object.Error); ok {
+				return fmt.Errorf("%s", err.Message)
+			}
+
+			err := vm.push(result)
+			if err != nil {
+				return err
+			}
+
 		// Execute OpIndex instruction, it should pop the two elements before the sp, the index object and
 		// then the expression object to be indexed. Finally it should push the result of the index operation onto the stack.
 		case code.OpIndex:
@@ -289,6 +474,89 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		// Execute OpGetField instruction. Grab the field name from the constants pool
+		// and replace the struct on top of the stack with the value of its field.
+		case code.OpGetField:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+			err := vm.executeFieldAccess(vm.pop(), name)
+			if err != nil {
+				return err
+			}
+
+		// Execute OpGetFieldIndex instruction. If the struct on top of the stack has the StructType the
+		// compiler expected, replace it with the field at the given position of its layout. Any other
+		// value has its field looked up by name.
+		case code.OpGetFieldIndex:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			fieldIndex := code.ReadUint16(ins[ip+3:])
+			vm.currentFrame().ip += 4
+
+			structType := vm.constants[constIndex].(*object.StructType)
+			left := vm.pop()
+			if st, ok := left.(*object.Struct); ok && st.StructType == structType {
+				err := vm.push(st.Fields[fieldIndex])
+				if err != nil {
+					return err
+				}
+				break
+			}
+
+			err := vm.executeFieldAccess(left, structType.Fields[fieldIndex])
+			if err != nil {
+				return err
+			}
+
+		// Execute OpIter instruction. Replace the collection on top of the stack
+		// with an iterator that walks its elements.
+		case code.OpIter:
+			collection := vm.pop()
+
+			iterable, ok := collection.(object.Iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", collection.Type())
+			}
+
+			err := vm.push(iterable.Iterate())
+			if err != nil {
+				return err
+			}
+
+		// Execute OpIterNext instruction. Push the value (and the key) of the next element
+		// produced by the iterator on top of the stack. Once the iterator is exhausted,
+		// pop it off the stack and jump to the end of the loop.
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numValues := int(ins[ip+3])
+			vm.currentFrame().ip += 3
+
+			iterator := vm.stack[vm.sp-1].(object.Iterator)
+			key, value, ok := iterator.Next(vm)
+			if !ok {
+				vm.pop()
+				vm.currentFrame().ip = pos - 1
+				continue
+			}
+
+			// a generator that fails hands out the error as its value
+			if err, isErr := value.(*object.Error); isErr {
+				return vm.errorValue(err)
+			}
+
+			if numValues == 2 {
+				err := vm.push(key)
+				if err != nil {
+					return err
+				}
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+
 		// Execute OpClosure instruction. This is the designated instruction that will grab the existing object.CompiledFunction
 		// from the constants pool, enclose it in a Closure and push it on to the stack.
 		case code.OpClosure:
@@ -338,6 +606,25 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		// Execute OpTailCall instruction. It behaves like OpCall, except that a called closure
+		// takes over the current frame instead of pushing a new one, since the current function
+		// would only return the callee's result anyway.
+		case code.OpTailCall:
+			operand := ins[ip+1]
+			numArgs := int(operand)
+			vm.currentFrame().ip += 1
+
+			err := vm.executeTailCall(numArgs)
+			if err != nil {
+				return err
+			}
+
+		// Execute OpYield instruction. It should pop the yielded value and suspend the generator body
+		// by leaving the loop, the frame keeps its ip so the next Run continues after the OpYield.
+		case code.OpYield:
+			vm.yielded = vm.pop()
+			return nil
+
 		// Execute OpReturnValue instruction. It should pop the returnValue sitting before the stack pointer and exit
 		// the inner-execution context accordingly.
 		case code.OpReturnValue:
@@ -400,7 +687,7 @@ func isTruthy(obj object.Object) bool {
 // incrementing it to designate the next slot to be allocated
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return object.ErrStackOverflow
 	}
 
 	vm.stack[vm.sp] = o
@@ -492,6 +779,10 @@ func (vm *VM) executeBinaryStringOperation(
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
+	if err := vm.allocate(int64(len(leftValue) + len(rightValue))); err != nil {
+		return err
+	}
+
 	// push the Object to the stack
 	return vm.push(&object.String{Value: fmt.Sprint(leftValue, rightValue)})
 }
@@ -510,14 +801,14 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
-	// compare of pointer-addresses. For boolean objects,
-	// right and left are holding the constants TRUE and FALSE listed, and we
-	// are reusing those constants so we can compare their pointer-addresses.
+	// compare the values of the objects. Strings, arrays, hashes and the other
+	// values are equal when they hold the same value, functions and channels
+	// are only equal to themselves (see object.Equal).
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
 	default:
 		return fmt.Errorf("unknown operator: %d, (%s %s)",
 			op, leftType, rightType)
@@ -602,7 +893,7 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 		elements[i-startIndex] = vm.stack[i]
 	}
 
-	return &object.Array{Elements: elements}
+	return object.NewArray(elements)
 }
 
 // buildHash constructs a new Object.hash using existing elements
@@ -611,25 +902,20 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 func (vm *VM) buildHash(
 	startIndex, endIndex int,
 ) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
 	for i := startIndex; i < endIndex; i += 2 {
-		// build hashPair
 		key := vm.stack[i]
 		value := vm.stack[i+1]
-		pair := object.HashPair{Key: key, Value: value}
 
-		// build hashKey
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		// assign new key value pair to the hash, it keeps the keys in the order they were compiled
+		err := hash.Set(key, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s", err.Message)
 		}
-
-		// assign new key value pair to hash map
-		hashedPairs[hashKey.HashKey()] = pair
 	}
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 // executeIndexExpression performs an index operation with the provided arguments.
@@ -646,18 +932,34 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	}
 }
 
+// executeFieldAccess is the helper method that looks up the named field
+// of a struct and pushes its value to the stack
+func (vm *VM) executeFieldAccess(left object.Object, name string) error {
+	st, ok := left.(*object.Struct)
+	if !ok {
+		return fmt.Errorf("field access not supported: %s", left.Type())
+	}
+
+	value := st.GetField(name)
+	if err, ok := value.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+
+	return vm.push(value)
+}
+
 // executeArrayIndex is the helper method that performs an index operation
 // on an array object and pushes the result to the stack
 func (vm *VM) executeArrayIndex(left, index object.Object) error {
 	arrayObject := left.(*object.Array)
 	i := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	max := int64(arrayObject.Len() - 1)
 
 	if i < 0 || i > max {
 		return vm.push(Null)
 	}
 
-	return vm.push(arrayObject.Elements[i])
+	return vm.push(arrayObject.At(int(i)))
 }
 
 // executeHashIndex is the helper method that performs an index operation
@@ -665,17 +967,16 @@ func (vm *VM) executeArrayIndex(left, index object.Object) error {
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
+	if !object.IsHashable(index) {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(index)
 	if !ok {
 		return vm.push(Null)
 	}
 
-	return vm.push(pair.Value)
+	return vm.push(value)
 }
 
 // executeCall is invoked when the VM executes the OpCall expression. When a function is called,
@@ -688,6 +989,8 @@ func (vm *VM) executeCall(numArgs int) error {
 		return vm.callClosure(callee, numArgs)
 	case *object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
+	case *object.StructType:
+		return vm.callStructType(callee, numArgs)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
 	}
@@ -701,17 +1004,60 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 			cl.Fn.NumParameters, numArgs)
 	}
 
+	// calling a generator function does not execute it yet, the callee is replaced with a generator
+	if cl.Fn.IsGenerator {
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(vm.newGenerator(cl, args))
+	}
+
 	basePointer := vm.sp - numArgs
 	// create a new frame for this function, we need to initialize the basePointer so
 	// it starts directly after the index of the function - being the start of its local-bindings.
 	frame := NewFrame(cl, basePointer)
-	vm.pushFrame(frame)
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return object.ErrStackOverflow
+	}
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
 	// the stack pointer is `increased` to allocate space ("the hole") for the local-bindings and any new values
 	// generated in the function will start at the updated stack pointer (above the "hole").
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
 
+// executeTailCall is invoked when the VM executes the OpTailCall instruction. A closure in tail position
+// reuses the current frame: the callee and its arguments are moved down to where the current function and
+// its arguments sit, and the frame starts over with the callee's instructions. This keeps the number of frames
+// constant no matter how deep the recursion goes. Builtins do not use frames, so they are called like usual
+// and the OpReturnValue following the call returns their result.
+func (vm *VM) executeTailCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	cl, ok := callee.(*object.Closure)
+	if !ok || cl.Fn.IsGenerator {
+		return vm.executeCall(numArgs)
+	}
+
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	frame := vm.currentFrame()
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return object.ErrStackOverflow
+	}
+	// frame.basePointer - 1 is the position of the function that is currently executing
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+
+	frame.cl = cl
+	frame.ip = -1
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	return nil
+}
+
 // pushClosure grabs a compiledFunction at the given constIndex in the constants pool,
 // wraps it in a Closure and pushes it onto the stack
 func (vm *VM) pushClosure(constIndex, numFree int) error {
@@ -738,8 +1084,19 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	// grab the arguments for this function on the stack
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	// execute the builtin function
-	result := builtin.Fn(args...)
+	// execute the builtin function, it can call back into the VM to apply functions
+	result := builtin.Fn(vm, args...)
+	if vm.applyErr != nil {
+		err := vm.applyErr
+		vm.applyErr = nil
+		return err
+	}
+	// the memory the builtin allocated for its result is accounted once it returns
+	if vm.limits != nil && result != nil {
+		if err := vm.limits.AllocateResult(result, args); err != nil {
+			return err
+		}
+	}
 	// set sp to the position of the built-in function on the stack
 	vm.sp = vm.sp - numArgs - 1
 	// replace function with return value
@@ -752,8 +1109,22 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
+// callStructType constructs a new struct from the arguments on the stack,
+// and replaces the struct type on the stack with it.
+func (vm *VM) callStructType(st *object.StructType, numArgs int) error {
+	result := st.Instantiate(vm.stack[vm.sp-numArgs : vm.sp])
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(result)
+}
+
 // NewWithGlobalStore keeps global state in the REPL so the VM can execute
 // with the byteode and global store from a previous compilation.
+// The VM does not share the lock of the globals with the VMs that used s before, NewWithGlobals
+// must be used instead while the functions they spawned may still be running.
 func NewWithGlobalStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = s
@@ -1,8 +1,15 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/yourfavoritedev/golang-interpreter/ast"
 	"github.com/yourfavoritedev/golang-interpreter/compiler"
@@ -68,31 +75,52 @@ func testExpectedObject(
 			t.Errorf("object not Array: %T (%+v)", actual, actual)
 		}
 
-		if len(array.Elements) != len(expected) {
+		if array.Len() != len(expected) {
 			t.Errorf("wrong num of elements. want=%d, got=%d",
-				len(expected), len(array.Elements))
+				len(expected), array.Len())
 		}
 
 		for i, expectedElem := range expected {
-			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			err := testIntegerObject(int64(expectedElem), array.At(i))
 			if err != nil {
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
 		}
+	case []interface{}:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if array.Len() != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), array.Len())
+			return
+		}
+
+		for i, expectedElem := range expected {
+			testExpectedObject(t, expectedElem, array.At(i))
+		}
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
 			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
 		}
 
-		if len(hash.Pairs) != len(expected) {
+		if hash.Len() != len(expected) {
 			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d",
-				len(expected), len(hash.Pairs))
+				len(expected), hash.Len())
 			return
 		}
 
+		pairs := make(map[object.HashKey]object.HashPair)
+		for _, pair := range hash.Pairs() {
+			pairs[pair.Key.(object.Hashable).HashKey()] = pair
+		}
+
 		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+			pair, ok := pairs[expectedKey]
 			if !ok {
 				t.Errorf("no pair for given key in Pairs")
 			}
@@ -775,3 +803,1493 @@ func TestRecursiveFibonacci(t *testing.T) {
 
 	runVmTests(t, tests)
 }
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+		let countDown = fn(x) {
+			if (x == 0) {
+				return 0;
+			} else {
+				countDown(x - 1);
+			}
+		};
+		countDown(100000);
+		`,
+			expected: 0,
+		},
+		{
+			input: `
+		let sum = fn(x, acc) {
+			if (x == 0) {
+				return acc;
+			}
+			return sum(x - 1, acc + x);
+		};
+		sum(10000, 0);
+		`,
+			expected: 50005000,
+		},
+		{
+			input: `
+		let apply = fn(f, x) { f(x) };
+		let countDown = fn(x) { if (x == 0) { 99 } else { apply(countDown, x - 1) } };
+		countDown(5000);
+		`,
+			expected: 99,
+		},
+		{
+			input: `
+		let wrapper = fn(x) {
+			let step = fn(x, acc) {
+				if (x == 0) { acc } else { step(x - 1, push(acc, x)) }
+			};
+			len(step(x, []));
+		};
+		wrapper(3000);
+		`,
+			expected: 3000,
+		},
+		{
+			input: `
+		let lastOf = fn(arr) { last(arr) };
+		lastOf([1, 2, 3]);
+		`,
+			expected: 3,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+		let gen = fn() { yield 1; yield 2; }();
+		next(gen) + next(gen);
+		`,
+			expected: 3,
+		},
+		{
+			input: `
+		let gen = fn() { yield 1; }();
+		next(gen);
+		next(gen);
+		`,
+			expected: Null,
+		},
+		{
+			input: `
+		let counter = fn(from) {
+			let step = 10;
+			yield from;
+			yield from + step;
+			yield from + step * 2;
+		};
+		let gen = counter(5);
+		let collect = fn(gen, acc) {
+			if (done(gen)) { return acc; }
+			collect(gen, push(acc, next(gen)));
+		};
+		collect(gen, []);
+		`,
+			expected: []int{5, 15, 25},
+		},
+		{
+			input: `
+		let naturals = fn(n) { yield n; yield 0; };
+		let take = fn(gen, n, acc) {
+			if (n == 0) { return acc; }
+			take(gen, n - 1, acc + next(gen));
+		};
+		let a = naturals(1);
+		let b = naturals(2);
+		take(a, 1, 0) + take(b, 1, 0) + take(a, 1, 0);
+		`,
+			expected: 3,
+		},
+		{
+			input: `
+		let lines = fn(prefix) {
+			let emit = fn(i) { yield prefix + i; };
+			yield prefix;
+			yield next(emit("-"));
+		};
+		let gen = lines("log");
+		next(gen) + next(gen);
+		`,
+			expected: "loglog-",
+		},
+		{
+			input: `
+		let gen = fn() { yield 1; yield 2; }();
+		[done(gen), next(gen), next(gen), done(gen)];
+		`,
+			expected: []interface{}{false, 1, 2, true},
+		},
+		{
+			input:    `let gen = fn() { yield 1 + true; }(); next(gen);`,
+			expected: &object.Error{Message: "unsupported types for binary operation: INTEGER, BOOLEAN"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+		let square = fn(x) { x * x };
+		let a = spawn(square, 3);
+		let b = spawn(square, 4);
+		recv(a) + recv(b);
+		`,
+			expected: 25,
+		},
+		{
+			input: `
+		let ch = channel();
+		spawn(fn(c, v) { send(c, v) }, ch, 42);
+		recv(ch);
+		`,
+			expected: 42,
+		},
+		{
+			input: `
+		let base = 10;
+		let results = channel(2);
+		let worker = fn(i) { send(results, base + i) };
+		spawn(worker, 1);
+		spawn(worker, 2);
+		let other = 5;
+		recv(results) + recv(results) + other;
+		`,
+			expected: 28,
+		},
+		{
+			input: `
+		let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+		let done = spawn(count, 5000, 0);
+		[recv(done), recv(done)];
+		`,
+			expected: []interface{}{5000, Null},
+		},
+		{
+			input: `
+		let a = channel();
+		let b = channel(1);
+		send(b, 7);
+		select([a, b]);
+		`,
+			expected: []int{1, 7},
+		},
+		{
+			input:    `let c = channel(1); close(c); recv(c);`,
+			expected: Null,
+		},
+		{
+			input:    `let c = channel(1); close(c); close(c);`,
+			expected: &object.Error{Message: "close of closed channel"},
+		},
+		{
+			input:    `let c = channel(1); close(c); send(c, 1);`,
+			expected: &object.Error{Message: "send on closed channel"},
+		},
+		{
+			input:    `recv(spawn(fn() { 1 + true }));`,
+			expected: &object.Error{Message: "unsupported types for binary operation: INTEGER, BOOLEAN"},
+		},
+		{
+			input:    `recv(spawn(len, "four"));`,
+			expected: 4,
+		},
+		{
+			input:    `spawn(1)`,
+			expected: &object.Error{Message: "spawn requires a function, got INTEGER"},
+		},
+		{
+			input:    `spawn(fn(x) { x }, 1, 2)`,
+			expected: &object.Error{Message: "wrong number of arguments: want=1, got=2"},
+		},
+		{
+			input:    `let spawn = fn(x) { x * 2 }; spawn(21)`,
+			expected: 42,
+		},
+		{
+			input:    `let run = fn(spawn) { recv(spawn(len, "four")) }; run(spawn)`,
+			expected: 4,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `struct Point { x, y }; let p = Point(1, 2); p.x + p.y`,
+			expected: 3,
+		},
+		{
+			input: `
+		struct Point { x, y };
+		struct Line { from, to };
+		let l = Line(Point(1, 2), Point(3, 4));
+		l.to.x - l.from.y
+		`,
+			expected: 1,
+		},
+		{
+			input: `
+		let makePair = fn(a, b) { struct Pair { first, second }; Pair(a, b) };
+		makePair("a", "b").second
+		`,
+			expected: "b",
+		},
+		{
+			input:    `struct Box { items }; Box([1, 2, 3]).items[1]`,
+			expected: 2,
+		},
+		{
+			// the second iteration reads p.x from a struct of another type than the compiler expected
+			input: `
+		struct Point { x, y };
+		struct Swapped { y, x };
+		let p = Point(1, 2);
+		let out = [];
+		for (i in range(2)) { let out = push(out, p.x); let p = Swapped(3, 4) };
+		out
+		`,
+			expected: []int{1, 4},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `struct Point { x, y }; Point(1, 2).z`,
+			expected: "unknown field z for struct Point",
+		},
+		{
+			input:    `struct Point { x, y }; Point(1)`,
+			expected: "wrong number of fields for struct Point: want=2, got=1",
+		},
+		{
+			input:    `{"x": 1}.x`,
+			expected: "field access not supported: HASH",
+		},
+		{
+			input:    `struct Point { x, y }; let p = Point(1, 2); for (i in range(2)) { p.x; let p = 5 }`,
+			expected: "field access not supported: INTEGER",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []vmTestCase{
+		// a let statement in the body updates the binding of the enclosing scope, like in the evaluator
+		{`let acc = []; for (i in range(3)) { let acc = push(acc, i) }; acc`, []int{0, 1, 2}},
+		{`let sum = 0; for (x in range(5)) { let sum = sum + x }; sum`, 10},
+		{`let f = fn() { let n = 0; for (c in "héllo") { let n = n + 1 }; n }; f()`, 5},
+		{
+			input: `
+		let out = channel(10);
+		for (x in [1, 2, 3]) { send(out, x * 2) };
+		close(out);
+		[recv(out), recv(out), recv(out), recv(out)]
+		`,
+			expected: []interface{}{2, 4, 6, Null},
+		},
+		{
+			input: `
+		let out = channel(10);
+		for (i, x in ["a", "b"]) { send(out, i) };
+		recv(out) + recv(out)
+		`,
+			expected: 1,
+		},
+		{
+			input: `
+		let out = channel(10);
+		for (k, v in {"a": 1, "b": 2, "c": 3}) { send(out, v) };
+		recv(out) + recv(out) + recv(out)
+		`,
+			expected: 6,
+		},
+		{
+			input: `
+		let out = channel(10);
+		for (k, v in {"only": 7}) { send(out, k) };
+		recv(out)
+		`,
+			expected: "only",
+		},
+		{
+			input: `
+		let out = channel(10);
+		for (c in "héllo") { send(out, c) };
+		recv(out) + recv(out) + recv(out)
+		`,
+			expected: "hél",
+		},
+		{
+			input: `
+		let out = channel(10);
+		for (x in range(10, 0, -3)) { send(out, x) };
+		close(out);
+		[recv(out), recv(out), recv(out), recv(out), recv(out)]
+		`,
+			expected: []interface{}{10, 7, 4, 1, Null},
+		},
+		{
+			input: `
+		let contains = fn(arr, target) {
+			for (x in arr) {
+				if (x == target) { return true; }
+			}
+			false
+		};
+		[contains([1, 2, 3], 2), contains([1, 2, 3], 4), contains([], 1)]
+		`,
+			expected: []interface{}{true, false, false},
+		},
+		{
+			input: `
+		let countTo = fn(n) { for (i in range(1, n + 1)) { yield i } };
+		let out = channel(10);
+		for (x in countTo(3)) { send(out, x) };
+		recv(out) + recv(out) + recv(out)
+		`,
+			expected: 6,
+		},
+		{
+			input: `
+		let out = channel(10);
+		let pairs = fn(xs, ys) {
+			for (x in xs) {
+				for (y in ys) { send(out, x * y) }
+			}
+		};
+		pairs([1, 2], [10, 100]);
+		close(out);
+		[recv(out), recv(out), recv(out), recv(out), recv(out)]
+		`,
+			expected: []interface{}{10, 100, 20, 200, Null},
+		},
+		{
+			input:    `for (x in [1, 2]) { x }`,
+			expected: Null,
+		},
+		{
+			input:    `if (true) { for (x in []) { x } }`,
+			expected: Null,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForInLoopErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `for (x in 5) { x }`,
+			expected: "cannot iterate over INTEGER",
+		},
+		{
+			input:    `let gen = fn() { yield 1; yield 1 + true }; for (x in gen()) { x }`,
+			expected: "unsupported types for binary operation: INTEGER, BOOLEAN",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []vmTestCase{
+		{`len({1, 2, 2, 3, 1})`, 3},
+		{`len(to_set(["a", "b", "a"]))`, 2},
+		{`len(to_set())`, 0},
+		{`[2 in {1, 2}, 3 in {1, 2}, "a" in {"a"}, [1] in {1}]`, []interface{}{true, false, true, false}},
+		{`let ids = to_set([1, 2, 3]); let other = {3, 4}; len(union(ids, other))`, 4},
+		{`let i = intersection({1, 2, 3}, {2, 3, 4}); [len(i), 2 in i, 1 in i]`, []interface{}{2, true, false}},
+		{`let d = difference({1, 2, 3}, {2}); [len(d), 1 in d, 2 in d]`, []interface{}{2, true, false}},
+		{`["a" in {"a": 1}, "b" in {"a": 1}, 2 in [1, 2], "ell" in "hello"]`, []interface{}{true, false, true, true}},
+		{
+			`
+		let out = channel(10);
+		for (x in {5}) { send(out, x) };
+		recv(out)
+		`,
+			5,
+		},
+		{`union({1}, [1])`, &object.Error{Message: "second argument to `union` must be SET, got ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSetErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `{[1, fn() {}]}`,
+			expected: "unusable as set element: ARRAY",
+		},
+		{
+			input:    `1 in 2`,
+			expected: "operator `in` not supported: INTEGER",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestTypeAnnotationsAreIgnored(t *testing.T) {
+	tests := []vmTestCase{
+		{`let x: int = 5; x`, 5},
+		{`let add = fn(a: int, b: int): int { a + b }; add(1, 2)`, 3},
+		{`let name: int = "not checked at runtime"; name`, "not checked at runtime"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3] |> len`, 3},
+		{`let double = fn(x) { x * 2 }; 5 |> double |> double`, 20},
+		{`let add = fn(a, b) { a + b }; 1 |> add(2) |> add(3)`, 6},
+		{`[1] |> push(2) |> rest`, []int{2}},
+		{`3 |> fn(x) { x * x }`, 9},
+		{`let adder = fn(n) { fn(x) { x + n } }; 5 |> (adder(1))`, 6},
+		{`recv(fn(x) { x + 1 } |> spawn(4))`, 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+// twice is a builtin that applies its first argument two times, starting with its second argument.
+// It calls back into the engine through the object.Runtime it is given.
+var twice = &object.Builtin{
+	Fn: func(rt object.Runtime, args ...object.Object) object.Object {
+		once := rt.Apply(args[0], args[1])
+		if _, ok := once.(*object.Error); ok {
+			return once
+		}
+		return rt.Apply(args[0], once)
+	},
+}
+
+// runWithTwice compiles and runs input with the twice builtin bound to a global
+func runWithTwice(input string) (object.Object, error) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	globals := make([]object.Object, GlobalsSize)
+	globals[symbolTable.Define("twice").Index] = twice
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	err := comp.Compile(parse(input))
+	if err != nil {
+		return nil, err
+	}
+
+	vm := NewWithGlobalStore(comp.Bytecode(), globals)
+	err = vm.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func TestBuiltinCallbacks(t *testing.T) {
+	tests := []vmTestCase{
+		{`twice(fn(x) { x * 2 }, 3)`, 12},
+		{`let offset = 10; twice(fn(x) { x + offset }, 1)`, 21},
+		{`twice(fn(x) { twice(fn(y) { y + 1 }, x) }, 0)`, 4},
+		{
+			`
+		let count = fn(n) { if (n == 0) { 0 } else { twice(fn(x) { x }, count(n - 1)) + 1 } };
+		count(100)
+		`,
+			100,
+		},
+		{`let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } }; twice(countDown, 5000)`, 0},
+		{`twice(rest, [1, 2, 3])`, []int{3}},
+		{`struct Box { value }; twice(fn(b) { Box(b.value * 3) }, Box(1)).value`, 9},
+		{`let gen = fn(x) { yield x; }; next(twice(fn(g) { g }, gen(7)))`, 7},
+	}
+
+	for _, tt := range tests {
+		result, err := runWithTwice(tt.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.expected, result)
+	}
+}
+
+func TestBuiltinCallbackErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`twice(fn(x) { x + true }, 1)`, "unsupported types for binary operation: INTEGER, BOOLEAN"},
+		{`twice(fn(a, b) { a }, 1)`, "wrong number of arguments: want=2, got=1"},
+		{`twice(1, 1)`, "calling non-function and non-built-in"},
+	}
+
+	for _, tt := range tests {
+		_, err := runWithTwice(tt.input)
+		if err == nil {
+			t.Fatalf("%q: expected VM error but resulted in none.", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let factor = 3; fn(a, b) { (a + b) * factor }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	fn := vm.LastPoppedStackElem()
+	result := vm.Apply(fn, &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	testExpectedObject(t, 9, result)
+
+	// the VM is still usable after a failed call
+	result = vm.Apply(fn, &object.Integer{Value: 1})
+	testExpectedObject(t, &object.Error{Message: "wrong number of arguments: want=2, got=1"}, result)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([], fn(x) { x * 2 })`, []int{}},
+		{`let factor = 3; map([1, 2], fn(x) { x * factor })`, []int{3, 6}},
+		{`map([[1], [2, 3]], len)`, []int{1, 2}},
+		{`map([1, 2], fn(x) { })`, []interface{}{Null, Null}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+		{`filter([1, 2, 3], fn(x) { false })`, []int{}},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, 10},
+		{`reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])`, []int{1, 4, 9}},
+		{`reduce([], fn(acc, x) { acc + x }, 0)`, 0},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort(["b", "c", "a"])`, []interface{}{"a", "b", "c"}},
+		{`sort([1, 3, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`let arr = [2, 1]; sort(arr); arr`, []int{2, 1}},
+		{`sort_by(["ccc", "a", "bb"], len)`, []interface{}{"a", "bb", "ccc"}},
+		{`sort_by([[2, "a"], [1, "b"], [2, "c"]], first)`, []interface{}{[]interface{}{1, "b"}, []interface{}{2, "a"}, []interface{}{2, "c"}}},
+		{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+		{`reverse([])`, []int{}},
+		{`zip([1, 2, 3], ["a", "b"])`, []interface{}{[]interface{}{1, "a"}, []interface{}{2, "b"}}},
+		{`zip([1], [2], [3])`, []interface{}{[]int{1, 2, 3}}},
+		{`flatten([1, [2, 3], [[4]]])`, []interface{}{1, 2, 3, []int{4}}},
+		{`flatten([1, [2, [3, [4]]]], 10)`, []int{1, 2, 3, 4}},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, true},
+		{`any([], fn(x) { true })`, false},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, true},
+		{`all([1, 2, 3], fn(x) { x > 1 })`, false},
+		{`find([1, 2, 3, 4], fn(x) { x > 2 })`, 3},
+		{`find([1, 2], fn(x) { x > 2 })`, Null},
+		{`index_of([1, 2, 3], 2)`, 1},
+		{`index_of(["a", "b"], "b")`, 1},
+		{`index_of([1, 2, 3], 4)`, -1},
+		{`contains([1, 2, 3], 3)`, true},
+		{`contains([1, 2, 3], "3")`, false},
+		{`[1, 2, 3, 4] |> filter(fn(x) { x > 2 }) |> map(fn(x) { x * 10 }) |> reduce(fn(a, b) { a + b })`, 70},
+		{`map(1, fn(x) { x })`, &object.Error{Message: "first argument to `map` must be ARRAY, got INTEGER"}},
+		{`filter([1], 1)`, &object.Error{Message: "second argument to `filter` must be FUNCTION, got INTEGER"}},
+		{`reduce([], fn(a, b) { a + b })`, &object.Error{Message: "`reduce` of empty array with no initial value"}},
+		{`sort([1, "a"])`, &object.Error{Message: "cannot compare STRING with INTEGER"}},
+		{`sort_by([1, 2], fn(x) { [x] })`, &object.Error{Message: "cannot compare ARRAY with ARRAY"}},
+		{`zip([1])`, &object.Error{Message: "wrong number of arguments. got=1, want at least 2"}},
+		{`flatten([1], "a")`, &object.Error{Message: "second argument to `flatten` must be INTEGER, got STRING"}},
+		{`index_of(1, 2)`, &object.Error{Message: "first argument to `index_of` must be ARRAY or STRING, got INTEGER"}},
+		{`map([[1], 2], first)`, &object.Error{Message: "argument to `first` must be ARRAY, got INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCollectionBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2], fn(x) { x + true })`, "unsupported types for binary operation: INTEGER, BOOLEAN"},
+		{`sort([2, 1], fn(a, b) { a + true })`, "unsupported types for binary operation: INTEGER, BOOLEAN"},
+		{`reduce([1, 2], fn(a) { a })`, "wrong number of arguments: want=1, got=2"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("%q: expected VM error but resulted in none.", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestPushAndRestOnLargeArrays(t *testing.T) {
+	// push and rest share the elements of their argument, building and consuming
+	// a large array one element at a time does not copy it over and over
+	input := `
+	let grow = fn(arr, n) { if (n == 0) { arr } else { grow(push(arr, len(arr)), n - 1) } };
+	let drop = fn(arr, n) { if (n == 0) { arr } else { drop(rest(arr), n - 1) } };
+	let steps = grow([], 100);
+	let numbers = reduce(steps, fn(arr, i) { grow(arr, 500) }, []);
+	let tail = reduce(rest(steps), fn(arr, i) { drop(arr, 500) }, numbers);
+	[len(numbers), first(numbers), last(numbers), len(tail), first(tail), last(tail), len(push(tail, 0)), len(numbers)]
+	`
+
+	runVmTests(t, []vmTestCase{{input, []int{50000, 0, 49999, 500, 49500, 49999, 501, 50000}}})
+}
+
+func TestCollectionBuiltinsOnLargeArrays(t *testing.T) {
+	elements := make([]object.Object, 10000)
+	for i := range elements {
+		elements[i] = &object.Integer{Value: int64(i)}
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	globals := make([]object.Object, GlobalsSize)
+	globals[symbolTable.Define("numbers").Index] = object.NewArray(elements)
+
+	input := `numbers |> map(fn(x) { x * 2 }) |> filter(fn(x) { x > 5000 }) |> reverse() |> sort() |> reduce(fn(a, b) { a + b })`
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithGlobalStore(comp.Bytecode(), globals)
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// the sum of the doubled numbers which are greater than 5000
+	expected := 0
+	for i := 0; i < 10000; i++ {
+		if i*2 > 5000 {
+			expected += i * 2
+		}
+	}
+	testExpectedObject(t, expected, vm.LastPoppedStackElem())
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,c", ",")`, []interface{}{"a", "b", "c"}},
+		{`split("  a  b c ")`, []interface{}{"a", "b", "c"}},
+		{`split("abc", "")`, []interface{}{"a", "b", "c"}},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join([1, true, "x"])`, "1truex"},
+		{`join([], "-")`, ""},
+		{`trim("  hello ")`, "hello"},
+		{`trim("--hi--", "-")`, "hi"},
+		{`upper("Hello")`, "HELLO"},
+		{`lower("Hello")`, "hello"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("a-b-c", "-", "", 1)`, "ab-c"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "cat")`, false},
+		{`starts_with("monkey", "mon")`, true},
+		{`starts_with("monkey", "key")`, false},
+		{`ends_with("monkey", "key")`, true},
+		{`index_of("monkey", "key")`, 3},
+		{`index_of("monkey", "cat")`, -1},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`pad_left("7", 3, "0")`, "007"},
+		{`pad_left("7", 3)`, "  7"},
+		{`pad_right("ab", 5, "xy")`, "abxyx"},
+		{`pad_right("abcdef", 3)`, "abcdef"},
+		{`pad_left("é", 2, ".")`, ".é"},
+		{`format("%s is %d", "monkey", 5)`, "monkey is 5"},
+		{`format("%v|%5s|%-3d|", [1, 2], "ab", 7)`, "[1, 2]|   ab|7  |"},
+		{`format("no verbs")`, "no verbs"},
+		{`"a b c" |> split() |> map(upper) |> join("-")`, "A-B-C"},
+		{`split(1, ",")`, &object.Error{Message: "first argument to `split` must be STRING, got INTEGER"}},
+		{`upper(1)`, &object.Error{Message: "argument to `upper` must be STRING, got INTEGER"}},
+		{`join("abc", ",")`, &object.Error{Message: "first argument to `join` must be ARRAY, got STRING"}},
+		{`contains("abc", 1)`, &object.Error{Message: "second argument to `contains` must be STRING, got INTEGER"}},
+		{`repeat("a", -1)`, &object.Error{Message: "count of `repeat` must not be negative, got -1"}},
+		{`repeat("ab", 9223372036854775807)`, &object.Error{Message: "result of `repeat` is too large"}},
+		{`repeat("a", 4294967297)`, &object.Error{Message: "result of `repeat` is too large"}},
+		{`pad_left("a", 3, "")`, &object.Error{Message: "padding of `pad_left` must not be empty"}},
+		{`replace("a", "a")`, &object.Error{Message: "wrong number of arguments. got=2, want=3 or 4"}},
+		{`format(1)`, &object.Error{Message: "first argument to `format` must be STRING, got INTEGER"}},
+		{`format("%d", "x")`, &object.Error{Message: "format: %d cannot format STRING"}},
+		{`format("%s", [1])`, "[1]"},
+		{`format("%t", 1)`, &object.Error{Message: "format: %t cannot format INTEGER"}},
+		{`format("%s and %s", "a")`, &object.Error{Message: "format: missing argument for %s"}},
+		{`format("%[2]d", 1)`, &object.Error{Message: "format: missing argument for %d"}},
+		{`format("%*d", "a", 1)`, &object.Error{Message: "format: width must be INTEGER, got STRING"}},
+		{`format("%s", "a", "b")`, &object.Error{Message: "format: too many arguments. got=2, used=1"}},
+		{`format("%[2]d", 1, 2)`, &object.Error{Message: "format: too many arguments. got=2, used=1"}},
+		{`format("100%")`, &object.Error{Message: "format: missing verb at the end of the format string"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`keys({"b": 2, "a": 1, "c": 3})`, []interface{}{"b", "a", "c"}},
+		{`keys({3: 1, 1: 2, 2: 3})`, []int{3, 1, 2}},
+		{`keys({})`, []int{}},
+		{`values({"b": 2, "a": 1, "c": 3})`, []int{2, 1, 3}},
+		{`entries({"b": 2, "a": 1})`, []interface{}{[]interface{}{"b", 2}, []interface{}{"a", 1}}},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`let f = fn() { }; has({"a": f()}, "a")`, true},
+		{`has({1: 1}, "1")`, false},
+		{
+			`set({1: 1}, 2, 2)`,
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 1,
+				(&object.Integer{Value: 2}).HashKey(): 2,
+			},
+		},
+		{
+			`set({1: 1}, 1, 5)`,
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 5,
+			},
+		},
+		{`let h = {1: 1}; set(h, 2, 2); len(keys(h))`, 1},
+		{
+			`delete({1: 1, 2: 2}, 1)`,
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 2,
+			},
+		},
+		{
+			`delete({1: 1}, 2)`,
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 1,
+			},
+		},
+		{`let h = {1: 1}; delete(h, 1); h[1]`, 1},
+		{
+			`merge({1: 1, 2: 2}, {2: 20, 3: 30}, {3: 300})`,
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 1,
+				(&object.Integer{Value: 2}).HashKey(): 20,
+				(&object.Integer{Value: 3}).HashKey(): 300,
+			},
+		},
+		{`{"a": 1} |> set("b", 2) |> delete("a") |> keys()`, []interface{}{"b"}},
+		{`keys([1])`, &object.Error{Message: "argument to `keys` must be HASH, got ARRAY"}},
+		{`has({}, [fn() {}])`, &object.Error{Message: "unusable as hash key: ARRAY"}},
+		{`set({}, fn() {}, 1)`, &object.Error{Message: "unusable as hash key: CLOSURE"}},
+		{`delete({})`, &object.Error{Message: "wrong number of arguments. got=1, want=2"}},
+		{`merge({}, 1)`, &object.Error{Message: "arguments to `merge` must be HASH, got INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`json_parse(json_stringify({"a": [1, 2]}))["a"]`, []int{1, 2}},
+		{`json_parse("[true, null]")`, []interface{}{true, Null}},
+		{`json_stringify({"b": [1, "x"], "a": if (false) { 1 }})`, `{"b":[1,"x"],"a":null}`},
+		{`json_stringify([1, {"a": 1}], true)`, "[\n  1,\n  {\n    \"a\": 1\n  }\n]"},
+		{`json_stringify([], false)`, `[]`},
+		{`struct User { name, age }; json_stringify(User("monkey", 5))`, `{"name":"monkey","age":5}`},
+		{`let data = json_parse(json_stringify({"n": 1})); json_stringify(set(data, "n", data["n"] + 1))`, `{"n":2}`},
+		{`json_parse("[1,")`, &object.Error{Message: "invalid JSON: unexpected end of input at line 1, column 4"}},
+		{`json_parse(1)`, &object.Error{Message: "argument to `json_parse` must be STRING, got INTEGER"}},
+		{`json_stringify([fn() {}])`, &object.Error{Message: "unsupported type for JSON: CLOSURE"}},
+		{`json_stringify(1, 2)`, &object.Error{Message: "second argument to `json_stringify` must be BOOLEAN, got INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`abs(-5)`, 5},
+		{`abs(5)`, 5},
+		{`min(3, 1, 2)`, 1},
+		{`min([4, -2, 8])`, -2},
+		{`max(3, 1, 2)`, 3},
+		{`max([4, -2, 8])`, 8},
+		{`max(7)`, 7},
+		{`pow(2, 10)`, 1024},
+		{`pow(-3, 3)`, -27},
+		{`pow(5, 0)`, 1},
+		{`sqrt(16)`, 4},
+		{`sqrt(17)`, 4},
+		{`sqrt(0)`, 0},
+		{`sqrt(9223372036854775807)`, 3037000499},
+		{`div_floor(7, 2)`, 3},
+		{`div_floor(-7, 2)`, -4},
+		{`div_floor(7, -2)`, -4},
+		{`div_floor(6, 2)`, 3},
+		{`div_ceil(7, 2)`, 4},
+		{`div_ceil(-7, 2)`, -3},
+		{`div_ceil(6, 3)`, 2},
+		{`div_round(7, 2)`, 4},
+		{`div_round(-7, 2)`, -4},
+		{`div_round(7, 3)`, 2},
+		{`div_round(8, 3)`, 3},
+		{`div_round(-8, 3)`, -3},
+		{`div_round(1, -3)`, 0},
+		{`clamp(5, 0, 3)`, 3},
+		{`clamp(-5, 0, 3)`, 0},
+		{`clamp(2, 0, 3)`, 2},
+		{`sum([1, 2, 3])`, 6},
+		{`sum([])`, 0},
+		{`[1, 2, 3] |> map(fn(x) { pow(x, 2) }) |> sum()`, 14},
+		{`abs("a")`, &object.Error{Message: "argument to `abs` must be INTEGER, got STRING"}},
+		{`min()`, &object.Error{Message: "wrong number of arguments. got=0, want at least 1"}},
+		{`max([])`, &object.Error{Message: "`max` of empty array"}},
+		{`min(1, "a")`, &object.Error{Message: "arguments to `min` must be INTEGER, got STRING"}},
+		{`pow(2, -1)`, &object.Error{Message: "exponent of `pow` must not be negative, got -1"}},
+		{`sqrt(-1)`, &object.Error{Message: "argument to `sqrt` must not be negative, got -1"}},
+		{`div_floor(1, 0)`, &object.Error{Message: "division by zero in `div_floor`"}},
+		{`div_floor(5)`, &object.Error{Message: "wrong number of arguments. got=1, want=2"}},
+		{`clamp(1, 3, 0)`, &object.Error{Message: "bounds of `clamp` are reversed, got 3 > 0"}},
+		{`sum([1, "a"])`, &object.Error{Message: "elements of `sum` must be INTEGER, got STRING"}},
+		{`random(0)`, &object.Error{Message: "argument to `random` must be positive, got 0"}},
+		{`random_int(2, 1)`, &object.Error{Message: "bounds of `random_int` are reversed, got 2 > 1"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRandomBuiltins(t *testing.T) {
+	draw := `random_seed(42); [random(), random(1000), random_int(-5, 5), random_int(-9223372036854775807 - 1, 9223372036854775807)]`
+
+	run := func(input string, random *object.Random) object.Object {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetRandom(random)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		return vm.LastPoppedStackElem()
+	}
+
+	// the same seed produces the same numbers
+	first, second := run(draw, nil), run(draw, nil)
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("seeded draws differ. first=%s, second=%s", first.Inspect(), second.Inspect())
+	}
+
+	// random_seed only seeds the source of the VM, the spawned functions share it
+	own := object.NewRandom(0)
+	run(`random_seed(42)`, own)
+	run(`random_seed(7)`, nil)
+	run(`random_seed(9)`, object.NewRandom(0))
+	expected := object.NewRandom(42)
+	result := run(`[random(), recv(spawn(random))]`, own)
+	if want := fmt.Sprintf("[%d, %d]", expected.Int63(), expected.Int63()); result.Inspect() != want {
+		t.Errorf("wrong draws of the seeded source. want=%s, got=%s", want, result.Inspect())
+	}
+
+	tests := []vmTestCase{
+		{`all(map(split(repeat("x", 200), ""), fn(x) { random(10) }), fn(n) { if (n < 0) { false } else { n < 10 } })`, true},
+		{`all(map(split(repeat("x", 200), ""), fn(x) { random_int(-2, 2) }), fn(n) { if (n < -2) { false } else { n < 3 } })`, true},
+		{`random_int(3, 3)`, 3},
+		{`random() < 0`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTypeBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`type(1)`, "int"},
+		{`type("a")`, "string"},
+		{`type(true)`, "bool"},
+		{`type(if (false) { 1 })`, "null"},
+		{`type([1])`, "array"},
+		{`type({1: 2})`, "hash"},
+		{`type({1, 2})`, "set"},
+		{`type(fn() {})`, "fn"},
+		{`type(len)`, "fn"},
+		{`struct Point { x, y }; type(Point)`, "fn"},
+		{`struct Point { x, y }; type(Point(1, 2))`, "Point"},
+		{`type(channel())`, "channel"},
+		{`let gen = fn() { yield 1; }; type(gen())`, "generator"},
+		{`type(range(3))`, "range"},
+		{`type(len(1))`, "error"},
+		{`is_int(1)`, true},
+		{`is_int("1")`, false},
+		{`is_string("1")`, true},
+		{`is_bool(false)`, true},
+		{`is_null(first([]))`, true},
+		{`is_array([])`, true},
+		{`is_hash({})`, true},
+		{`is_set({1})`, true},
+		{`is_fn(fn(x) { x })`, true},
+		{`is_fn(1)`, false},
+		{`int("42")`, 42},
+		{`int("-7")`, -7},
+		{`int(5)`, 5},
+		{`int(true)`, 1},
+		{`int(false)`, 0},
+		{`str(42)`, "42"},
+		{`str("a")`, "a"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`str(true) + str(1)`, "true1"},
+		{`bool("true")`, true},
+		{`bool("false")`, false},
+		{`bool(0)`, false},
+		{`bool(3)`, true},
+		{`bool(first([]))`, false},
+		{`int(str(123)) + 1`, 124},
+		{`["1", "2", "3"] |> map(int) |> sum()`, 6},
+		{`int("4a")`, &object.Error{Message: `cannot convert "4a" to int`}},
+		{`int("")`, &object.Error{Message: `cannot convert "" to int`}},
+		{`int("99999999999999999999")`, &object.Error{Message: `cannot convert "99999999999999999999" to int: out of range`}},
+		{`int([1])`, &object.Error{Message: "cannot convert array to int"}},
+		{`bool("yes")`, &object.Error{Message: `cannot convert "yes" to bool`}},
+		{`bool({})`, &object.Error{Message: "cannot convert hash to bool"}},
+		{`type()`, &object.Error{Message: "wrong number of arguments. got=0, want=1"}},
+		{`is_int(1, 2)`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a" == "a"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+		{`upper("a") == "A"`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[] == []`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{1, 2} == {2, 1}`, true},
+		{`struct P { x }; P([1]) == P([1])`, true},
+		{`if (false) { 1 } == first([])`, true},
+		{`[if (false) { 1 }] == [first([])]`, true},
+		{`1 == "1"`, false},
+		{`[1] == {1}`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+		{`[[1, 2], [3]] |> index_of([3])`, 1},
+		{`[1, 2] in [[1, 2], [3]]`, true},
+		{`filter(["a", "b", "a"], fn(x) { x == "a" })`, []interface{}{"a", "a"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	tests := []vmTestCase{
+		{`str({"c": 1, "a": 2, "b": 3})`, "{c: 1, a: 2, b: 3}"},
+		{`str({3: "x", 1: "y", true: "z"})`, "{3: x, 1: y, true: z}"},
+		{`str({"a": 1, "b": 2, "a": 3})`, "{a: 3, b: 2}"},
+		{`str(set({"b": 1, "a": 2}, "c", 3))`, "{b: 1, a: 2, c: 3}"},
+		{`str(set({"b": 1, "a": 2}, "b", 3))`, "{b: 3, a: 2}"},
+		{`str(delete({"c": 1, "a": 2, "b": 3}, "a"))`, "{c: 1, b: 3}"},
+		{`str(merge({"z": 1, "y": 2}, {"x": 3, "z": 4}))`, "{z: 4, y: 2, x: 3}"},
+		{`let ks = fn(h) { for (k, v in h) { yield k; } }; let g = ks({"b": 1, "c": 2, "a": 3}); [next(g), next(g), next(g)]`, []interface{}{"b", "c", "a"}},
+		{`reduce(entries({"c": 1, "a": 2, "b": 3}), fn(acc, e) { acc + e[0] }, "")`, "cab"},
+		{`str({3, 1, 2})`, "{3, 1, 2}"},
+		{`str(union({3, 1}, {2, 3, 0}))`, "{3, 1, 2, 0}"},
+		{`str(intersection({3, 1, 2}, {2, 3}))`, "{3, 2}"},
+		{`str(difference({3, 1, 2}, {1}))`, "{3, 2}"},
+		{`str(to_set([5, 4, 5, 3]))`, "{5, 4, 3}"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCompositeHashKeys(t *testing.T) {
+	tests := []vmTestCase{
+		{`{[1, 2]: "cell"}[[1, 2]]`, "cell"},
+		{`{[1, 2]: "cell"}[[2, 1]]`, Null},
+		{`let grid = {[0, 0]: 1, [0, 1]: 2}; grid[[0, 1]] + grid[[0, 0]]`, 3},
+		{`{[1, [2, 3]]: 1}[[1, [2, 3]]]`, 1},
+		{`{{"a": 1, "b": 2}: "x"}[{"b": 2, "a": 1}]`, "x"},
+		{`str({[1, 2]: 1, [1, 2]: 2})`, "{[1, 2]: 2}"},
+		{`has(set({}, [1, 2], true), [1, 2])`, true},
+		{`[3, 4] in {[1, 2], [3, 4]}`, true},
+		{`len(to_set([[1], [1], [2]]))`, 2},
+		{`set({}, [1, fn() {}], 1)`, &object.Error{Message: "unusable as hash key: ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input        string
+		line, column int
+	}{
+		{"let x = 1;\nx + true", 2, 3},
+		{"let f = fn(a) {\n  a - \"b\"\n};\nf(1)", 2, 5},
+		{"map([1, 2], fn(x) {\n  -\"x\"\n})", 2, 3},
+		{"let h = {};\n  h[fn() {}]", 2, 4},
+		{"1(2)", 1, 2},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		vmErr, ok := err.(*Error)
+		if !ok {
+			t.Fatalf("%q: expected a VM Error. got=%T (%v)", tt.input, err, err)
+		}
+		if vmErr.Line != tt.line || vmErr.Column != tt.column {
+			t.Errorf("%q: wrong position of %q. want=%d:%d, got=%d:%d",
+				tt.input, vmErr.Message, tt.line, tt.column, vmErr.Line, vmErr.Column)
+		}
+	}
+}
+
+// manyBuiltins returns the default builtins without len, with puts overridden and with n more
+// builtins returning their number. Identifiers cannot hold digits, so the builtin returning 12
+// is named b_bc (see builtinName).
+func manyBuiltins(n int) *object.BuiltinSet {
+	builtins := object.DefaultBuiltins()
+	builtins.Remove("len")
+	builtins.Define("puts", &object.Builtin{
+		Fn: func(rt object.Runtime, args ...object.Object) object.Object {
+			return &object.String{Value: "overridden"}
+		},
+	})
+	for i := 0; i < n; i++ {
+		value := &object.Integer{Value: int64(i)}
+		builtins.Define(builtinName(i), &object.Builtin{
+			Fn: func(rt object.Runtime, args ...object.Object) object.Object { return value },
+		})
+	}
+	return builtins
+}
+
+// builtinName returns the name of the i-th builtin added by manyBuiltins, its digits spelled as letters
+func builtinName(i int) string {
+	name := []byte("b_")
+	for _, digit := range strconv.Itoa(i) {
+		name = append(name, byte('a'+digit-'0'))
+	}
+	return string(name)
+}
+
+func TestCustomBuiltins(t *testing.T) {
+	builtins := manyBuiltins(300)
+
+	tests := []vmTestCase{
+		{`b_a() + b_cjj()`, 299},
+		{`puts(1)`, "overridden"},
+		{`map([1, 2], fn(x) { b_cfg() + x })`, []int{257, 258}},
+		{`recv(spawn(fn() { b_cia() }))`, 280},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewWithBuiltins(builtins)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+
+	err := compiler.NewWithBuiltins(builtins).Compile(parse(`len([])`))
+	if err == nil || err.Error() != "1:1: undefined variable: len" {
+		t.Errorf("len should not be defined. got=%v", err)
+	}
+
+	// the default builtins are not affected
+	runVmTests(t, []vmTestCase{{`len([1, 2])`, 2}})
+
+	// removing a builtin after compiling a program does not change the builtins it calls
+	builtins = object.DefaultBuiltins()
+	comp := compiler.NewWithBuiltins(builtins)
+	if err := comp.Compile(parse(`[len([1, 2]), first([3])]`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	builtins.Remove("len")
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	result, ok := vm.LastPoppedStackElem().(*object.Array)
+	if !ok || result.Len() != 2 {
+		t.Fatalf("wrong result. got=%v", vm.LastPoppedStackElem())
+	}
+	testExpectedObject(t, &object.Error{Message: "builtin `len` was removed"}, result.At(0))
+	testExpectedObject(t, 3, result.At(1))
+}
+
+// runWithLimits compiles and runs input, stopping it once ctx is done or after maxSteps instructions
+func runWithLimits(ctx context.Context, input string, maxSteps int64) (object.Object, error) {
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		return nil, err
+	}
+
+	vm := New(comp.Bytecode())
+	vm.SetStepLimit(maxSteps)
+	err = vm.RunContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func TestStepLimit(t *testing.T) {
+	result, err := runWithLimits(context.Background(), `let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(9)`, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testExpectedObject(t, 45, result)
+
+	tests := []string{
+		`for (x in range(1000000000000)) { x }`,
+		`let loop = fn(n) { loop(n + 1) }; loop(0)`,
+		`let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(500)`,
+		`map([1], fn(x) { for (y in range(1000000000000)) { y } })`,
+		`recv(spawn(fn() { for (x in range(1000000000000)) { x } }))`,
+		`let g = fn() { for (x in range(1000000000000)) { yield x } }; for (x in g()) { x }`,
+	}
+
+	for _, input := range tests {
+		_, err := runWithLimits(context.Background(), input, 1000)
+		if !errors.Is(err, object.ErrStepLimit) {
+			t.Errorf("%q: expected object.ErrStepLimit. got=%v", input, err)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := runWithLimits(ctx, `for (x in range(1000000000000)) { x }`, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded. got=%v", err)
+	}
+
+	var vmErr *Error
+	if !errors.As(err, &vmErr) || vmErr.Line != 1 {
+		t.Errorf("expected a positioned Error. got=%#v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = runWithLimits(canceled, `let loop = fn(n) { loop(n + 1) }; loop(0)`, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled. got=%v", err)
+	}
+
+	// the builtins waiting on a channel stop waiting once the context is done
+	blocking := []string{
+		`recv(channel())`,
+		`send(channel(), 1)`,
+		`select([channel(), channel()])`,
+		`recv(spawn(fn() { recv(channel()) }))`,
+	}
+
+	for _, input := range blocking {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := runWithLimits(ctx, input, 0)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%q: expected context.DeadlineExceeded. got=%v", input, err)
+		}
+	}
+}
+
+func runWithMemoryLimit(input string, maxMemory int64) (object.Object, error) {
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		return nil, err
+	}
+
+	vm := New(comp.Bytecode())
+	vm.SetMemoryLimit(maxMemory)
+	err = vm.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func TestMemoryLimit(t *testing.T) {
+	result, err := runWithMemoryLimit(`len(repeat("ab", 100) + join(map([1, 2, 3], str), ","))`, 1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testExpectedObject(t, 205, result)
+
+	tests := []string{
+		`let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } }; len(double("ab", 40))`,
+		`len(repeat("ab", 100000000))`,
+		`pad_left("a", 100000000)`,
+		`let s = repeat("x", 100000); join(map(split(repeat("a", 20000), ""), fn(x) { s }))`,
+		`replace(repeat("a", 10000), "a", repeat("x", 100000))`,
+		`format(repeat("%[1]s", 1000), repeat("x", 100000))`,
+		`let s = repeat("x", 100000); json_stringify(map(split(repeat("a", 20000), ""), fn(x) { s }))`,
+		`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(push(arr, n), n - 1) } }; len(grow([], 100000))`,
+		`let build = fn(n, acc) { if (n == 0) { acc } else { build(n - 1, [acc, {"n": n}, {n}]) } }; build(100000, [])`,
+		`recv(spawn(fn() { repeat("ab", 100000000) }))`,
+	}
+
+	for _, input := range tests {
+		_, err := runWithMemoryLimit(input, 1<<20)
+		if !errors.Is(err, object.ErrMemoryLimit) {
+			t.Errorf("%q: expected object.ErrMemoryLimit. got=%v", input, err)
+		}
+	}
+}
+
+func TestGlobalStore(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	constants := []object.Object{}
+	store := NewGlobalStore()
+
+	run := func(input string) object.Object {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants = comp.Bytecode().Constants
+
+		vm := NewWithGlobals(comp.Bytecode(), store)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		return vm.LastPoppedStackElem()
+	}
+
+	// the function spawned by the first program reads x while it is written and the following programs run
+	run(`let x = 0; let done = spawn(fn() { for (i in range(20000)) { x }; 1 });`)
+	x, _ := symbolTable.Resolve("x")
+	for i := 1; i <= 100; i++ {
+		store.Set(x.Index, &object.Integer{Value: int64(i)})
+		run(`let y = x;`)
+	}
+
+	testExpectedObject(t, 101, run(`recv(done) + y`))
+	testExpectedObject(t, 100, store.Get(x.Index))
+}
+
+func TestGeneratorLimits(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	run := func(ctx context.Context, input string, maxSteps int64) error {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			return err
+		}
+		constants = comp.Bytecode().Constants
+
+		vm := NewWithGlobalStore(comp.Bytecode(), globals)
+		vm.SetStepLimit(maxSteps)
+		return vm.RunContext(ctx)
+	}
+
+	// the generators created by a run that is over are not bound by its limits anymore
+	ctx, cancel := context.WithCancel(context.Background())
+	err := run(ctx, `let gen = fn() { for (x in range(5000)) { yield x } }();`, 0)
+	cancel()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := run(context.Background(), `for (x in gen) { x }`, 0); err != nil {
+		t.Errorf("unexpected error resuming the generator: %s", err)
+	}
+
+	// they are bound by the limits of the run resuming them instead
+	err = run(context.Background(), `let slow = fn() { for (x in range(1000000000000)) { x }; yield 1 }();`, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := run(context.Background(), `next(slow)`, 1000); !errors.Is(err, object.ErrStepLimit) {
+		t.Errorf("expected object.ErrStepLimit. got=%v", err)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []string{
+		`let f = fn(n) { 1 + f(n + 1) }; f(0)`,
+		`let f = fn(n) { let a = 1; let b = 2; let c = 3; a + b + c + f(n + 1) }; f(0)`,
+		`let f = fn() { [f()] }; f()`,
+		`map([1], fn(x) { let f = fn(n) { 1 + f(n + 1) }; f(0) })`,
+	}
+
+	for _, input := range tests {
+		_, err := runWithMemoryLimit(input, 0)
+		if !errors.Is(err, object.ErrStackOverflow) {
+			t.Errorf("%q: expected object.ErrStackOverflow. got=%v", input, err)
+		}
+	}
+
+	// a tail call reuses the frame of its caller, it does not overflow
+	result, err := runWithMemoryLimit(`let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)`, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testExpectedObject(t, 100000, result)
+}
+
+func TestIO(t *testing.T) {
+	input := `
+	let greet = fn(name) { puts("hello " + name) };
+	let name = input("name? ");
+	recv(spawn(greet, name));
+	puts(read_line(), read_line())
+	`
+
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 8)
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			comp := compiler.New()
+			if err := comp.Compile(parse(input)); err != nil {
+				t.Errorf("compiler error: %s", err)
+				return
+			}
+			vm := New(comp.Bytecode())
+			vm.SetIO(object.NewIO(strings.NewReader(fmt.Sprintf("monkey %d\nlast\n", i)), &outputs[i]))
+			if err := vm.Run(); err != nil {
+				t.Errorf("vm error: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range outputs {
+		expected := fmt.Sprintf("name? hello monkey %d\nlast\nnull\n", i)
+		if outputs[i].String() != expected {
+			t.Errorf("wrong output of program %d. want=%q, got=%q", i, expected, outputs[i].String())
+		}
+	}
+}